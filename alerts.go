@@ -0,0 +1,348 @@
+package tinkoff
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	sdk "github.com/TinkoffCreditSystems/invest-openapi-go-sdk"
+	"github.com/shopspring/decimal"
+)
+
+// TcfAlertRule is the alert condition written as an expression over the market data, e.g.
+// "price('TCSG') > sma('TCSG', 20) && change_pct('TCSG', '1d') > 3". The functions are:
+//
+//	price(ticker)              the current price
+//	sma(ticker, days)          the average close of the last days daily candles
+//	change_pct(ticker, period) the change of the current price from the close the period ago in percents,
+//	                           the period is the number of days, weeks, months or years: '1d', '2w', '3m', '1y'
+//	rate(currency)             the exchange rate of the currency to the rouble on the exchange (the TOM instrument)
+//
+// The numbers, + - * / and the parentheses, the comparisons < <= > >= == != and && || ! are supported,
+// so the price targets and the FX levels of TcfFXAlertRule are conditions as well
+type TcfAlertRule struct {
+	Name      string
+	Condition string
+}
+
+// Validate checks the condition is correct
+func (r TcfAlertRule) Validate() error {
+	_, _, err := r.compile()
+	return err
+}
+
+func (r TcfAlertRule) compile() (exprNode, []*alertCall, error) {
+
+	calls := []*alertCall{}
+	p := &exprParser{call: func(name string, args []string) (exprNode, error) {
+		call, err := newAlertCall(name, args)
+		if err != nil {
+			return nil, err
+		}
+		calls = append(calls, call)
+		return exprCall{key: call.key()}, nil
+	}}
+
+	expr, err := compile(r.Condition, p)
+	if err != nil {
+		return nil, nil, errors.New(fmt.Sprintf("Alert %q: %s", r.Name, err))
+	}
+
+	return expr, calls, nil
+}
+
+// TcfAlert is a triggered rule with the values of the functions of its condition
+type TcfAlert struct {
+	Name      string `report:"Alert"`
+	Condition string `report:"Condition"`
+	Values    string `report:"Values"`
+}
+
+// alertCall is the call of the function of the alert condition with the checked arguments
+type alertCall struct {
+	function string
+	symbol   string // the ticker or the currency
+	days     int    // the days of sma
+	years    int    // the period of change_pct
+	months   int
+	weeks    int
+}
+
+func newAlertCall(name string, args []string) (*alertCall, error) {
+
+	arity := map[string]int{"price": 1, "sma": 2, "change_pct": 2, "rate": 1}
+	n, ok := arity[name]
+	if !ok {
+		return nil, errors.New(fmt.Sprintf("Unknown function %q", name))
+	}
+	if len(args) != n {
+		return nil, errors.New(fmt.Sprintf("Function %s expects %d arguments, got %d", name, n, len(args)))
+	}
+
+	call := &alertCall{function: name, symbol: strings.ToUpper(args[0])}
+
+	switch name {
+	case "sma":
+		days, err := strconv.Atoi(args[1])
+		if err != nil || days < 1 {
+			return nil, errors.New(fmt.Sprintf("Invalid number of days %q of sma", args[1]))
+		}
+		call.days = days
+	case "change_pct":
+		if err := call.parsePeriod(args[1]); err != nil {
+			return nil, err
+		}
+	case "rate":
+		if err := TcfCurrency(call.symbol).Validate(); err != nil {
+			return nil, err
+		}
+	}
+
+	return call, nil
+}
+
+// parsePeriod parses the period of change_pct, e.g. '1d', '2w', '3m', '1y'
+func (c *alertCall) parsePeriod(period string) error {
+
+	invalid := errors.New(fmt.Sprintf("Invalid period %q of change_pct", period))
+	if len(period) < 2 {
+		return invalid
+	}
+
+	n, err := strconv.Atoi(period[:len(period)-1])
+	if err != nil || n < 1 {
+		return invalid
+	}
+
+	switch period[len(period)-1] {
+	case 'd':
+		c.days = n
+	case 'w':
+		c.weeks = n
+	case 'm':
+		c.months = n
+	case 'y':
+		c.years = n
+	default:
+		return invalid
+	}
+
+	return nil
+}
+
+// key identifies the call, the same calls of the rules are evaluated once
+func (c *alertCall) key() string {
+	switch c.function {
+	case "sma":
+		return fmt.Sprintf("sma('%s', %d)", c.symbol, c.days)
+	case "change_pct":
+		return fmt.Sprintf("change_pct('%s', '%s')", c.symbol, c.period())
+	}
+	return fmt.Sprintf("%s('%s')", c.function, c.symbol)
+}
+
+func (c *alertCall) period() string {
+	switch {
+	case c.years > 0:
+		return fmt.Sprintf("%dy", c.years)
+	case c.months > 0:
+		return fmt.Sprintf("%dm", c.months)
+	case c.weeks > 0:
+		return fmt.Sprintf("%dw", c.weeks)
+	}
+	return fmt.Sprintf("%dd", c.days)
+}
+
+// since returns the start of the candles the call needs, the weekends and the holidays are covered by the margin
+func (c *alertCall) since(now time.Time) time.Time {
+	switch c.function {
+	case "sma":
+		return now.AddDate(0, 0, -2*c.days-10)
+	case "change_pct":
+		return now.AddDate(-c.years, -c.months, -7*c.weeks-c.days-10)
+	}
+	return now
+}
+
+// CheckAlerts evaluates the conditions against the current market data and returns the triggered rules.
+// The candles of every ticker are requested once for all the rules
+func (acc *TcfAccount) CheckAlerts(ctx context.Context, rules []*TcfAlertRule) ([]*TcfAlert, error) {
+
+	type compiled struct {
+		rule  *TcfAlertRule
+		expr  exprNode
+		calls []*alertCall
+	}
+
+	now := time.Now()
+	all := []compiled{}
+	since := make(map[string]time.Time)
+
+	for _, rule := range rules {
+
+		expr, calls, err := rule.compile()
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, compiled{rule: rule, expr: expr, calls: calls})
+
+		for _, call := range calls {
+			if call.function == "sma" || call.function == "change_pct" {
+				if from, ok := since[call.symbol]; !ok || call.since(now).Before(from) {
+					since[call.symbol] = call.since(now)
+				}
+			}
+		}
+	}
+
+	data := &alertData{acc: acc, now: now, since: since, figis: make(map[string]string), candles: make(map[string][]sdk.Candle)}
+	values := make(map[string]decimal.Decimal)
+
+	res := []*TcfAlert{}
+	for _, c := range all {
+
+		shown := []string{}
+		for _, call := range c.calls {
+			key := call.key()
+			if _, ok := values[key]; !ok {
+				value, err := data.value(ctx, call)
+				if err != nil {
+					return nil, err
+				}
+				values[key] = value
+			}
+			shown = append(shown, fmt.Sprintf("%s = %s", key, values[key].Round(4)))
+		}
+
+		if !c.expr.eval(exprEnv{calls: values}).IsZero() {
+			res = append(res, &TcfAlert{Name: c.rule.Name, Condition: c.rule.Condition, Values: strings.Join(shown, ", ")})
+		}
+	}
+
+	return res, nil
+}
+
+// alertData requests the market data of the alert functions
+type alertData struct {
+	acc         *TcfAccount
+	now         time.Time
+	since       map[string]time.Time
+	figis       map[string]string
+	candles     map[string][]sdk.Candle
+	instruments []sdk.Instrument
+}
+
+func (d *alertData) value(ctx context.Context, call *alertCall) (decimal.Decimal, error) {
+
+	if call.function == "rate" {
+		return d.rate(ctx, call.symbol)
+	}
+
+	figi, err := d.figi(ctx, call.symbol)
+	if err != nil {
+		return decimal.Zero, err
+	}
+
+	price, err := d.acc.GetCurrentPrice(ctx, figi)
+	if err != nil {
+		return decimal.Zero, err
+	}
+
+	if call.function == "price" {
+		return money(price), nil
+	}
+
+	candles, err := d.candlesOf(ctx, call.symbol, figi)
+	if err != nil {
+		return decimal.Zero, err
+	}
+
+	if call.function == "sma" {
+
+		if len(candles) < call.days {
+			return decimal.Zero, errors.New(fmt.Sprintf("Not enough candles of %s for %s", call.symbol, call.key()))
+		}
+
+		sum := decimal.Zero
+		for _, candle := range candles[len(candles)-call.days:] {
+			sum = sum.Add(money(candle.ClosePrice))
+		}
+		return sum.Div(decimal.NewFromInt(int64(call.days))), nil
+	}
+
+	// change_pct, from the close of the last candle started before the period
+	before := closeBefore(candles, d.now.AddDate(-call.years, -call.months, -7*call.weeks-call.days))
+	if before == 0 {
+		return decimal.Zero, errors.New(fmt.Sprintf("No close of %s before the period of %s", call.symbol, call.key()))
+	}
+
+	return money(price).Div(money(before)).Sub(decimal.NewFromInt(1)).Mul(decimal.NewFromInt(100)), nil
+}
+
+func (d *alertData) figi(ctx context.Context, ticker string) (string, error) {
+
+	if figi, ok := d.figis[ticker]; ok {
+		return figi, nil
+	}
+
+	instrument, err := d.acc.GetByTicker(ctx, ticker)
+	if err != nil {
+		return "", err
+	}
+
+	d.figis[ticker] = instrument.FIGI
+	return instrument.FIGI, nil
+}
+
+func (d *alertData) candlesOf(ctx context.Context, ticker, figi string) ([]sdk.Candle, error) {
+
+	if candles, ok := d.candles[ticker]; ok {
+		return candles, nil
+	}
+
+	candles, err := d.acc.dailyCandles(ctx, figi, d.since[ticker], d.now)
+	if err != nil {
+		return nil, err
+	}
+
+	d.candles[ticker] = candles
+	return candles, nil
+}
+
+func (d *alertData) rate(ctx context.Context, currency string) (decimal.Decimal, error) {
+
+	if d.instruments == nil {
+		instruments, err := d.acc.GetInstruments(ctx, &TcfInstrumentsRequest{Type: sdk.InstrumentTypeCurrency})
+		if err != nil {
+			return decimal.Zero, err
+		}
+		d.instruments = instruments
+	}
+
+	figi := currencyFIGI(d.instruments, TcfCurrency(currency))
+	if figi == "" {
+		return decimal.Zero, errors.New(fmt.Sprintf("Exchange instrument of %s not found", currency))
+	}
+
+	rate, err := d.acc.GetCurrentPrice(ctx, figi)
+	if err != nil {
+		return decimal.Zero, err
+	}
+
+	return money(rate), nil
+}
+
+// PrintAlerts prints the triggered alerts
+func PrintAlerts(w io.Writer, alerts []*TcfAlert) {
+
+	sort.SliceStable(alerts, func(i, j int) bool {
+		return alerts[i].Name < alerts[j].Name
+	})
+
+	RenderTable(w, alerts)
+}
@@ -0,0 +1,169 @@
+package tinkoff
+
+import (
+	"context"
+	"math"
+	"sort"
+	"time"
+
+	sdk "github.com/TinkoffCreditSystems/invest-openapi-go-sdk"
+	"github.com/mikhailbolshakov/tinkoff/utils"
+)
+
+type TcfAttributionRequest struct {
+	AccountID  string
+	PeriodFrom time.Time
+	PeriodTo   time.Time
+}
+
+// TcfAttributionItem is the contribution of one position to the return of the portfolio in its currency
+type TcfAttributionItem struct {
+	FIGI     string
+	Ticker   string
+	Currency TcfCurrency
+	// GainAmount is the change of the value plus the cash received (sells, income) minus the cash invested
+	GainAmount float64
+	// Weight is the share of the capital of the position (value at the start plus the purchases) in the currency
+	Weight float64
+	// Return and Contribution are in percents, the contributions of a currency sum up to its total return
+	Return       float64
+	Contribution float64
+}
+
+// TcfAttribution decomposes the return of the portfolio over the period by position
+type TcfAttribution struct {
+	PeriodFrom time.Time
+	PeriodTo   time.Time
+	Items      []*TcfAttributionItem
+	// Returns is the total return of the positions by currency, in percents
+	Returns map[TcfCurrency]float64
+}
+
+// GetAttribution returns the contributions (weight × return) of the positions to the portfolio return, sorted by contribution
+func (acc *TcfAccount) GetAttribution(ctx context.Context, request *TcfAttributionRequest) (*TcfAttribution, error) {
+
+	operations, err := acc.GetOperations(ctx, &TcfGetOperationsRequest{
+		AccountID:  request.AccountID,
+		PeriodFrom: time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC),
+		PeriodTo:   request.PeriodTo,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	type position struct {
+		item    *TcfAttributionItem
+		capital float64
+	}
+
+	positions := []*position{}
+	capital := make(map[TcfCurrency]float64)
+	gain := make(map[TcfCurrency]float64)
+
+	for figi, figiOperations := range utils.ByFigi(operations) {
+
+		before := utils.Filter(figiOperations, func(oper sdk.Operation) bool { return !oper.DateTime.After(request.PeriodFrom) })
+		during := utils.Filter(figiOperations, func(oper sdk.Operation) bool { return oper.DateTime.After(request.PeriodFrom) })
+
+		startQuantity := lotsQuantity(openLots(before))
+		endQuantity := lotsQuantity(openLots(figiOperations))
+
+		if startQuantity == 0 && len(during) == 0 {
+			continue
+		}
+
+		startValue, endValue := 0.0, 0.0
+		if startQuantity > 0 {
+			price, err := acc.priceAt(ctx, figi, request.PeriodFrom)
+			if err != nil {
+				return nil, err
+			}
+			startValue = price * float64(startQuantity)
+		}
+		if endQuantity > 0 {
+			price, err := acc.priceAt(ctx, figi, request.PeriodTo)
+			if err != nil {
+				return nil, err
+			}
+			endValue = price * float64(endQuantity)
+		}
+
+		cash, invested := 0.0, 0.0
+		for _, oper := range during {
+			// the commissions are taken from the trades, as in the balance
+			if utils.Category(oper.OperationType) == utils.CategoryCommission {
+				continue
+			}
+			cash += oper.Payment - math.Abs(oper.Commission.Value)
+			if oper.OperationType == sdk.BUY || oper.OperationType == sdk.BuyCard {
+				invested += math.Abs(oper.Payment) + math.Abs(oper.Commission.Value)
+			}
+		}
+
+		instrument, err := acc.GetByFigi(ctx, figi)
+		if err != nil {
+			return nil, err
+		}
+
+		p := &position{
+			item: &TcfAttributionItem{
+				FIGI:       figi,
+				Ticker:     instrument.Ticker,
+				Currency:   TcfCurrency(instrument.Currency),
+				GainAmount: endValue - startValue + cash,
+			},
+			capital: startValue + invested,
+		}
+
+		positions = append(positions, p)
+		capital[p.item.Currency] += p.capital
+		gain[p.item.Currency] += p.item.GainAmount
+	}
+
+	attribution := &TcfAttribution{
+		PeriodFrom: request.PeriodFrom,
+		PeriodTo:   request.PeriodTo,
+		Items:      []*TcfAttributionItem{},
+		Returns:    make(map[TcfCurrency]float64),
+	}
+
+	for _, p := range positions {
+
+		total := capital[p.item.Currency]
+		if total > 0 {
+			p.item.Weight = math.Round(10000*p.capital/total) / 10000
+			p.item.Contribution = math.Round(10000*p.item.GainAmount/total) / 100
+		}
+		if p.capital > 0 {
+			p.item.Return = math.Round(10000*p.item.GainAmount/p.capital) / 100
+		}
+		p.item.GainAmount = math.Round(100*p.item.GainAmount) / 100
+
+		attribution.Items = append(attribution.Items, p.item)
+	}
+
+	for currency, total := range capital {
+		if total > 0 {
+			attribution.Returns[currency] = math.Round(10000*gain[currency]/total) / 100
+		}
+	}
+
+	sort.SliceStable(attribution.Items, func(i, j int) bool {
+		if attribution.Items[i].Contribution != attribution.Items[j].Contribution {
+			return attribution.Items[i].Contribution > attribution.Items[j].Contribution
+		}
+		return attribution.Items[i].FIGI < attribution.Items[j].FIGI
+	})
+
+	return attribution, nil
+}
+
+func lotsQuantity(lots []*TcfLot) int {
+
+	quantity := 0
+	for _, lot := range lots {
+		quantity += lot.Quantity
+	}
+
+	return quantity
+}
@@ -0,0 +1,252 @@
+package tinkoff
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	sdk "github.com/TinkoffCreditSystems/invest-openapi-go-sdk"
+)
+
+// exchangeLocation is the Moscow Exchange time, there is no daylight saving time since 2014
+var exchangeLocation = time.FixedZone("MSK", 3*60*60)
+
+// barDurations are the intervals the bar events are supported for
+var barDurations = map[sdk.CandleInterval]time.Duration{
+	"1min":  time.Minute,
+	"2min":  2 * time.Minute,
+	"3min":  3 * time.Minute,
+	"5min":  5 * time.Minute,
+	"10min": 10 * time.Minute,
+	"15min": 15 * time.Minute,
+	"30min": 30 * time.Minute,
+	"hour":  time.Hour,
+	"day":   24 * time.Hour,
+}
+
+type TcfBarSubscription struct {
+	FIGI     string
+	Interval sdk.CandleInterval
+}
+
+// TcfBarClosed is the completed candle of the subscription
+type TcfBarClosed struct {
+	FIGI     string
+	Interval sdk.CandleInterval
+	Candle   sdk.Candle
+}
+
+// TcfBarEvents emits the events of the closed bars, so the strategies act on the completed candles.
+// By default the candles are polled right after the bar ends, the bars are aligned to the exchange time.
+// With Streaming the candle stream is used, a bar is closed when the first trade of the next one comes
+type TcfBarEvents struct {
+	Account       *TcfAccount
+	Subscriptions []TcfBarSubscription
+	Streaming     bool
+	// Delay is the pause after the end of the bar before it is polled, the exchange publishes the candle with a lag.
+	// It is also the pause before reconnecting the stream. 5 seconds by default
+	Delay  time.Duration
+	Logger sdk.Logger
+}
+
+// Run calls the handler for every closed bar until the context is cancelled or the handler fails,
+// the handler's error is returned. Only the bars closed after the start are emitted
+func (b *TcfBarEvents) Run(ctx context.Context, handler func(event *TcfBarClosed) error) error {
+
+	for _, s := range b.Subscriptions {
+		if _, ok := barDurations[s.Interval]; !ok {
+			return errors.New(fmt.Sprintf("Bar events are not supported for interval %s", s.Interval))
+		}
+	}
+
+	if b.Logger == nil {
+		b.Logger = log.New(os.Stdout, "[bars] ", log.LstdFlags)
+	}
+	if b.Delay == 0 {
+		b.Delay = 5 * time.Second
+	}
+
+	if b.Streaming {
+		return b.stream(ctx, handler)
+	}
+
+	return b.poll(ctx, handler)
+}
+
+func (b *TcfBarEvents) poll(ctx context.Context, handler func(event *TcfBarClosed) error) error {
+
+	// the start of the last emitted (or skipped) bar of the subscription
+	last := make(map[TcfBarSubscription]time.Time)
+	for _, s := range b.Subscriptions {
+		last[s] = barStep(barStart(time.Now(), s.Interval), s.Interval, -1)
+	}
+
+	for {
+
+		now := time.Now()
+		var wake time.Time
+		for _, s := range b.Subscriptions {
+			end := barStep(barStart(now, s.Interval), s.Interval, 1).Add(b.Delay)
+			if wake.IsZero() || end.Before(wake) {
+				wake = end
+			}
+		}
+		if wake.IsZero() {
+			<-ctx.Done()
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(time.Until(wake)):
+		}
+
+		for _, s := range b.Subscriptions {
+
+			end := barStart(time.Now().Add(-b.Delay), s.Interval)
+			start := barStep(end, s.Interval, -1)
+			if !start.After(last[s]) {
+				continue
+			}
+			last[s] = start
+
+			var candles []sdk.Candle
+			err := b.Account.call(ctx, 10*time.Second, func(ctx context.Context) (err error) {
+				candles, err = b.Account.Client.Candles(ctx, start, end, s.Interval, s.FIGI)
+				return err
+			})
+			if ctx.Err() != nil {
+				return nil
+			}
+			if err != nil {
+				b.Logger.Printf("candles of %s %s failed: %v", s.FIGI, s.Interval, err)
+				continue
+			}
+
+			// no candle if there were no trades, the daily candles start with the session rather than at midnight
+			for _, candle := range candles {
+				if !candle.TS.Before(start) && candle.TS.Before(end) {
+					if err := handler(&TcfBarClosed{FIGI: s.FIGI, Interval: s.Interval, Candle: candle}); err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+}
+
+func (b *TcfBarEvents) stream(ctx context.Context, handler func(event *TcfBarClosed) error) error {
+
+	for {
+
+		err := b.streamOnce(ctx, handler)
+		if ctx.Err() != nil {
+			return nil
+		}
+		var handlerErr *barHandlerError
+		if errors.As(err, &handlerErr) {
+			return handlerErr.err
+		}
+
+		b.Logger.Printf("stream failed: %v, reconnecting in %v", err, b.Delay)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(b.Delay):
+		}
+	}
+}
+
+// barHandlerError stops the stream reconnects
+type barHandlerError struct {
+	err error
+}
+
+func (e *barHandlerError) Error() string {
+	return e.err.Error()
+}
+
+func (b *TcfBarEvents) streamOnce(ctx context.Context, handler func(event *TcfBarClosed) error) error {
+
+	client, err := sdk.NewStreamingClient(b.Logger, b.Account.Token)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			client.Close()
+		case <-done:
+		}
+	}()
+
+	for _, s := range b.Subscriptions {
+		if err := client.SubscribeCandle(s.FIGI, s.Interval, requestID()); err != nil {
+			return err
+		}
+	}
+
+	forming := make(map[TcfBarSubscription]sdk.Candle)
+
+	return client.RunReadLoop(func(event interface{}) error {
+
+		candleEvent, ok := event.(sdk.CandleEvent)
+		if !ok {
+			return nil
+		}
+
+		candle := sdk.Candle{
+			FIGI:       candleEvent.Candle.FIGI,
+			Interval:   candleEvent.Candle.Interval,
+			OpenPrice:  candleEvent.Candle.OpenPrice,
+			ClosePrice: candleEvent.Candle.ClosePrice,
+			HighPrice:  candleEvent.Candle.HighPrice,
+			LowPrice:   candleEvent.Candle.LowPrice,
+			Volume:     candleEvent.Candle.Volume,
+			TS:         candleEvent.Candle.TS,
+		}
+		s := TcfBarSubscription{FIGI: candle.FIGI, Interval: candle.Interval}
+
+		if prev, ok := forming[s]; ok && prev.TS.Before(candle.TS) {
+			if err := handler(&TcfBarClosed{FIGI: s.FIGI, Interval: s.Interval, Candle: prev}); err != nil {
+				return &barHandlerError{err: err}
+			}
+		}
+
+		forming[s] = candle
+
+		return nil
+	})
+}
+
+// barStart returns the start of the bar the time belongs to in the exchange time
+func barStart(t time.Time, interval sdk.CandleInterval) time.Time {
+
+	if interval == "day" {
+		y, m, d := t.In(exchangeLocation).Date()
+		return time.Date(y, m, d, 0, 0, 0, 0, exchangeLocation)
+	}
+
+	// the exchange time offset is whole hours, so the intraday bars are aligned in UTC as well
+	return t.Truncate(barDurations[interval]).In(exchangeLocation)
+}
+
+// barStep moves the bar start by n bars
+func barStep(start time.Time, interval sdk.CandleInterval, n int) time.Time {
+
+	if interval == "day" {
+		return start.AddDate(0, 0, n)
+	}
+
+	return start.Add(time.Duration(n) * barDurations[interval])
+}
@@ -0,0 +1,165 @@
+package tinkoff
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	sdk "github.com/TinkoffCreditSystems/invest-openapi-go-sdk"
+)
+
+type TcfBenchmarkRequest struct {
+	AccountID  string
+	PeriodFrom time.Time
+	PeriodTo   time.Time
+	// FIGI is the benchmark instrument (e.g. an index ETF), the portfolio positions of its currency are compared
+	FIGI string
+}
+
+// TcfBenchmarkPoint is the cumulative return since the period start, in percents
+type TcfBenchmarkPoint struct {
+	Time      time.Time
+	Portfolio float64
+	Benchmark float64
+}
+
+type TcfBenchmarkComparison struct {
+	FIGI     string
+	Ticker   string
+	Currency TcfCurrency
+	// PortfolioReturn is the time-weighted return of the positions, the deposits and the withdrawals don't affect it.
+	// The returns are in percents over the period
+	PortfolioReturn float64
+	BenchmarkReturn float64
+	// TrackingDifference is the portfolio return minus the benchmark return
+	TrackingDifference float64
+	// TrackingError is the annualized standard deviation of the daily return differences, in percents
+	TrackingError float64
+	Points        []*TcfBenchmarkPoint
+}
+
+// CompareToBenchmark compares the time-weighted return of the positions in the benchmark's currency
+// with the return of the benchmark over the period
+func (acc *TcfAccount) CompareToBenchmark(ctx context.Context, request *TcfBenchmarkRequest) (*TcfBenchmarkComparison, error) {
+
+	instrument, err := acc.GetByFigi(ctx, request.FIGI)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &TcfBenchmarkComparison{FIGI: instrument.FIGI, Ticker: instrument.Ticker, Currency: TcfCurrency(instrument.Currency), Points: []*TcfBenchmarkPoint{}}
+
+	portfolio, benchmark, times, err := acc.benchmarkReturns(ctx, request, res.Currency)
+	if err != nil {
+		return nil, err
+	}
+	if portfolio == nil {
+		return nil, errors.New(fmt.Sprintf("No positions in %s during the period", res.Currency))
+	}
+
+	portfolioCumulative, benchmarkCumulative := 1.0, 1.0
+	res.Points = append(res.Points, &TcfBenchmarkPoint{Time: times[0]})
+	for i := range portfolio {
+		portfolioCumulative *= 1 + portfolio[i]
+		benchmarkCumulative *= 1 + benchmark[i]
+		res.Points = append(res.Points, &TcfBenchmarkPoint{
+			Time:      times[i+1],
+			Portfolio: math.Round(10000*(portfolioCumulative-1)) / 100,
+			Benchmark: math.Round(10000*(benchmarkCumulative-1)) / 100,
+		})
+	}
+
+	res.PortfolioReturn = math.Round(10000*(portfolioCumulative-1)) / 100
+	res.BenchmarkReturn = math.Round(10000*(benchmarkCumulative-1)) / 100
+	res.TrackingDifference = math.Round(100*(res.PortfolioReturn-res.BenchmarkReturn)) / 100
+
+	if len(portfolio) > 1 {
+		differences := make([]float64, len(portfolio))
+		for i := range portfolio {
+			differences[i] = portfolio[i] - benchmark[i]
+		}
+		res.TrackingError = math.Round(10000*stdDev(differences)*math.Sqrt(365)) / 100
+	}
+
+	return res, nil
+}
+
+// benchmarkReturns returns the daily time-weighted returns of the positions in the currency and the daily returns
+// of the benchmark aligned by the day, the times are the ends of the days including the period start.
+// Nil slices are returned if there were no positions in the currency
+func (acc *TcfAccount) benchmarkReturns(ctx context.Context, request *TcfBenchmarkRequest, currency TcfCurrency) ([]float64, []float64, []time.Time, error) {
+
+	portfolio, times, err := acc.portfolioReturns(ctx, request.AccountID, request.PeriodFrom, request.PeriodTo, currency)
+	if err != nil || portfolio == nil {
+		return nil, nil, nil, err
+	}
+
+	candles, err := acc.dailyCandles(ctx, request.FIGI, request.PeriodFrom.AddDate(0, 0, -7), request.PeriodTo)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	return portfolio, candleReturns(candles, times), times, nil
+}
+
+// portfolioReturns returns the daily time-weighted returns of the positions in the currency,
+// the times are the ends of the days including the period start. Nil slices are returned if there were no positions
+func (acc *TcfAccount) portfolioReturns(ctx context.Context, accountID string, from, to time.Time, currency TcfCurrency) ([]float64, []time.Time, error) {
+
+	series, err := acc.GetBalanceTimeSeries(ctx, &TcfBalanceTimeSeriesRequest{
+		AccountID:  accountID,
+		PeriodFrom: from,
+		PeriodTo:   to,
+		Bucket:     BucketDay,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, s := range series {
+		if s.Currency == currency && len(s.Points) >= 2 {
+			returns, times := s.Returns()
+			return returns, append([]time.Time{s.Points[0].Time}, times...), nil
+		}
+	}
+
+	return nil, nil, nil
+}
+
+// candleReturns returns the returns of the close price between the consecutive times
+func candleReturns(candles []sdk.Candle, times []time.Time) []float64 {
+
+	returns := []float64{}
+	for i := 1; i < len(times); i++ {
+		r := 0.0
+		if prev := closeBefore(candles, times[i-1]); prev > 0 {
+			r = closeBefore(candles, times[i])/prev - 1
+		}
+		returns = append(returns, r)
+	}
+
+	return returns
+}
+
+// stdDev returns the sample standard deviation
+func stdDev(values []float64) float64 {
+
+	if len(values) < 2 {
+		return 0.0
+	}
+
+	mean := 0.0
+	for _, v := range values {
+		mean += v
+	}
+	mean /= float64(len(values))
+
+	variance := 0.0
+	for _, v := range values {
+		variance += (v - mean) * (v - mean)
+	}
+
+	return math.Sqrt(variance / float64(len(values)-1))
+}
@@ -0,0 +1,175 @@
+package tinkoff
+
+import (
+	"context"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mikhailbolshakov/tinkoff/utils"
+)
+
+// TcfBeta is the sensitivity of the daily returns to the benchmark returns
+type TcfBeta struct {
+	FIGI        string
+	Beta        float64
+	Correlation float64
+	// Days is the number of the trading days the metrics are calculated on
+	Days int
+}
+
+type TcfBetaReport struct {
+	Benchmark string
+	Currency  TcfCurrency
+	// Portfolio is the beta of the time-weighted returns of the positions in the benchmark's currency,
+	// nil if there were no such positions
+	Portfolio *TcfBeta
+	// Positions are the betas of the positions open at the period end
+	Positions []*TcfBeta
+}
+
+// GetBeta calculates the beta and the correlation of the open positions and the portfolio against the benchmark
+// from the daily candle returns. The days the benchmark price has not changed (weekends, holidays) are skipped
+func (acc *TcfAccount) GetBeta(ctx context.Context, request *TcfBenchmarkRequest) (*TcfBetaReport, error) {
+
+	instrument, err := acc.GetByFigi(ctx, request.FIGI)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &TcfBetaReport{Benchmark: request.FIGI, Currency: TcfCurrency(instrument.Currency), Positions: []*TcfBeta{}}
+
+	portfolio, benchmark, _, err := acc.benchmarkReturns(ctx, request, res.Currency)
+	if err != nil {
+		return nil, err
+	}
+	if portfolio != nil {
+		res.Portfolio = beta("", portfolio, benchmark)
+	}
+
+	operations, err := acc.GetOperations(ctx, &TcfGetOperationsRequest{
+		AccountID:  request.AccountID,
+		PeriodFrom: time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC),
+		PeriodTo:   request.PeriodTo,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	figis := []string{}
+	for figi, figiOperations := range utils.ByFigi(operations) {
+		if figi != request.FIGI && lotsQuantity(openLots(figiOperations)) > 0 {
+			figis = append(figis, figi)
+		}
+	}
+
+	from := request.PeriodFrom.AddDate(0, 0, -7)
+
+	benchmarkCandles, err := acc.dailyCandles(ctx, request.FIGI, from, request.PeriodTo)
+	if err != nil {
+		return nil, err
+	}
+
+	times := []time.Time{request.PeriodFrom}
+	for t := BucketDay.next(request.PeriodFrom); t.Before(request.PeriodTo); t = BucketDay.next(t) {
+		times = append(times, t)
+	}
+	times = append(times, request.PeriodTo)
+
+	group, groupCtx := acc.newGroup(ctx)
+	var mu sync.Mutex
+
+	for _, figi := range figis {
+		figi := figi
+		group.Go(func() error {
+
+			candles, err := acc.dailyCandles(groupCtx, figi, from, request.PeriodTo)
+			if err != nil {
+				return err
+			}
+
+			position, benchmark := []float64{}, []float64{}
+			for i := 1; i < len(times); i++ {
+				p0, p1 := closeBefore(candles, times[i-1]), closeBefore(candles, times[i])
+				b0, b1 := closeBefore(benchmarkCandles, times[i-1]), closeBefore(benchmarkCandles, times[i])
+				if p0 > 0 && b0 > 0 {
+					position = append(position, p1/p0-1)
+					benchmark = append(benchmark, b1/b0-1)
+				}
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			res.Positions = append(res.Positions, beta(figi, position, benchmark))
+			return nil
+		})
+	}
+
+	if err := group.Wait(); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(res.Positions, func(i, j int) bool {
+		return res.Positions[i].FIGI < res.Positions[j].FIGI
+	})
+
+	return res, nil
+}
+
+// ApplyBeta sets the beta and the correlation of the balance items for the report columns
+func (b *TcfPortfolioBalance) ApplyBeta(report *TcfBetaReport) {
+
+	byFigi := make(map[string]*TcfBeta)
+	for _, position := range report.Positions {
+		byFigi[position.FIGI] = position
+	}
+
+	for _, item := range b.Items {
+		if position, ok := byFigi[item.FIGI]; ok {
+			item.Beta = position.Beta
+			item.Correlation = position.Correlation
+		}
+	}
+}
+
+func beta(figi string, returns, benchmark []float64) *TcfBeta {
+
+	x, y := []float64{}, []float64{}
+	for i := range benchmark {
+		if benchmark[i] != 0 {
+			x = append(x, returns[i])
+			y = append(y, benchmark[i])
+		}
+	}
+
+	res := &TcfBeta{FIGI: figi, Days: len(x)}
+	if len(x) < 2 {
+		return res
+	}
+
+	meanX, meanY := 0.0, 0.0
+	for i := range x {
+		meanX += x[i]
+		meanY += y[i]
+	}
+	meanX /= float64(len(x))
+	meanY /= float64(len(y))
+
+	covariance, varianceX, varianceY := 0.0, 0.0, 0.0
+	for i := range x {
+		covariance += (x[i] - meanX) * (y[i] - meanY)
+		varianceX += (x[i] - meanX) * (x[i] - meanX)
+		varianceY += (y[i] - meanY) * (y[i] - meanY)
+	}
+
+	if varianceY > 0 {
+		res.Beta = math.Round(100*covariance/varianceY) / 100
+	}
+	if varianceX > 0 && varianceY > 0 {
+		res.Correlation = math.Round(100*covariance/math.Sqrt(varianceX*varianceY)) / 100
+	}
+
+	return res
+}
@@ -0,0 +1,278 @@
+package tinkoff
+
+import (
+	"context"
+	"math"
+	"sort"
+	"time"
+
+	sdk "github.com/TinkoffCreditSystems/invest-openapi-go-sdk"
+	"github.com/shopspring/decimal"
+)
+
+type TcfCoupon struct {
+	Date time.Time
+	// Amount is the coupon paid per one bond
+	Amount float64
+}
+
+// TcfBondTerms are the bond parameters the API doesn't provide
+type TcfBondTerms struct {
+	FIGI         string
+	FaceValue    float64
+	MaturityDate time.Time
+	Coupons      []TcfCoupon
+}
+
+// TcfBondTermsProvider is a source of the bond coupon schedules and maturities (e.g. MOEX ISS)
+type TcfBondTermsProvider interface {
+	BondTerms(ctx context.Context, figi string) (*TcfBondTerms, error)
+}
+
+// WithBondTerms makes the balance value the held bonds with the coupon interest accrued by now (НКД)
+// by the coupon schedules of the provider
+func WithBondTerms(provider TcfBondTermsProvider) TcfOption {
+	return func(acc *TcfAccount) {
+		acc.bondTerms = provider
+	}
+}
+
+type TcfCashFlowKind string
+
+const (
+	CashFlowCoupon   TcfCashFlowKind = "Coupon"
+	CashFlowMaturity TcfCashFlowKind = "Maturity"
+)
+
+type TcfCashFlowEvent struct {
+	FIGI        string
+	Ticker      string
+	Date        time.Time
+	Kind        TcfCashFlowKind
+	Currency    TcfCurrency
+	GrossAmount decimal.Decimal
+	TaxAmount   decimal.Decimal
+	NetAmount   decimal.Decimal
+}
+
+type TcfBondCashFlowRequest struct {
+	AccountID string
+	// Until limits the calendar, zero means up to the latest maturity
+	Until time.Time
+}
+
+// GetBondCashFlows returns the forward calendar of the coupons and maturities of the held bonds, net of tax
+func (acc *TcfAccount) GetBondCashFlows(ctx context.Context, provider TcfBondTermsProvider, request *TcfBondCashFlowRequest) ([]*TcfCashFlowEvent, error) {
+
+	var portfolio sdk.Portfolio
+	err := acc.call(ctx, 20*time.Second, func(ctx context.Context) (err error) {
+		portfolio, err = acc.Client.Portfolio(ctx, acc.accountID(request.AccountID))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	events := []*TcfCashFlowEvent{}
+
+	for _, position := range portfolio.Positions {
+
+		if position.InstrumentType != sdk.InstrumentTypeBond || position.Balance <= 0 {
+			continue
+		}
+
+		terms, err := provider.BondTerms(ctx, position.FIGI)
+		if err != nil {
+			return nil, err
+		}
+
+		instrument, err := acc.GetByFigi(ctx, position.FIGI)
+		if err != nil {
+			return nil, err
+		}
+
+		inPeriod := func(date time.Time) bool {
+			return date.After(now) && (request.Until.IsZero() || !date.After(request.Until))
+		}
+
+		for _, coupon := range terms.Coupons {
+
+			if !inPeriod(coupon.Date) {
+				continue
+			}
+
+			gross := money(coupon.Amount).Mul(decimal.NewFromFloat(position.Balance))
+			tax := gross.Mul(decimal.NewFromFloat(ruTaxRate)).Round(2)
+
+			events = append(events, &TcfCashFlowEvent{
+				FIGI:        position.FIGI,
+				Ticker:      position.Ticker,
+				Date:        coupon.Date,
+				Kind:        CashFlowCoupon,
+				Currency:    TcfCurrency(instrument.Currency),
+				GrossAmount: gross,
+				TaxAmount:   tax,
+				NetAmount:   gross.Sub(tax),
+			})
+		}
+
+		if !terms.MaturityDate.IsZero() && inPeriod(terms.MaturityDate) {
+
+			// the face value repayment is a return of the principal, it isn't taxed
+			amount := money(terms.FaceValue).Mul(decimal.NewFromFloat(position.Balance))
+
+			events = append(events, &TcfCashFlowEvent{
+				FIGI:        position.FIGI,
+				Ticker:      position.Ticker,
+				Date:        terms.MaturityDate,
+				Kind:        CashFlowMaturity,
+				Currency:    TcfCurrency(instrument.Currency),
+				GrossAmount: amount,
+				NetAmount:   amount,
+			})
+		}
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Date.Before(events[j].Date)
+	})
+
+	return events, nil
+}
+
+// bondPrice converts the market quote to the price of one bond, bonds are quoted in percents of the face value
+func bondPrice(quote float64, terms *TcfBondTerms) float64 {
+	return quote * terms.FaceValue / 100
+}
+
+// bondCashFlows returns the remaining payments of one bond and the years left to each of them
+func bondCashFlows(terms *TcfBondTerms, now time.Time) ([]float64, []float64) {
+
+	amounts, years := []float64{}, []float64{}
+
+	yearsTo := func(date time.Time) float64 {
+		return date.Sub(now).Hours() / 24 / 365
+	}
+
+	for _, coupon := range terms.Coupons {
+		if coupon.Date.After(now) && (terms.MaturityDate.IsZero() || !coupon.Date.After(terms.MaturityDate)) {
+			amounts = append(amounts, coupon.Amount)
+			years = append(years, yearsTo(coupon.Date))
+		}
+	}
+
+	if terms.MaturityDate.After(now) {
+		amounts = append(amounts, terms.FaceValue)
+		years = append(years, yearsTo(terms.MaturityDate))
+	}
+
+	return amounts, years
+}
+
+// bondYTM returns the annual effective yield to maturity of the bond bought at the price,
+// the yield is found by bisection of the present value of the remaining cash flows
+func bondYTM(price float64, terms *TcfBondTerms, now time.Time) (float64, bool) {
+
+	amounts, years := bondCashFlows(terms, now)
+	if len(amounts) == 0 || price <= 0 {
+		return 0.0, false
+	}
+
+	presentValue := func(y float64) float64 {
+		pv := 0.0
+		for i := range amounts {
+			pv += amounts[i] / math.Pow(1+y, years[i])
+		}
+		return pv
+	}
+
+	// the present value decreases with the yield
+	low, high := -0.99, 10.0
+	if presentValue(low) < price || presentValue(high) > price {
+		return 0.0, false
+	}
+
+	for i := 0; i < 200 && high-low > 1e-10; i++ {
+		mid := (low + high) / 2
+		if presentValue(mid) > price {
+			low = mid
+		} else {
+			high = mid
+		}
+	}
+
+	return (low + high) / 2, true
+}
+
+// bondAccruedInterest returns the coupon interest accrued on one bond by the time, the interest accrues evenly
+// over the coupon period. The first known period is assumed as long as the next one, zero after the maturity
+func bondAccruedInterest(terms *TcfBondTerms, now time.Time) float64 {
+
+	if !terms.MaturityDate.IsZero() && !now.Before(terms.MaturityDate) {
+		return 0.0
+	}
+
+	coupons := append([]TcfCoupon{}, terms.Coupons...)
+	sort.SliceStable(coupons, func(i, j int) bool {
+		return coupons[i].Date.Before(coupons[j].Date)
+	})
+
+	for i, coupon := range coupons {
+
+		if !coupon.Date.After(now) {
+			continue
+		}
+
+		var start time.Time
+		switch {
+		case i > 0:
+			start = coupons[i-1].Date
+		case i+1 < len(coupons):
+			start = coupon.Date.Add(-coupons[i+1].Date.Sub(coupon.Date))
+		default:
+			return 0.0
+		}
+
+		if now.Before(start) {
+			return 0.0
+		}
+
+		return coupon.Amount * now.Sub(start).Hours() / coupon.Date.Sub(start).Hours()
+	}
+
+	return 0.0
+}
+
+// bondModifiedDuration returns the modified duration of the bond bought at the price in years,
+// the Macaulay duration at the yield to maturity divided by one plus the yield
+func bondModifiedDuration(price float64, terms *TcfBondTerms, now time.Time) (float64, bool) {
+
+	ytm, ok := bondYTM(price, terms, now)
+	if !ok {
+		return 0.0, false
+	}
+
+	amounts, years := bondCashFlows(terms, now)
+
+	pv, weighted := 0.0, 0.0
+	for i := range amounts {
+		discounted := amounts[i] / math.Pow(1+ytm, years[i])
+		pv += discounted
+		weighted += years[i] * discounted
+	}
+
+	return weighted / pv / (1 + ytm), true
+}
+
+// tradeAccruedInterest returns the accrued interest paid by the buyer of the bond to the seller,
+// the payment of a bond trade is the price plus the interest accrued by the trade date
+func tradeAccruedInterest(operation sdk.Operation) decimal.Decimal {
+
+	interest := moneyAbs(operation.Payment).Sub(moneyAbs(operation.Price).Mul(decimal.NewFromInt(int64(operation.Quantity)))).Round(2)
+	if !interest.IsPositive() {
+		return decimal.Zero
+	}
+
+	return interest
+}
@@ -0,0 +1,335 @@
+package tinkoff
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	sdk "github.com/TinkoffCreditSystems/invest-openapi-go-sdk"
+	"github.com/mikhailbolshakov/tinkoff/utils"
+	"github.com/xuri/excelize/v2"
+)
+
+// TcfReportTrade is a trade from the broker report
+type TcfReportTrade struct {
+	TradeID   string
+	Date      time.Time
+	Operation sdk.OperationType // Buy or Sell
+	Ticker    string
+	Price     float64
+	Quantity  int
+	Amount    float64
+	Currency  TcfCurrency
+	// Commission is the broker commission of the trade
+	Commission float64
+}
+
+// TcfBrokerReportColumns are the headers of the trade table columns in the broker report.
+// The headers are compared with the whitespace and the line breaks collapsed
+type TcfBrokerReportColumns struct {
+	// Sheet is the sheet with the trades, the first one if empty
+	Sheet      string
+	TradeID    string
+	Date       string
+	Operation  string
+	Ticker     string
+	Price      string
+	Quantity   string
+	Amount     string
+	Currency   string
+	Commission string
+}
+
+// DefaultBrokerReportColumns returns the headers of the Tinkoff broker report
+func DefaultBrokerReportColumns() *TcfBrokerReportColumns {
+	return &TcfBrokerReportColumns{
+		TradeID:    "Номер сделки",
+		Date:       "Дата заключения",
+		Operation:  "Вид сделки",
+		Ticker:     "Код актива",
+		Price:      "Цена за единицу",
+		Quantity:   "Количество",
+		Amount:     "Сумма сделки",
+		Currency:   "Валюта расчетов",
+		Commission: "Комиссия брокера",
+	}
+}
+
+// ReadBrokerReportXLSX reads the trades of the broker report. Every table headed by the trade ID column is read
+// (the executed and the unexecuted trades sections, the header repeated on the page breaks), a trade listed
+// in several sections is returned once
+func ReadBrokerReportXLSX(r io.Reader, columns *TcfBrokerReportColumns) ([]*TcfReportTrade, error) {
+
+	if columns == nil {
+		columns = DefaultBrokerReportColumns()
+	}
+
+	f, err := excelize.OpenReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	sheet := columns.Sheet
+	if sheet == "" {
+		sheet = f.GetSheetName(0)
+	}
+
+	rows, err := f.GetRows(sheet)
+	if err != nil {
+		return nil, err
+	}
+
+	res := []*TcfReportTrade{}
+	seen := make(map[string]bool)
+	var header map[string]int
+
+	for i, row := range rows {
+
+		if h := reportHeader(row); h[columns.TradeID] {
+			header = make(map[string]int)
+			for col, cell := range row {
+				header[collapseSpaces(cell)] = col
+			}
+			continue
+		}
+
+		if header == nil {
+			continue
+		}
+
+		field := func(name string) string {
+			if col, ok := header[name]; ok && col < len(row) {
+				return strings.TrimSpace(row[col])
+			}
+			return ""
+		}
+
+		// the section titles and the totals have no trade ID
+		tradeID := field(columns.TradeID)
+		if tradeID == "" || seen[tradeID] {
+			continue
+		}
+
+		trade := &TcfReportTrade{TradeID: tradeID, Ticker: field(columns.Ticker), Currency: TcfCurrency(strings.ToUpper(field(columns.Currency)))}
+		if trade.Currency == "RUR" {
+			trade.Currency = CurrencyRUB
+		}
+
+		switch strings.ToLower(field(columns.Operation)) {
+		case "покупка", "buy":
+			trade.Operation = sdk.BUY
+		case "продажа", "sell":
+			trade.Operation = sdk.SELL
+		default:
+			return nil, errors.New(fmt.Sprintf("Row %d: unknown trade type %q", i+1, field(columns.Operation)))
+		}
+
+		if trade.Date, err = parseReportDate(field(columns.Date)); err != nil {
+			return nil, errors.New(fmt.Sprintf("Row %d: invalid date %q", i+1, field(columns.Date)))
+		}
+
+		numbers := []struct {
+			header string
+			target *float64
+		}{
+			{columns.Price, &trade.Price},
+			{columns.Amount, &trade.Amount},
+			{columns.Commission, &trade.Commission},
+		}
+		for _, n := range numbers {
+			if *n.target, err = parseReportNumber(field(n.header)); err != nil {
+				return nil, errors.New(fmt.Sprintf("Row %d: invalid %s %q", i+1, n.header, field(n.header)))
+			}
+		}
+
+		quantity, err := parseReportNumber(field(columns.Quantity))
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("Row %d: invalid quantity %q", i+1, field(columns.Quantity)))
+		}
+		trade.Quantity = int(math.Round(quantity))
+
+		seen[tradeID] = true
+		res = append(res, trade)
+	}
+
+	return res, nil
+}
+
+type TcfReconciliationKind string
+
+const (
+	ReconcileMissingInAPI    TcfReconciliationKind = "missing_in_api"
+	ReconcileMissingInReport TcfReconciliationKind = "missing_in_report"
+	ReconcileMismatch        TcfReconciliationKind = "mismatch"
+)
+
+// TcfReconciliationIssue is a trade the broker report and the API disagree on
+type TcfReconciliationIssue struct {
+	Kind    TcfReconciliationKind `report:"Issue"`
+	TradeID string                `report:"Trade"`
+	Time    time.Time             `report:"Date"`
+	FIGI    string                `report:"FIGI"`
+	Ticker  string                `report:"Ticker"`
+	Message string                `report:"Details"`
+}
+
+// ReconcileBrokerReport diffs the trades of the report with the trades of the API operations by the trade ID,
+// the payment and the commission of the operation are split between its trades by the quantity.
+// The operations are expected to cover the period of the report
+func ReconcileBrokerReport(operations []sdk.Operation, trades []*TcfReportTrade) []*TcfReconciliationIssue {
+
+	type apiTrade struct {
+		trade      sdk.Trade
+		operation  sdk.Operation
+		amount     float64
+		commission float64
+	}
+
+	api := make(map[string]apiTrade)
+	for _, oper := range operations {
+
+		if utils.Category(oper.OperationType) != utils.CategoryTrade || oper.Status == sdk.Declined {
+			continue
+		}
+
+		executed := 0
+		for _, trade := range oper.Trades {
+			executed += trade.Quantity
+		}
+
+		for _, trade := range oper.Trades {
+			a := apiTrade{trade: trade, operation: oper}
+			if executed > 0 {
+				share := float64(trade.Quantity) / float64(executed)
+				a.amount = math.Abs(oper.Payment) * share
+				a.commission = math.Abs(oper.Commission.Value) * share
+			}
+			api[trade.TradeID] = a
+		}
+	}
+
+	res := []*TcfReconciliationIssue{}
+	reported := make(map[string]bool)
+
+	for _, trade := range trades {
+
+		reported[trade.TradeID] = true
+		issue := &TcfReconciliationIssue{TradeID: trade.TradeID, Time: trade.Date, Ticker: trade.Ticker}
+
+		a, ok := api[trade.TradeID]
+		if !ok {
+			issue.Kind = ReconcileMissingInAPI
+			issue.Message = fmt.Sprintf("%s %d at %.4f %s", trade.Operation, trade.Quantity, trade.Price, trade.Currency)
+			res = append(res, issue)
+			continue
+		}
+
+		operation := a.operation.OperationType
+		if operation == sdk.BuyCard {
+			operation = sdk.BUY
+		}
+
+		differences := []string{}
+		if operation != trade.Operation {
+			differences = append(differences, fmt.Sprintf("type %s in report, %s in API", trade.Operation, operation))
+		}
+		if a.trade.Quantity != trade.Quantity {
+			differences = append(differences, fmt.Sprintf("quantity %d in report, %d in API", trade.Quantity, a.trade.Quantity))
+		}
+		if math.Round(10000*a.trade.Price) != math.Round(10000*trade.Price) {
+			differences = append(differences, fmt.Sprintf("price %.4f in report, %.4f in API", trade.Price, a.trade.Price))
+		}
+		// the pro-rated amounts may differ by a cent of the rounding
+		if math.Abs(a.amount-math.Abs(trade.Amount)) > 0.01+1e-9 {
+			differences = append(differences, fmt.Sprintf("amount %.2f in report, %.2f in API", math.Abs(trade.Amount), a.amount))
+		}
+		if math.Abs(a.commission-math.Abs(trade.Commission)) > 0.01+1e-9 {
+			differences = append(differences, fmt.Sprintf("commission %.2f in report, %.2f in API", math.Abs(trade.Commission), a.commission))
+		}
+		if trade.Currency != "" && TcfCurrency(a.operation.Currency) != trade.Currency {
+			differences = append(differences, fmt.Sprintf("currency %s in report, %s in API", trade.Currency, a.operation.Currency))
+		}
+
+		if len(differences) > 0 {
+			issue.Kind = ReconcileMismatch
+			issue.FIGI = a.operation.FIGI
+			issue.Message = strings.Join(differences, "; ")
+			res = append(res, issue)
+		}
+	}
+
+	for tradeID, a := range api {
+		if !reported[tradeID] {
+			res = append(res, &TcfReconciliationIssue{
+				Kind:    ReconcileMissingInReport,
+				TradeID: tradeID,
+				Time:    a.trade.DateTime,
+				FIGI:    a.operation.FIGI,
+				Message: fmt.Sprintf("%s %d at %.4f %s", a.operation.OperationType, a.trade.Quantity, a.trade.Price, a.operation.Currency),
+			})
+		}
+	}
+
+	sort.SliceStable(res, func(i, j int) bool {
+		if !res[i].Time.Equal(res[j].Time) {
+			return res[i].Time.Before(res[j].Time)
+		}
+		return res[i].TradeID < res[j].TradeID
+	})
+
+	return res
+}
+
+// PrintReconciliation prints the reconciliation issues
+func PrintReconciliation(w io.Writer, issues []*TcfReconciliationIssue) {
+	RenderTable(w, issues)
+}
+
+// reportHeader returns the set of the collapsed cells of the row
+func reportHeader(row []string) map[string]bool {
+
+	res := make(map[string]bool)
+	for _, cell := range row {
+		res[collapseSpaces(cell)] = true
+	}
+
+	return res
+}
+
+func collapseSpaces(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+func parseReportDate(s string) (time.Time, error) {
+
+	// the date cells are formatted by excelize as mm-dd-yy
+	for _, layout := range []string{"02.01.2006", "2006-01-02", "01-02-06"} {
+		if date, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return date, nil
+		}
+	}
+
+	return time.Time{}, errors.New(fmt.Sprintf("Invalid date %q", s))
+}
+
+// parseReportNumber parses the number formatted with the spaces and the decimal comma, empty is zero
+func parseReportNumber(s string) (float64, error) {
+
+	s = strings.Map(func(r rune) rune {
+		if r == ' ' || r == '\u00a0' {
+			return -1
+		}
+		return r
+	}, s)
+	if s == "" {
+		return 0, nil
+	}
+
+	return strconv.ParseFloat(strings.Replace(s, ",", ".", 1), 64)
+}
@@ -0,0 +1,215 @@
+package tinkoff
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+
+	sdk "github.com/TinkoffCreditSystems/invest-openapi-go-sdk"
+)
+
+// TcfCampaign is building (Buy) or unwinding (Sell) a large position by the equal slices placed at the interval.
+// The campaign is defined by the caller and may be stored as JSON, the progress is calculated from the operations
+type TcfCampaign struct {
+	AccountID string            `json:"accountId,omitempty"`
+	FIGI      string            `json:"figi"`
+	Operation sdk.OperationType `json:"operation"`
+	// Quantity is the total quantity in pieces, a multiple of the lot. The slices are rounded to the lot
+	Quantity int           `json:"quantity"`
+	Lot      int           `json:"lot,omitempty"`
+	Start    time.Time     `json:"start"`
+	Slices   int           `json:"slices"`
+	Interval time.Duration `json:"interval"`
+	// StartPrice is the reference of the adverse move, the average price of the executed trades if zero
+	StartPrice float64 `json:"startPrice,omitempty"`
+	// MaxAdverseMove pauses the campaign when the price moves against it by more percents from the reference,
+	// zero never pauses
+	MaxAdverseMove float64 `json:"maxAdverseMove,omitempty"`
+}
+
+// Validate checks the campaign is consistent
+func (c *TcfCampaign) Validate() error {
+
+	if c.Operation != sdk.BUY && c.Operation != sdk.SELL {
+		return errors.New(fmt.Sprintf("Invalid campaign operation %s", c.Operation))
+	}
+	if c.Quantity <= 0 {
+		return errors.New(fmt.Sprintf("Invalid quantity %d", c.Quantity))
+	}
+	if c.Lot > 1 && c.Quantity%c.Lot != 0 {
+		return errors.New(fmt.Sprintf("Quantity %d is not a multiple of the lot %d", c.Quantity, c.Lot))
+	}
+	if c.Slices <= 0 {
+		return errors.New(fmt.Sprintf("Invalid number of slices %d", c.Slices))
+	}
+	if c.Slices > 1 && c.Interval <= 0 {
+		return errors.New("Interval between slices is required")
+	}
+
+	return nil
+}
+
+// TcfCampaignSlice is an order planned by the campaign
+type TcfCampaignSlice struct {
+	Time     time.Time `report:"Time"`
+	Quantity int       `report:"Quantity"`
+}
+
+// Schedule splits the quantity into the slices, the lots left by the rounding go to the first slices
+func (c *TcfCampaign) Schedule() []*TcfCampaignSlice {
+
+	lot := c.Lot
+	if lot < 1 {
+		lot = 1
+	}
+
+	lots := c.Quantity / lot
+	res := []*TcfCampaignSlice{}
+
+	for i := 0; i < c.Slices; i++ {
+		n := lots / c.Slices
+		if i < lots%c.Slices {
+			n++
+		}
+		if n > 0 {
+			res = append(res, &TcfCampaignSlice{Time: c.Start.Add(time.Duration(i) * c.Interval), Quantity: n * lot})
+		}
+	}
+
+	return res
+}
+
+type TcfCampaignProgress struct {
+	Executed     int
+	AveragePrice float64
+	// Planned is the quantity of the slices due by now
+	Planned      int
+	Remaining    int
+	CurrentPrice float64
+	// AdverseMove is how far the price moved against the campaign from the reference, in percents
+	AdverseMove float64
+	Paused      bool
+	Completed   bool
+	// Next is the order to place now or later, the shortfall of the missed slices included.
+	// It is nil when the campaign is completed or paused
+	Next *TcfCampaignSlice
+}
+
+// GetCampaignProgress calculates the progress of the campaign by the trades of the instrument made since the start
+func (acc *TcfAccount) GetCampaignProgress(ctx context.Context, campaign *TcfCampaign) (*TcfCampaignProgress, error) {
+
+	if err := campaign.Validate(); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	operations, err := acc.GetOperations(ctx, &TcfGetOperationsRequest{
+		AccountID:  campaign.AccountID,
+		PeriodFrom: campaign.Start,
+		PeriodTo:   now,
+		Figi:       campaign.FIGI,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	price, err := acc.GetCurrentPrice(ctx, campaign.FIGI)
+	if err != nil {
+		return nil, err
+	}
+
+	return campaignProgress(campaign, operations, price, now), nil
+}
+
+func campaignProgress(campaign *TcfCampaign, operations []sdk.Operation, price float64, now time.Time) *TcfCampaignProgress {
+
+	res := &TcfCampaignProgress{CurrentPrice: price}
+
+	amount := 0.0
+	for _, oper := range operations {
+		operation := oper.OperationType
+		if operation == sdk.BuyCard {
+			operation = sdk.BUY
+		}
+		if operation != campaign.Operation {
+			continue
+		}
+		res.Executed += oper.Quantity
+		amount += math.Abs(oper.Payment)
+	}
+	if res.Executed > 0 {
+		res.AveragePrice = math.Round(10000*amount/float64(res.Executed)) / 10000
+	}
+
+	schedule := campaign.Schedule()
+	for _, slice := range schedule {
+		if !slice.Time.After(now) {
+			res.Planned += slice.Quantity
+		}
+	}
+
+	res.Remaining = campaign.Quantity - res.Executed
+	if res.Remaining <= 0 {
+		res.Remaining = 0
+		res.Completed = true
+		return res
+	}
+
+	reference := campaign.StartPrice
+	if reference == 0 {
+		reference = res.AveragePrice
+	}
+	if reference > 0 && price > 0 {
+		move := 100 * (price - reference) / reference
+		if campaign.Operation == sdk.SELL {
+			move = -move
+		}
+		res.AdverseMove = math.Round(100*move) / 100
+	}
+
+	if campaign.MaxAdverseMove > 0 && res.AdverseMove > campaign.MaxAdverseMove {
+		res.Paused = true
+		return res
+	}
+
+	if shortfall := res.Planned - res.Executed; shortfall > 0 {
+		if shortfall > res.Remaining {
+			shortfall = res.Remaining
+		}
+		res.Next = &TcfCampaignSlice{Time: now, Quantity: shortfall}
+		return res
+	}
+
+	// on schedule, the next slice is the first one not due yet
+	for _, slice := range schedule {
+		if slice.Time.After(now) {
+			res.Next = &TcfCampaignSlice{Time: slice.Time, Quantity: slice.Quantity}
+			if res.Next.Quantity > res.Remaining {
+				res.Next.Quantity = res.Remaining
+			}
+			break
+		}
+	}
+
+	return res
+}
+
+// PrintCampaignProgress prints the progress and the next order of the campaign
+func PrintCampaignProgress(w io.Writer, campaign *TcfCampaign, progress *TcfCampaignProgress) {
+
+	fmt.Fprintf(w, "%s %s: executed %d of %d at %.4f, planned by now %d, price %.4f (adverse move %.2f%%)\n",
+		campaign.Operation, campaign.FIGI, progress.Executed, campaign.Quantity, progress.AveragePrice,
+		progress.Planned, progress.CurrentPrice, progress.AdverseMove)
+
+	switch {
+	case progress.Completed:
+		fmt.Fprintln(w, "Completed")
+	case progress.Paused:
+		fmt.Fprintf(w, "Paused: the price moved against the campaign by more than %.2f%%\n", campaign.MaxAdverseMove)
+	case progress.Next != nil:
+		fmt.Fprintf(w, "Next: %s %d at %s\n", campaign.Operation, progress.Next.Quantity, progress.Next.Time.Format("2006-01-02 15:04"))
+	}
+}
@@ -0,0 +1,107 @@
+package tinkoff
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	sdk "github.com/TinkoffCreditSystems/invest-openapi-go-sdk"
+)
+
+// dumpSchemaVersion is increased on every incompatible change of the dump format
+const dumpSchemaVersion = 1
+
+type dumpHeader struct {
+	Schema  int       `json:"schema"`
+	Kind    string    `json:"kind"`
+	Created time.Time `json:"created"`
+}
+
+// Dump writes all the stored candles in the portable format: a header line with the schema version
+// followed by one JSON candle per line
+func (s *TcfFileCandleStore) Dump(w io.Writer) error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	matches, err := filepath.Glob(filepath.Join(s.Dir, "*.jsonl"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(matches)
+
+	bw := bufio.NewWriter(w)
+	enc := json.NewEncoder(bw)
+
+	if err := enc.Encode(&dumpHeader{Schema: dumpSchemaVersion, Kind: "candles", Created: time.Now().UTC()}); err != nil {
+		return err
+	}
+
+	for _, match := range matches {
+
+		name := strings.TrimSuffix(filepath.Base(match), ".jsonl")
+		sep := strings.LastIndex(name, "_")
+		if sep < 0 {
+			continue
+		}
+
+		candles, err := s.readAll(name[:sep], sdk.CandleInterval(name[sep+1:]))
+		if err != nil {
+			return err
+		}
+
+		for _, candle := range candles {
+			if err := enc.Encode(&candle); err != nil {
+				return err
+			}
+		}
+	}
+
+	return bw.Flush()
+}
+
+// Restore loads the candles written by Dump, the candles already stored are kept
+func (s *TcfFileCandleStore) Restore(r io.Reader) error {
+
+	dec := json.NewDecoder(bufio.NewReader(r))
+
+	header := dumpHeader{}
+	if err := dec.Decode(&header); err != nil {
+		return fmt.Errorf("Invalid dump header: %w", err)
+	}
+
+	if header.Kind != "candles" {
+		return fmt.Errorf("Unexpected dump kind %q", header.Kind)
+	}
+
+	if header.Schema > dumpSchemaVersion {
+		return fmt.Errorf("Dump schema version %d is newer than the supported %d", header.Schema, dumpSchemaVersion)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	batch := []sdk.Candle{}
+	for dec.More() {
+
+		candle := sdk.Candle{}
+		if err := dec.Decode(&candle); err != nil {
+			return err
+		}
+
+		batch = append(batch, candle)
+		if len(batch) == 1000 {
+			if err := s.save(batch); err != nil {
+				return err
+			}
+			batch = batch[:0]
+		}
+	}
+
+	return s.save(batch)
+}
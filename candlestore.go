@@ -0,0 +1,317 @@
+package tinkoff
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	sdk "github.com/TinkoffCreditSystems/invest-openapi-go-sdk"
+)
+
+// TcfCandleStore is a local storage of candles
+type TcfCandleStore interface {
+	SaveCandles(candles []sdk.Candle) error
+	LoadCandles(figi string, interval sdk.CandleInterval, from, to time.Time) ([]sdk.Candle, error)
+	LastCandle(figi string, interval sdk.CandleInterval) (*sdk.Candle, error)
+}
+
+// TcfFileCandleStore keeps candles as JSON lines, one file per FIGI and interval
+type TcfFileCandleStore struct {
+	Dir string
+	mu  sync.Mutex
+}
+
+func NewFileCandleStore(dir string) (*TcfFileCandleStore, error) {
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	return &TcfFileCandleStore{Dir: dir}, nil
+}
+
+func (s *TcfFileCandleStore) path(figi string, interval sdk.CandleInterval) string {
+	return filepath.Join(s.Dir, fmt.Sprintf("%s_%s.jsonl", figi, interval))
+}
+
+func (s *TcfFileCandleStore) SaveCandles(candles []sdk.Candle) error {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.save(candles)
+}
+
+func (s *TcfFileCandleStore) save(candles []sdk.Candle) error {
+
+	files := make(map[string]*os.File)
+	defer func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}()
+
+	for _, candle := range candles {
+
+		path := s.path(candle.FIGI, candle.Interval)
+
+		f, ok := files[path]
+		if !ok {
+			var err error
+			f, err = os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+			if err != nil {
+				return err
+			}
+			files[path] = f
+		}
+
+		line, err := json.Marshal(candle)
+		if err != nil {
+			return err
+		}
+
+		if _, err := f.Write(append(line, '\n')); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *TcfFileCandleStore) readAll(figi string, interval sdk.CandleInterval) ([]sdk.Candle, error) {
+
+	f, err := os.Open(s.path(figi, interval))
+	if errors.Is(err, os.ErrNotExist) {
+		return []sdk.Candle{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	// the same candle may be stored more than once (e.g. backfilled and streamed), the latest wins
+	byTS := make(map[time.Time]sdk.Candle)
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		candle := sdk.Candle{}
+		if err := json.Unmarshal(scanner.Bytes(), &candle); err != nil {
+			return nil, err
+		}
+		byTS[candle.TS.UTC()] = candle
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	res := make([]sdk.Candle, 0, len(byTS))
+	for _, candle := range byTS {
+		res = append(res, candle)
+	}
+
+	sort.SliceStable(res, func(i, j int) bool {
+		return res[i].TS.Before(res[j].TS)
+	})
+
+	return res, nil
+}
+
+func (s *TcfFileCandleStore) LoadCandles(figi string, interval sdk.CandleInterval, from, to time.Time) ([]sdk.Candle, error) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	candles, err := s.readAll(figi, interval)
+	if err != nil {
+		return nil, err
+	}
+
+	res := []sdk.Candle{}
+	for _, candle := range candles {
+		if !candle.TS.Before(from) && candle.TS.Before(to) {
+			res = append(res, candle)
+		}
+	}
+
+	return res, nil
+}
+
+func (s *TcfFileCandleStore) LastCandle(figi string, interval sdk.CandleInterval) (*sdk.Candle, error) {
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	candles, err := s.readAll(figi, interval)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(candles) == 0 {
+		return nil, nil
+	}
+
+	return &candles[len(candles)-1], nil
+}
+
+// TcfRetentionPolicy defines how long the candles are kept at full resolution
+type TcfRetentionPolicy struct {
+	// Keep1Min is the age after which 1-minute candles are downsampled to hourly candles, 0 keeps them as is
+	Keep1Min time.Duration
+	// Keep1Hour is the age after which hourly candles are downsampled to daily candles, 0 keeps them as is
+	Keep1Hour time.Duration
+}
+
+// Compact downsamples the candles older than the policy allows into the coarser interval
+func (s *TcfFileCandleStore) Compact(policy *TcfRetentionPolicy) error {
+
+	steps := []struct {
+		keep time.Duration
+		from sdk.CandleInterval
+		to   sdk.CandleInterval
+		unit time.Duration
+	}{
+		{keep: policy.Keep1Min, from: sdk.CandleInterval1Min, to: sdk.CandleInterval1Hour, unit: time.Hour},
+		{keep: policy.Keep1Hour, from: sdk.CandleInterval1Hour, to: sdk.CandleInterval1Day, unit: 24 * time.Hour},
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, step := range steps {
+
+		if step.keep == 0 {
+			continue
+		}
+
+		// only the whole buckets are downsampled, so a bucket never spreads over both files
+		threshold := time.Now().Add(-step.keep).Truncate(step.unit)
+
+		figis, err := s.figis(step.from)
+		if err != nil {
+			return err
+		}
+
+		for _, figi := range figis {
+
+			candles, err := s.readAll(figi, step.from)
+			if err != nil {
+				return err
+			}
+
+			old, keep := []sdk.Candle{}, []sdk.Candle{}
+			for _, candle := range candles {
+				if candle.TS.Before(threshold) {
+					old = append(old, candle)
+				} else {
+					keep = append(keep, candle)
+				}
+			}
+
+			if len(old) == 0 {
+				continue
+			}
+
+			if err := s.save(downsample(old, step.to, step.unit)); err != nil {
+				return err
+			}
+
+			if err := s.rewrite(figi, step.from, keep); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// figis returns FIGIs having the stored candles of the interval
+func (s *TcfFileCandleStore) figis(interval sdk.CandleInterval) ([]string, error) {
+
+	suffix := fmt.Sprintf("_%s.jsonl", interval)
+
+	matches, err := filepath.Glob(filepath.Join(s.Dir, "*"+suffix))
+	if err != nil {
+		return nil, err
+	}
+
+	res := []string{}
+	for _, match := range matches {
+		name := filepath.Base(match)
+		res = append(res, name[:len(name)-len(suffix)])
+	}
+
+	return res, nil
+}
+
+// rewrite replaces the stored candles of the FIGI and interval
+func (s *TcfFileCandleStore) rewrite(figi string, interval sdk.CandleInterval, candles []sdk.Candle) error {
+
+	path := s.path(figi, interval)
+	tmp := path + ".tmp"
+
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(f)
+	for _, candle := range candles {
+		line, err := json.Marshal(candle)
+		if err != nil {
+			f.Close()
+			return err
+		}
+		w.Write(append(line, '\n'))
+	}
+
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
+
+// downsample aggregates the sorted candles into the candles of the coarser interval
+func downsample(candles []sdk.Candle, interval sdk.CandleInterval, unit time.Duration) []sdk.Candle {
+
+	res := []sdk.Candle{}
+
+	for _, candle := range candles {
+
+		ts := candle.TS.Truncate(unit)
+
+		if len(res) == 0 || !res[len(res)-1].TS.Equal(ts) || res[len(res)-1].FIGI != candle.FIGI {
+			res = append(res, sdk.Candle{
+				FIGI:       candle.FIGI,
+				Interval:   interval,
+				OpenPrice:  candle.OpenPrice,
+				ClosePrice: candle.ClosePrice,
+				HighPrice:  candle.HighPrice,
+				LowPrice:   candle.LowPrice,
+				Volume:     candle.Volume,
+				TS:         ts,
+			})
+			continue
+		}
+
+		agg := &res[len(res)-1]
+		agg.ClosePrice = candle.ClosePrice
+		agg.HighPrice = math.Max(agg.HighPrice, candle.HighPrice)
+		agg.LowPrice = math.Min(agg.LowPrice, candle.LowPrice)
+		agg.Volume += candle.Volume
+	}
+
+	return res
+}
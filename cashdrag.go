@@ -0,0 +1,133 @@
+package tinkoff
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	sdk "github.com/TinkoffCreditSystems/invest-openapi-go-sdk"
+	"github.com/shopspring/decimal"
+)
+
+// TcfCashDrag is the uninvested cash of one currency at a moment
+type TcfCashDrag struct {
+	Time     time.Time
+	Currency TcfCurrency
+	// CashAmount is the free cash
+	CashAmount decimal.Decimal
+	// PortfolioAmount is the value of the positions and the cash in the currency
+	PortfolioAmount decimal.Decimal
+	// Percent is the share of the cash in the portfolio value
+	Percent float64
+}
+
+type TcfCashDragAlert struct {
+	Currency TcfCurrency
+	Since    time.Time
+	Days     int
+	// Percent is the latest cash share
+	Percent float64
+}
+
+// GetCashDrag returns the current share of the uninvested cash per currency
+func (acc *TcfAccount) GetCashDrag(ctx context.Context, accountID string) ([]*TcfCashDrag, error) {
+
+	var portfolio sdk.Portfolio
+	err := acc.call(ctx, 20*time.Second, func(ctx context.Context) (err error) {
+		portfolio, err = acc.Client.Portfolio(ctx, acc.accountID(accountID))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return cashDrag(portfolio, time.Now()), nil
+}
+
+func cashDrag(portfolio sdk.Portfolio, now time.Time) []*TcfCashDrag {
+
+	cash := make(map[TcfCurrency]decimal.Decimal)
+	value := make(map[TcfCurrency]decimal.Decimal)
+
+	for _, c := range portfolio.Currencies {
+		currency := TcfCurrency(c.Currency)
+		cash[currency] = cash[currency].Add(money(c.Balance - c.Blocked))
+		value[currency] = value[currency].Add(money(c.Balance))
+	}
+
+	for _, p := range portfolio.Positions {
+
+		// currencies are reported in the both lists
+		if p.InstrumentType == sdk.InstrumentTypeCurrency {
+			continue
+		}
+
+		// the market value is the book value plus the expected yield
+		currency := TcfCurrency(p.AveragePositionPrice.Currency)
+		value[currency] = value[currency].Add(money(p.Balance).Mul(money(p.AveragePositionPrice.Value))).Add(money(p.ExpectedYield.Value))
+	}
+
+	res := []*TcfCashDrag{}
+	for currency, amount := range value {
+
+		drag := &TcfCashDrag{
+			Time:            now,
+			Currency:        currency,
+			CashAmount:      cash[currency],
+			PortfolioAmount: amount,
+		}
+
+		if amount.IsPositive() {
+			drag.Percent, _ = cash[currency].Div(amount).Mul(decimal.NewFromInt(100)).Round(2).Float64()
+		}
+
+		res = append(res, drag)
+	}
+
+	sort.SliceStable(res, func(i, j int) bool {
+		return res[i].Currency < res[j].Currency
+	})
+
+	return res
+}
+
+// CashDragAlerts finds the currencies whose cash share has stayed above the threshold (in percents)
+// for at least the given number of days up to the latest sample
+func CashDragAlerts(samples []*TcfCashDrag, thresholdPercent float64, days int) []*TcfCashDragAlert {
+
+	byCurrency := make(map[TcfCurrency][]*TcfCashDrag)
+	for _, sample := range samples {
+		byCurrency[sample.Currency] = append(byCurrency[sample.Currency], sample)
+	}
+
+	alerts := []*TcfCashDragAlert{}
+
+	for currency, series := range byCurrency {
+
+		sort.SliceStable(series, func(i, j int) bool {
+			return series[i].Time.Before(series[j].Time)
+		})
+
+		latest := series[len(series)-1]
+		if latest.Percent <= thresholdPercent {
+			continue
+		}
+
+		// walk back while the cash share stays above the threshold
+		since := latest.Time
+		for i := len(series) - 1; i >= 0 && series[i].Percent > thresholdPercent; i-- {
+			since = series[i].Time
+		}
+
+		elapsed := int(latest.Time.Sub(since).Hours() / 24)
+		if elapsed >= days {
+			alerts = append(alerts, &TcfCashDragAlert{Currency: currency, Since: since, Days: elapsed, Percent: latest.Percent})
+		}
+	}
+
+	sort.SliceStable(alerts, func(i, j int) bool {
+		return alerts[i].Currency < alerts[j].Currency
+	})
+
+	return alerts
+}
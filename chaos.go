@@ -0,0 +1,88 @@
+package tinkoff
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+var (
+	ErrChaosRateLimit = errors.New("chaos: injected rate limit error, code=429")
+	ErrChaosFailure   = errors.New("chaos: injected API failure, code=503")
+)
+
+// TcfChaos injects failures into the API requests, so automations built on the package
+// can be tested against an unstable API. Probabilities are in the range [0, 1]
+type TcfChaos struct {
+	LatencyProbability float64
+	Latency            time.Duration
+	// RateLimitProbability is the probability the request fails with ErrChaosRateLimit
+	RateLimitProbability float64
+	// FailureProbability is the probability the request fails with ErrChaosFailure
+	FailureProbability float64
+	// Seed makes the injected failures reproducible, 0 seeds with the current time
+	Seed int64
+
+	mu  sync.Mutex
+	rnd *rand.Rand
+}
+
+// WithChaos enables the failure injection into every API request of the account
+func WithChaos(chaos *TcfChaos) TcfOption {
+	return func(acc *TcfAccount) {
+		acc.chaos = chaos
+	}
+}
+
+func (c *TcfChaos) happens(probability float64) bool {
+
+	if probability <= 0 {
+		return false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.rnd == nil {
+		seed := c.Seed
+		if seed == 0 {
+			seed = time.Now().UnixNano()
+		}
+		c.rnd = rand.New(rand.NewSource(seed))
+	}
+
+	return c.rnd.Float64() < probability
+}
+
+// wrap makes the request to be delayed or failed before it's sent
+func (c *TcfChaos) wrap(fn func(ctx context.Context) error) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		if err := c.inject(ctx); err != nil {
+			return err
+		}
+		return fn(ctx)
+	}
+}
+
+func (c *TcfChaos) inject(ctx context.Context) error {
+
+	if c.happens(c.LatencyProbability) {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(c.Latency):
+		}
+	}
+
+	if c.happens(c.RateLimitProbability) {
+		return ErrChaosRateLimit
+	}
+
+	if c.happens(c.FailureProbability) {
+		return ErrChaosFailure
+	}
+
+	return nil
+}
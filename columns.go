@@ -0,0 +1,284 @@
+package tinkoff
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/shopspring/decimal"
+)
+
+type TcfReportColumn string
+
+const (
+	ColumnFIGI              TcfReportColumn = "FIGI"
+	ColumnTicker            TcfReportColumn = "Ticker"
+	ColumnName              TcfReportColumn = "Name"
+	ColumnCurrency          TcfReportColumn = "Currency"
+	ColumnBalance           TcfReportColumn = "Balance"
+	ColumnCommission        TcfReportColumn = "Commission"
+	ColumnPortfolio         TcfReportColumn = "Portfolio"
+	ColumnQuantity          TcfReportColumn = "Quantity"
+	ColumnCurrentPrice      TcfReportColumn = "CurrentPrice"
+	ColumnDividend          TcfReportColumn = "Dividend"
+	ColumnServiceCommission TcfReportColumn = "ServiceCommission"
+	ColumnTaxBack           TcfReportColumn = "TaxBack"
+	ColumnMarginFee         TcfReportColumn = "MarginFee"
+	ColumnTarget            TcfReportColumn = "Target"
+	ColumnToTarget          TcfReportColumn = "ToTarget"
+	ColumnRealizedPnL       TcfReportColumn = "RealizedPnL"
+	ColumnUnrealizedPnL     TcfReportColumn = "UnrealizedPnL"
+	ColumnXIRR              TcfReportColumn = "XIRR"
+	ColumnBeta              TcfReportColumn = "Beta"
+	ColumnCorrelation       TcfReportColumn = "Correlation"
+	ColumnCoupon            TcfReportColumn = "Coupon"
+	ColumnRepayment         TcfReportColumn = "Repayment"
+	ColumnAccruedInterest   TcfReportColumn = "AccruedInterest"
+	ColumnYTM               TcfReportColumn = "YTM"
+	ColumnDuration          TcfReportColumn = "Duration"
+)
+
+// TcfReportOptions configures the columns of the balance table
+type TcfReportOptions struct {
+	Columns []TcfReportColumn
+	// Locale translates the headers and formats the amounts, the amounts are rendered as plain numbers if not set
+	Locale TcfLocale
+	// Colors highlights the balance and the totals in the text report, by default only when writing to a terminal
+	Colors TcfColorMode
+	// Computed are the columns calculated by the expressions, added after the Columns
+	Computed []TcfComputedColumn
+}
+
+type TcfColorMode string
+
+const (
+	ColorsAuto   TcfColorMode = ""
+	ColorsAlways TcfColorMode = "always"
+	ColorsNever  TcfColorMode = "never"
+)
+
+// enabled reports whether the colors are written to the writer
+func (m TcfColorMode) enabled(w io.Writer) bool {
+
+	switch m {
+	case ColorsAlways:
+		return true
+	case ColorsNever:
+		return false
+	}
+
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// DefaultReportOptions returns the options matching the default report layout
+func DefaultReportOptions() *TcfReportOptions {
+	return &TcfReportOptions{
+		Columns: []TcfReportColumn{
+			ColumnFIGI,
+			ColumnTicker,
+			ColumnName,
+			ColumnCurrency,
+			ColumnBalance,
+			ColumnCommission,
+			ColumnPortfolio,
+			ColumnDividend,
+			ColumnServiceCommission,
+			ColumnTaxBack,
+			ColumnMarginFee,
+			ColumnTarget,
+			ColumnToTarget,
+		},
+	}
+}
+
+func (o *TcfReportOptions) formatter() reportFormatter {
+	if o == nil {
+		return reportFormatter{}
+	}
+	return reportFormatter{locale: o.Locale}
+}
+
+// Validate checks all the columns are known and the expressions of the computed columns are correct
+func (o *TcfReportOptions) Validate() error {
+	for _, column := range o.Columns {
+		if _, ok := reportColumns[column]; !ok {
+			return errors.New(fmt.Sprintf("Unknown report column %q", string(column)))
+		}
+	}
+	_, err := compileColumns(o.Computed)
+	return err
+}
+
+// reportColumn renders the column cells of an item and of a currency total
+type reportColumn struct {
+	header string
+	cell   func(item *TcfBalanceItem, f reportFormatter) interface{}
+	footer func(currency TcfCurrency, total *TcfTotal, f reportFormatter) interface{}
+}
+
+var reportColumns = map[TcfReportColumn]reportColumn{
+	ColumnFIGI: {
+		header: "FIGI",
+		cell:   func(item *TcfBalanceItem, f reportFormatter) interface{} { return item.FIGI },
+	},
+	ColumnTicker: {
+		header: "Ticker",
+		cell:   func(item *TcfBalanceItem, f reportFormatter) interface{} { return item.Ticker },
+	},
+	ColumnName: {
+		header: "Name",
+		cell:   func(item *TcfBalanceItem, f reportFormatter) interface{} { return item.Name },
+		footer: func(_ TcfCurrency, _ *TcfTotal, f reportFormatter) interface{} { return f.text("Total") },
+	},
+	ColumnCurrency: {
+		header: "Currency",
+		cell:   func(item *TcfBalanceItem, f reportFormatter) interface{} { return item.Currency },
+		footer: func(currency TcfCurrency, _ *TcfTotal, _ reportFormatter) interface{} { return currency },
+	},
+	ColumnBalance: {
+		header: "Balance",
+		cell:   func(item *TcfBalanceItem, f reportFormatter) interface{} { return f.money(item.BalanceAmount) },
+		footer: func(_ TcfCurrency, total *TcfTotal, f reportFormatter) interface{} {
+			return f.money(total.BalanceAmount)
+		},
+	},
+	ColumnCommission: {
+		header: "Commission",
+		cell:   func(item *TcfBalanceItem, f reportFormatter) interface{} { return f.money(item.BrokerCommissionAmount) },
+	},
+	ColumnPortfolio: {
+		header: "Portfolio",
+		cell:   func(item *TcfBalanceItem, f reportFormatter) interface{} { return f.money(item.PortfolioAmount) },
+		footer: func(_ TcfCurrency, total *TcfTotal, f reportFormatter) interface{} {
+			return f.money(total.PortfolioAmount)
+		},
+	},
+	ColumnQuantity: {
+		header: "Quantity",
+		cell:   func(item *TcfBalanceItem, f reportFormatter) interface{} { return item.PortfolioQuantity },
+	},
+	ColumnCurrentPrice: {
+		header: "Current price",
+		cell:   func(item *TcfBalanceItem, f reportFormatter) interface{} { return f.money(item.CurrentPrice) },
+	},
+	ColumnDividend: {
+		header: "Dividend",
+		cell:   dividendCell,
+	},
+	ColumnCoupon: {
+		header: "Coupon",
+		cell: func(item *TcfBalanceItem, f reportFormatter) interface{} {
+			return f.money(item.CouponAmount.Sub(item.CouponTaxAmount))
+		},
+	},
+	ColumnRepayment: {
+		header: "Repayment",
+		cell:   func(item *TcfBalanceItem, f reportFormatter) interface{} { return f.money(item.RepaymentAmount) },
+	},
+	ColumnAccruedInterest: {
+		header: "Accrued interest",
+		cell:   func(item *TcfBalanceItem, f reportFormatter) interface{} { return f.money(item.AccruedInterest) },
+	},
+	ColumnServiceCommission: {
+		header: "Service commission",
+		cell:   func(*TcfBalanceItem, reportFormatter) interface{} { return "" },
+		footer: func(_ TcfCurrency, total *TcfTotal, f reportFormatter) interface{} {
+			return f.money(total.ServiceCommissionAmount)
+		},
+	},
+	ColumnTaxBack: {
+		header: "Tax back",
+		cell:   func(*TcfBalanceItem, reportFormatter) interface{} { return "" },
+		footer: func(_ TcfCurrency, total *TcfTotal, f reportFormatter) interface{} { return f.money(total.TaxBack) },
+	},
+	ColumnMarginFee: {
+		header: "Margin fee",
+		cell:   func(item *TcfBalanceItem, f reportFormatter) interface{} { return f.money(item.MarginFeeAmount) },
+	},
+	ColumnRealizedPnL: {
+		header: "Realized P&L",
+		cell:   func(item *TcfBalanceItem, f reportFormatter) interface{} { return f.money(item.RealizedPnL) },
+	},
+	ColumnUnrealizedPnL: {
+		header: "Unrealized P&L",
+		cell:   func(item *TcfBalanceItem, f reportFormatter) interface{} { return f.money(item.UnrealizedPnL) },
+	},
+	ColumnXIRR: {
+		header: "XIRR, %",
+		cell:   func(item *TcfBalanceItem, f reportFormatter) interface{} { return f.percent(item.XIRR) },
+		footer: func(_ TcfCurrency, total *TcfTotal, f reportFormatter) interface{} { return f.percent(total.XIRR) },
+	},
+	ColumnBeta: {
+		header: "Beta",
+		cell:   func(item *TcfBalanceItem, f reportFormatter) interface{} { return f.percent(item.Beta) },
+	},
+	ColumnCorrelation: {
+		header: "Correlation",
+		cell:   func(item *TcfBalanceItem, f reportFormatter) interface{} { return f.percent(item.Correlation) },
+	},
+	ColumnYTM: {
+		header: "YTM, %",
+		cell:   func(item *TcfBalanceItem, f reportFormatter) interface{} { return f.percent(item.YTM) },
+	},
+	ColumnDuration: {
+		header: "Duration",
+		cell:   func(item *TcfBalanceItem, f reportFormatter) interface{} { return f.percent(item.ModifiedDuration) },
+	},
+	ColumnTarget: {
+		header: "Target",
+		cell: func(item *TcfBalanceItem, f reportFormatter) interface{} {
+			if !item.TargetPrice.IsPositive() {
+				return ""
+			}
+			return f.number(item.TargetPrice, 2)
+		},
+	},
+	ColumnToTarget: {
+		header: "To target, %",
+		cell: func(item *TcfBalanceItem, f reportFormatter) interface{} {
+			if !item.TargetPrice.IsPositive() {
+				return ""
+			}
+			toTarget := f.number(decimal.NewFromFloat(item.TargetDistance), 2)
+			if item.TargetReached {
+				toTarget += fmt.Sprintf(" (%s)", f.text("reached"))
+			}
+			return toTarget
+		},
+	},
+}
+
+// dividendCell shows the net dividend in the instrument's currency with the foreign income appended
+func dividendCell(item *TcfBalanceItem, f reportFormatter) interface{} {
+
+	net := item.DividendAmount.Sub(item.DividendTaxAmount)
+
+	foreign := item.ForeignIncome()
+	if len(foreign) == 0 {
+		return f.money(net)
+	}
+
+	text := f.number(net, 2)
+	for _, currency := range currencies {
+		if income, ok := foreign[currency]; ok {
+			text += fmt.Sprintf(" + %s %s", f.number(netIncome(income), 2), currency)
+		}
+	}
+
+	return text
+}
+
+func netIncome(income *TcfIncome) decimal.Decimal {
+	return income.DividendAmount.Sub(income.DividendTaxAmount).Add(income.CouponAmount).Sub(income.CouponTaxAmount)
+}
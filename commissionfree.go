@@ -0,0 +1,107 @@
+package tinkoff
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	sdk "github.com/TinkoffCreditSystems/invest-openapi-go-sdk"
+	"github.com/mikhailbolshakov/tinkoff/utils"
+	"github.com/shopspring/decimal"
+)
+
+// IsCommissionFree reports whether the operation is a trade executed without the broker commission
+func IsCommissionFree(oper sdk.Operation) bool {
+	return utils.Category(oper.OperationType) == utils.CategoryTrade && oper.Commission.Value == 0
+}
+
+// TcfCommissionFreeItem is the position traded without the commission, e.g. the broker's own funds
+type TcfCommissionFreeItem struct {
+	FIGI            string
+	Ticker          string
+	Currency        TcfCurrency
+	Trades          int
+	PortfolioAmount decimal.Decimal
+}
+
+// TcfCommissionFreeReport is the share of the portfolio value in the positions traded without the commission
+type TcfCommissionFreeReport struct {
+	Items []*TcfCommissionFreeItem
+	// Percents maps the currency to the share of the commission-free positions in the positions value
+	Percents map[TcfCurrency]float64
+}
+
+// GetCommissionFreeReport finds the positions every trade of which had zero commission and their share in the portfolio
+func (acc *TcfAccount) GetCommissionFreeReport(ctx context.Context, accountID string) (*TcfCommissionFreeReport, error) {
+
+	var portfolio sdk.Portfolio
+	err := acc.call(ctx, 20*time.Second, func(ctx context.Context) (err error) {
+		portfolio, err = acc.Client.Portfolio(ctx, acc.accountID(accountID))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	operations, err := acc.GetOperations(ctx, &TcfGetOperationsRequest{
+		AccountID:  accountID,
+		PeriodFrom: time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC),
+		PeriodTo:   time.Now(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	free := make(map[string]int)
+	for figi, figiOperations := range utils.ByFigi(operations) {
+
+		trades := utils.Filter(figiOperations, func(oper sdk.Operation) bool {
+			return utils.Category(oper.OperationType) == utils.CategoryTrade
+		})
+
+		if len(trades) > 0 && len(utils.Filter(trades, IsCommissionFree)) == len(trades) {
+			free[figi] = len(trades)
+		}
+	}
+
+	report := &TcfCommissionFreeReport{Items: []*TcfCommissionFreeItem{}, Percents: make(map[TcfCurrency]float64)}
+	total := make(map[TcfCurrency]decimal.Decimal)
+	freeTotal := make(map[TcfCurrency]decimal.Decimal)
+
+	for _, p := range portfolio.Positions {
+
+		if p.InstrumentType == sdk.InstrumentTypeCurrency {
+			continue
+		}
+
+		currency := TcfCurrency(p.AveragePositionPrice.Currency)
+		value := money(p.Balance).Mul(money(p.AveragePositionPrice.Value)).Add(money(p.ExpectedYield.Value))
+		total[currency] = total[currency].Add(value)
+
+		trades, ok := free[p.FIGI]
+		if !ok {
+			continue
+		}
+
+		freeTotal[currency] = freeTotal[currency].Add(value)
+		report.Items = append(report.Items, &TcfCommissionFreeItem{
+			FIGI:            p.FIGI,
+			Ticker:          p.Ticker,
+			Currency:        currency,
+			Trades:          trades,
+			PortfolioAmount: value,
+		})
+	}
+
+	for currency, amount := range total {
+		if amount.IsPositive() {
+			report.Percents[currency], _ = freeTotal[currency].Div(amount).Mul(decimal.NewFromInt(100)).Round(2).Float64()
+		}
+	}
+
+	sort.SliceStable(report.Items, func(i, j int) bool {
+		return report.Items[i].PortfolioAmount.GreaterThan(report.Items[j].PortfolioAmount)
+	})
+
+	return report, nil
+}
@@ -0,0 +1,152 @@
+package tinkoff
+
+import (
+	"context"
+	"io"
+	"sort"
+
+	"github.com/shopspring/decimal"
+)
+
+type TcfComparePeriodsRequest struct {
+	// Current and Previous are the balance requests of the compared periods (e.g. this month and the last one)
+	Current  *TcfPortfolioBalanceRequest
+	Previous *TcfPortfolioBalanceRequest
+}
+
+// TcfPositionChange is the change of a position between the previous and the current period
+type TcfPositionChange struct {
+	FIGI     string      `report:"FIGI"`
+	Ticker   string      `report:"Ticker"`
+	Currency TcfCurrency `report:"Currency"`
+	// Added and Removed mark the positions present in one period only
+	Added                   bool            `report:"-"`
+	Removed                 bool            `report:"-"`
+	PreviousBalanceAmount   decimal.Decimal `report:"Balance before"`
+	BalanceAmount           decimal.Decimal `report:"Balance"`
+	BalanceChange           decimal.Decimal `report:"Balance change"`
+	PreviousPortfolioAmount decimal.Decimal `report:"Portfolio before"`
+	PortfolioAmount         decimal.Decimal `report:"Portfolio"`
+	PortfolioChange         decimal.Decimal `report:"Portfolio change"`
+	PreviousQuantity        int             `report:"Quantity before"`
+	Quantity                int             `report:"Quantity"`
+	QuantityChange          int             `report:"Quantity change"`
+}
+
+// TcfTotalChange is the change of the totals of a currency
+type TcfTotalChange struct {
+	Currency                TcfCurrency
+	PreviousBalanceAmount   decimal.Decimal
+	BalanceAmount           decimal.Decimal
+	BalanceChange           decimal.Decimal
+	PreviousPortfolioAmount decimal.Decimal
+	PortfolioAmount         decimal.Decimal
+	PortfolioChange         decimal.Decimal
+}
+
+type TcfPeriodComparison struct {
+	Current   *TcfPortfolioBalance
+	Previous  *TcfPortfolioBalance
+	Positions []*TcfPositionChange
+	Totals    []*TcfTotalChange
+}
+
+// ComparePeriods calculates the balances of the two periods and the change of every position between them,
+// the positions of every period are valued at the close prices of its end (see ValueAtPeriodEnd)
+func (acc *TcfAccount) ComparePeriods(ctx context.Context, request *TcfComparePeriodsRequest) (*TcfPeriodComparison, error) {
+
+	previousRequest, currentRequest := *request.Previous, *request.Current
+	previousRequest.ValueAtPeriodEnd, currentRequest.ValueAtPeriodEnd = true, true
+
+	previous, err := acc.GetPortfolioBalance(ctx, &previousRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	current, err := acc.GetPortfolioBalance(ctx, &currentRequest)
+	if err != nil {
+		return nil, err
+	}
+
+	return comparePeriods(current, previous), nil
+}
+
+func comparePeriods(current, previous *TcfPortfolioBalance) *TcfPeriodComparison {
+
+	res := &TcfPeriodComparison{Current: current, Previous: previous, Positions: []*TcfPositionChange{}, Totals: []*TcfTotalChange{}}
+
+	changes := make(map[string]*TcfPositionChange)
+	// a position is added until found in the previous period and removed until found in the current one
+	change := func(item *TcfBalanceItem) *TcfPositionChange {
+		c, ok := changes[item.FIGI]
+		if !ok {
+			c = &TcfPositionChange{FIGI: item.FIGI, Ticker: item.Ticker, Currency: item.Currency, Added: true, Removed: true}
+			changes[item.FIGI] = c
+			res.Positions = append(res.Positions, c)
+		}
+		return c
+	}
+
+	for _, item := range previous.Items {
+		c := change(item)
+		c.Added = false
+		c.PreviousBalanceAmount = item.BalanceAmount
+		c.PreviousPortfolioAmount = item.PortfolioAmount
+		c.PreviousQuantity = item.PortfolioQuantity
+	}
+
+	for _, item := range current.Items {
+		c := change(item)
+		c.Removed = false
+		c.BalanceAmount = item.BalanceAmount
+		c.PortfolioAmount = item.PortfolioAmount
+		c.Quantity = item.PortfolioQuantity
+	}
+
+	for _, c := range res.Positions {
+		c.BalanceChange = c.BalanceAmount.Sub(c.PreviousBalanceAmount)
+		c.PortfolioChange = c.PortfolioAmount.Sub(c.PreviousPortfolioAmount)
+		c.QuantityChange = c.Quantity - c.PreviousQuantity
+	}
+
+	sort.SliceStable(res.Positions, func(i, j int) bool {
+		x, y := res.Positions[i], res.Positions[j]
+		if x.Ticker != y.Ticker {
+			return x.Ticker < y.Ticker
+		}
+		return x.FIGI < y.FIGI
+	})
+
+	totals := &TcfBalanceTotal{}
+	for currency := range previous.Total.Currencies {
+		totals.Currency(currency)
+	}
+	for currency := range current.Total.Currencies {
+		totals.Currency(currency)
+	}
+
+	for _, currency := range totals.SortedCurrencies() {
+
+		c := &TcfTotalChange{Currency: currency}
+		if total, ok := previous.Total.Currencies[currency]; ok {
+			c.PreviousBalanceAmount = total.BalanceAmount
+			c.PreviousPortfolioAmount = total.PortfolioAmount
+		}
+		if total, ok := current.Total.Currencies[currency]; ok {
+			c.BalanceAmount = total.BalanceAmount
+			c.PortfolioAmount = total.PortfolioAmount
+		}
+		c.BalanceChange = c.BalanceAmount.Sub(c.PreviousBalanceAmount)
+		c.PortfolioChange = c.PortfolioAmount.Sub(c.PreviousPortfolioAmount)
+
+		res.Totals = append(res.Totals, c)
+	}
+
+	return res
+}
+
+// PrintPeriodComparison prints the position changes and the totals by currency
+func PrintPeriodComparison(w io.Writer, comparison *TcfPeriodComparison) {
+	RenderTable(w, comparison.Positions)
+	RenderTable(w, comparison.Totals)
+}
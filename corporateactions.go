@@ -0,0 +1,117 @@
+package tinkoff
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	sdk "github.com/TinkoffCreditSystems/invest-openapi-go-sdk"
+)
+
+// TcfCorporateAction is a split or a FIGI change of the instrument. The operations made before the date are replayed
+// as if they were made after it: the quantities are multiplied and the prices are divided by the ratio,
+// the payments stay the same so the cost basis is kept
+type TcfCorporateAction struct {
+	FIGI string
+	// Date is the first trading day after the action
+	Date time.Time
+	// Ratio is the number of the new shares per an old one, e.g. 4 for 4:1 split or 0.1 for 1:10 reverse split,
+	// zero or one if the quantity doesn't change
+	Ratio float64
+	// NewFIGI is the FIGI of the instrument since the date, empty if it is not changed
+	NewFIGI string
+}
+
+// builtinCorporateActions are the splits of the popular instruments
+var builtinCorporateActions = []TcfCorporateAction{
+	{FIGI: "BBG000B9XRY4", Date: time.Date(2020, 8, 31, 0, 0, 0, 0, time.UTC), Ratio: 4},  // AAPL
+	{FIGI: "BBG000N9MNX3", Date: time.Date(2020, 8, 31, 0, 0, 0, 0, time.UTC), Ratio: 5},  // TSLA
+	{FIGI: "BBG000BBJQV0", Date: time.Date(2021, 7, 20, 0, 0, 0, 0, time.UTC), Ratio: 4},  // NVDA
+	{FIGI: "BBG000BVPV84", Date: time.Date(2022, 6, 6, 0, 0, 0, 0, time.UTC), Ratio: 20},  // AMZN
+	{FIGI: "BBG009S39JX6", Date: time.Date(2022, 7, 18, 0, 0, 0, 0, time.UTC), Ratio: 20}, // GOOGL
+	{FIGI: "BBG000N9MNX3", Date: time.Date(2022, 8, 25, 0, 0, 0, 0, time.UTC), Ratio: 3},  // TSLA
+	{FIGI: "BBG000BBJQV0", Date: time.Date(2024, 6, 10, 0, 0, 0, 0, time.UTC), Ratio: 10}, // NVDA
+}
+
+// WithCorporateActions adds the corporate actions to the built-in ones
+func WithCorporateActions(actions ...TcfCorporateAction) TcfOption {
+	return func(acc *TcfAccount) {
+		acc.corporateActions = append(acc.corporateActions, actions...)
+	}
+}
+
+// allCorporateActions returns the built-in and the added actions by date
+func (acc *TcfAccount) allCorporateActions() []TcfCorporateAction {
+
+	actions := append(append([]TcfCorporateAction{}, builtinCorporateActions...), acc.corporateActions...)
+
+	sort.SliceStable(actions, func(i, j int) bool {
+		return actions[i].Date.Before(actions[j].Date)
+	})
+
+	return actions
+}
+
+// figiAliases returns the FIGI and the former FIGIs of the instrument, changed to it directly or by a chain
+func (acc *TcfAccount) figiAliases(figi string) []string {
+
+	actions := acc.allCorporateActions()
+
+	res := []string{figi}
+	seen := map[string]bool{figi: true}
+
+	for i := 0; i < len(res); i++ {
+		for _, action := range actions {
+			if action.NewFIGI == res[i] && !seen[action.FIGI] {
+				seen[action.FIGI] = true
+				res = append(res, action.FIGI)
+			}
+		}
+	}
+
+	return res
+}
+
+// applyCorporateActions adjusts the operations made before the actions of their instruments
+func (acc *TcfAccount) applyCorporateActions(operations []sdk.Operation) []sdk.Operation {
+
+	// the actions are applied in order, so the operations follow the chain of the FIGI changes
+	actions := acc.allCorporateActions()
+
+	res := make([]sdk.Operation, len(operations))
+	for i, oper := range operations {
+		for _, action := range actions {
+			if oper.FIGI == action.FIGI && oper.DateTime.Before(action.Date) {
+				oper = adjustOperation(oper, action)
+			}
+		}
+		res[i] = oper
+	}
+
+	return res
+}
+
+func adjustOperation(oper sdk.Operation, action TcfCorporateAction) sdk.Operation {
+
+	if action.NewFIGI != "" {
+		oper.FIGI = action.NewFIGI
+	}
+
+	if action.Ratio <= 0 || action.Ratio == 1 {
+		return oper
+	}
+
+	oper.Quantity = int(math.Round(float64(oper.Quantity) * action.Ratio))
+	oper.QuantityExecuted = int(math.Round(float64(oper.QuantityExecuted) * action.Ratio))
+	oper.Price /= action.Ratio
+
+	trades := make([]sdk.Trade, len(oper.Trades))
+	for i, trade := range oper.Trades {
+		trade.Quantity = int(math.Round(float64(trade.Quantity) * action.Ratio))
+		trade.Price /= action.Ratio
+		trades[i] = trade
+	}
+	oper.Trades = trades
+
+	return oper
+}
@@ -0,0 +1,138 @@
+package tinkoff
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// TcfCSVDialect configures the CSV output for the spreadsheet apps.
+// The apps in the RU locale expect the semicolon separator and the decimal comma, Excel also needs the BOM to detect UTF-8
+type TcfCSVDialect struct {
+	Separator    rune
+	DecimalComma bool
+	BOM          bool
+	// DateFormat is the time layout of the dates, 2006-01-02 if not set
+	DateFormat string
+}
+
+// DefaultCSVDialect returns the RFC 4180 dialect with the ISO dates
+func DefaultCSVDialect() *TcfCSVDialect {
+	return &TcfCSVDialect{Separator: ',', DateFormat: "2006-01-02"}
+}
+
+// RUCSVDialect returns the dialect parsed by Excel, LibreOffice and Numbers in the RU locale
+func RUCSVDialect() *TcfCSVDialect {
+	return &TcfCSVDialect{Separator: ';', DecimalComma: true, BOM: true, DateFormat: "02.01.2006"}
+}
+
+type csvWriter struct {
+	*csv.Writer
+	dialect *TcfCSVDialect
+}
+
+// newCSVWriter writes the BOM if required by the dialect and returns the writer of the records
+func newCSVWriter(w io.Writer, dialect *TcfCSVDialect) (*csvWriter, error) {
+
+	if dialect == nil {
+		dialect = DefaultCSVDialect()
+	}
+
+	if dialect.BOM {
+		if _, err := io.WriteString(w, "\uFEFF"); err != nil {
+			return nil, err
+		}
+	}
+
+	writer := csv.NewWriter(w)
+	if dialect.Separator != 0 {
+		writer.Comma = dialect.Separator
+	}
+
+	return &csvWriter{Writer: writer, dialect: dialect}, nil
+}
+
+func (c *csvWriter) float(value float64, places int) string {
+	return c.decimalPoint(strconv.FormatFloat(value, 'f', places, 64))
+}
+
+func (c *csvWriter) money(amount decimal.Decimal) string {
+	return c.decimalPoint(amount.StringFixed(2))
+}
+
+func (c *csvWriter) decimalPoint(s string) string {
+	if c.dialect.DecimalComma {
+		return strings.Replace(s, ".", ",", 1)
+	}
+	return s
+}
+
+func (c *csvWriter) date(t time.Time) string {
+	if c.dialect.DateFormat == "" {
+		return t.Format("2006-01-02")
+	}
+	return t.Format(c.dialect.DateFormat)
+}
+
+// TcfCSVRenderer renders the balance items as CSV, the totals are left to the spreadsheet
+type TcfCSVRenderer struct {
+	Dialect  *TcfCSVDialect
+	Locale   TcfLocale
+	Computed []TcfComputedColumn
+}
+
+func (r TcfCSVRenderer) Render(balance *TcfPortfolioBalance, w io.Writer) error {
+
+	computed, err := compileColumns(r.Computed)
+	if err != nil {
+		return err
+	}
+
+	writer, err := newCSVWriter(w, r.Dialect)
+	if err != nil {
+		return err
+	}
+
+	header := []string{}
+	for _, title := range []string{"FIGI", "Ticker", "Name", "Currency", "Balance", "Commission", "Portfolio", "Quantity", "Dividend", "Dividend tax", "Coupon", "Coupon tax", "Repayment", "Margin fee"} {
+		header = append(header, r.Locale.Text(title))
+	}
+	for _, column := range r.Computed {
+		header = append(header, column.Header)
+	}
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+
+	for _, item := range balance.Items {
+		record := []string{
+			item.FIGI,
+			item.Ticker,
+			item.Name,
+			string(item.Currency),
+			writer.money(item.BalanceAmount),
+			writer.money(item.BrokerCommissionAmount),
+			writer.money(item.PortfolioAmount),
+			strconv.Itoa(item.PortfolioQuantity),
+			writer.money(item.DividendAmount),
+			writer.money(item.DividendTaxAmount),
+			writer.money(item.CouponAmount),
+			writer.money(item.CouponTaxAmount),
+			writer.money(item.RepaymentAmount),
+			writer.money(item.MarginFeeAmount),
+		}
+		for _, expr := range computed {
+			record = append(record, writer.money(expr.eval(exprEnv{item: item})))
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
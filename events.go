@@ -0,0 +1,94 @@
+package tinkoff
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	sdk "github.com/TinkoffCreditSystems/invest-openapi-go-sdk"
+)
+
+type TcfEarningsEvent struct {
+	FIGI   string
+	Ticker string
+	Date   time.Time
+	Title  string
+}
+
+// TcfEventsProvider is a source of upcoming corporate events (earnings dates, reports)
+type TcfEventsProvider interface {
+	EarningsDates(ctx context.Context, tickers []string, from, to time.Time) ([]TcfEarningsEvent, error)
+}
+
+// GetUpcomingEarnings returns the earnings events of the held stocks for the given number of days ahead
+func (acc *TcfAccount) GetUpcomingEarnings(ctx context.Context, provider TcfEventsProvider, days int) ([]TcfEarningsEvent, error) {
+
+	ctx, cancel := context.WithTimeout(ctx, acc.calculationTimeoutOr(20*time.Second))
+	defer cancel()
+
+	figiByTicker, err := acc.heldTickers(ctx, sdk.InstrumentTypeStock)
+	if err != nil {
+		return nil, err
+	}
+
+	tickers := []string{}
+	for ticker := range figiByTicker {
+		tickers = append(tickers, ticker)
+	}
+
+	if len(tickers) == 0 {
+		return []TcfEarningsEvent{}, nil
+	}
+
+	from := time.Now().Truncate(24 * time.Hour)
+	to := from.Add(time.Duration(days) * 24 * time.Hour)
+
+	events, err := provider.EarningsDates(ctx, tickers, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range events {
+		if events[i].FIGI == "" {
+			events[i].FIGI = figiByTicker[events[i].Ticker]
+		}
+	}
+
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Date.Before(events[j].Date)
+	})
+
+	return events, nil
+}
+
+// heldTickers returns FIGIs of the portfolio positions keyed by ticker, optionally limited to the given instrument types
+func (acc *TcfAccount) heldTickers(ctx context.Context, instrumentTypes ...sdk.InstrumentType) (map[string]string, error) {
+
+	var portfolio sdk.Portfolio
+	err := acc.call(ctx, 20*time.Second, func(ctx context.Context) (err error) {
+		portfolio, err = acc.Client.Portfolio(ctx, acc.accountID(""))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	res := make(map[string]string)
+	for _, p := range portfolio.Positions {
+		if len(instrumentTypes) > 0 && !containsInstrumentType(instrumentTypes, p.InstrumentType) {
+			continue
+		}
+		res[p.Ticker] = p.FIGI
+	}
+
+	return res, nil
+}
+
+func containsInstrumentType(slice []sdk.InstrumentType, item sdk.InstrumentType) bool {
+	for _, elem := range slice {
+		if elem == item {
+			return true
+		}
+	}
+	return false
+}
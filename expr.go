@@ -0,0 +1,505 @@
+package tinkoff
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"unicode"
+
+	"github.com/shopspring/decimal"
+)
+
+// TcfComputedColumn is a report column calculated by the arithmetic expression over the TcfBalanceItem fields,
+// e.g. "(RealizedPnL + UnrealizedPnL) / PortfolioQuantity". The amount, quantity and percent fields are supported
+// with + - * / and the parentheses, the division by zero gives zero
+type TcfComputedColumn struct {
+	Header     string
+	Expression string
+}
+
+// Validate checks the expression is correct
+func (c TcfComputedColumn) Validate() error {
+	_, err := c.compile()
+	return err
+}
+
+// Value calculates the expression for the item, the expression is parsed on every call
+func (c TcfComputedColumn) Value(item *TcfBalanceItem) (decimal.Decimal, error) {
+
+	expr, err := c.compile()
+	if err != nil {
+		return decimal.Zero, err
+	}
+
+	return expr.eval(exprEnv{item: item}), nil
+}
+
+func (c TcfComputedColumn) compile() (exprNode, error) {
+
+	expr, err := compileExpression(c.Expression)
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("Column %q: %s", c.Header, err))
+	}
+
+	return expr, nil
+}
+
+// compileColumns parses the expressions of the columns once for the render, the first incorrect one fails it
+func compileColumns(columns []TcfComputedColumn) ([]exprNode, error) {
+
+	res := []exprNode{}
+	for _, column := range columns {
+		expr, err := column.compile()
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, expr)
+	}
+
+	return res, nil
+}
+
+// computedReportColumn renders the value of the compiled expression as an amount
+func computedReportColumn(header string, expr exprNode) reportColumn {
+	return reportColumn{
+		header: header,
+		cell: func(item *TcfBalanceItem, f reportFormatter) interface{} {
+			return f.money(expr.eval(exprEnv{item: item}))
+		},
+	}
+}
+
+// exprEnv is the data the expression is evaluated with: the balance item of the report column
+// or the values of the function calls of the alert condition
+type exprEnv struct {
+	item  *TcfBalanceItem
+	calls map[string]decimal.Decimal
+}
+
+// exprNode is the node of the compiled expression, the conditions are one if true and zero if false
+type exprNode interface {
+	eval(env exprEnv) decimal.Decimal
+}
+
+type exprNumber struct {
+	value decimal.Decimal
+}
+
+func (n exprNumber) eval(_ exprEnv) decimal.Decimal {
+	return n.value
+}
+
+type exprField struct {
+	index int
+}
+
+func (n exprField) eval(env exprEnv) decimal.Decimal {
+
+	switch v := reflect.ValueOf(env.item).Elem().Field(n.index).Interface().(type) {
+	case decimal.Decimal:
+		return v
+	case int:
+		return decimal.NewFromInt(int64(v))
+	case float64:
+		return decimal.NewFromFloat(v)
+	}
+
+	return decimal.Zero
+}
+
+type exprNegate struct {
+	operand exprNode
+}
+
+func (n exprNegate) eval(env exprEnv) decimal.Decimal {
+	return n.operand.eval(env).Neg()
+}
+
+type exprBinary struct {
+	op          rune
+	left, right exprNode
+}
+
+func (n exprBinary) eval(env exprEnv) decimal.Decimal {
+
+	left, right := n.left.eval(env), n.right.eval(env)
+
+	switch n.op {
+	case '+':
+		return left.Add(right)
+	case '-':
+		return left.Sub(right)
+	case '*':
+		return left.Mul(right)
+	default:
+		if right.IsZero() {
+			return decimal.Zero
+		}
+		return left.Div(right)
+	}
+}
+
+// exprCall is the call of the function the value of which is looked up in the environment by the key
+type exprCall struct {
+	key string
+}
+
+func (n exprCall) eval(env exprEnv) decimal.Decimal {
+	return env.calls[n.key]
+}
+
+type exprCompare struct {
+	op          string
+	left, right exprNode
+}
+
+func (n exprCompare) eval(env exprEnv) decimal.Decimal {
+
+	c := n.left.eval(env).Cmp(n.right.eval(env))
+
+	var res bool
+	switch n.op {
+	case "<":
+		res = c < 0
+	case "<=":
+		res = c <= 0
+	case ">":
+		res = c > 0
+	case ">=":
+		res = c >= 0
+	case "==":
+		res = c == 0
+	default:
+		res = c != 0
+	}
+
+	return exprBool(res)
+}
+
+type exprLogical struct {
+	op          string
+	left, right exprNode
+}
+
+func (n exprLogical) eval(env exprEnv) decimal.Decimal {
+
+	left := !n.left.eval(env).IsZero()
+	if n.op == "&&" && !left || n.op == "||" && left {
+		return exprBool(left)
+	}
+
+	return exprBool(!n.right.eval(env).IsZero())
+}
+
+type exprNot struct {
+	operand exprNode
+}
+
+func (n exprNot) eval(env exprEnv) decimal.Decimal {
+	return exprBool(n.operand.eval(env).IsZero())
+}
+
+func exprBool(b bool) decimal.Decimal {
+	if b {
+		return decimal.NewFromInt(1)
+	}
+	return decimal.Zero
+}
+
+// exprParser is the recursive descent parser of the expressions:
+//
+//	or      = and { "||" and }
+//	and     = compare { "&&" compare }
+//	compare = expr [ ("<" | "<=" | ">" | ">=" | "==" | "!=") expr ]
+//	expr    = term { ("+" | "-") term }
+//	term    = factor { ("*" | "/") factor }
+//	factor  = "-" factor | "!" factor | number | field | call | "(" or ")"
+//	call    = name "(" [ argument { "," argument } ] ")"
+//
+// the arguments of the calls are the numbers and the quoted strings
+type exprParser struct {
+	tokens []string
+	pos    int
+	// field resolves the name, call resolves the function call, nil if not supported
+	field func(name string) (exprNode, error)
+	call  func(name string, args []string) (exprNode, error)
+}
+
+// compileExpression compiles the expression over the fields of TcfBalanceItem
+func compileExpression(expression string) (exprNode, error) {
+	return compile(expression, &exprParser{field: balanceItemField})
+}
+
+func compile(expression string, p *exprParser) (exprNode, error) {
+
+	tokens, err := tokenizeExpression(expression)
+	if err != nil {
+		return nil, err
+	}
+
+	p.tokens = tokens
+	node, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.pos < len(p.tokens) {
+		return nil, errors.New(fmt.Sprintf("Unexpected %q in expression %q", p.tokens[p.pos], expression))
+	}
+
+	return node, nil
+}
+
+func tokenizeExpression(expression string) ([]string, error) {
+
+	tokens := []string{}
+	runes := []rune(expression)
+
+	for i := 0; i < len(runes); {
+
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case i+1 < len(runes) && exprOperators[string(runes[i:i+2])]:
+			tokens = append(tokens, string(runes[i:i+2]))
+			i += 2
+		case strings.ContainsRune("+-*/()<>!,", r):
+			tokens = append(tokens, string(r))
+			i++
+		case r == '\'' || r == '"':
+			j := i + 1
+			for j < len(runes) && runes[j] != r {
+				j++
+			}
+			if j == len(runes) {
+				return nil, errors.New(fmt.Sprintf("Unterminated string in expression %q", expression))
+			}
+			tokens = append(tokens, string(runes[i:j+1]))
+			i = j + 1
+		case unicode.IsDigit(r) || r == '.' || unicode.IsLetter(r) || r == '_':
+			j := i
+			for j < len(runes) && (unicode.IsDigit(runes[j]) || runes[j] == '.' || unicode.IsLetter(runes[j]) || runes[j] == '_') {
+				j++
+			}
+			tokens = append(tokens, string(runes[i:j]))
+			i = j
+		default:
+			return nil, errors.New(fmt.Sprintf("Unexpected %q in expression %q", string(r), expression))
+		}
+	}
+
+	if len(tokens) == 0 {
+		return nil, errors.New("Empty expression")
+	}
+
+	return tokens, nil
+}
+
+// exprOperators are the operators of two characters
+var exprOperators = map[string]bool{"<=": true, ">=": true, "==": true, "!=": true, "&&": true, "||": true}
+
+func (p *exprParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *exprParser) or() (exprNode, error) {
+
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peek() == "||" {
+		p.pos++
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		left = exprLogical{op: "||", left: left, right: right}
+	}
+
+	return left, nil
+}
+
+func (p *exprParser) and() (exprNode, error) {
+
+	left, err := p.compare()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peek() == "&&" {
+		p.pos++
+		right, err := p.compare()
+		if err != nil {
+			return nil, err
+		}
+		left = exprLogical{op: "&&", left: left, right: right}
+	}
+
+	return left, nil
+}
+
+func (p *exprParser) compare() (exprNode, error) {
+
+	left, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+
+	switch op := p.peek(); op {
+	case "<", "<=", ">", ">=", "==", "!=":
+		p.pos++
+		right, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		return exprCompare{op: op, left: left, right: right}, nil
+	}
+
+	return left, nil
+}
+
+func (p *exprParser) expr() (exprNode, error) {
+
+	left, err := p.term()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peek() == "+" || p.peek() == "-" {
+		op := rune(p.peek()[0])
+		p.pos++
+		right, err := p.term()
+		if err != nil {
+			return nil, err
+		}
+		left = exprBinary{op: op, left: left, right: right}
+	}
+
+	return left, nil
+}
+
+func (p *exprParser) term() (exprNode, error) {
+
+	left, err := p.factor()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.peek() == "*" || p.peek() == "/" {
+		op := rune(p.peek()[0])
+		p.pos++
+		right, err := p.factor()
+		if err != nil {
+			return nil, err
+		}
+		left = exprBinary{op: op, left: left, right: right}
+	}
+
+	return left, nil
+}
+
+func (p *exprParser) factor() (exprNode, error) {
+
+	token := p.peek()
+	if token == "" {
+		return nil, errors.New("Unexpected end of expression")
+	}
+	p.pos++
+
+	switch {
+	case token == "-":
+		operand, err := p.factor()
+		if err != nil {
+			return nil, err
+		}
+		return exprNegate{operand: operand}, nil
+	case token == "!":
+		operand, err := p.factor()
+		if err != nil {
+			return nil, err
+		}
+		return exprNot{operand: operand}, nil
+	case token == "(":
+		node, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ")" {
+			return nil, errors.New("Missing closing parenthesis")
+		}
+		p.pos++
+		return node, nil
+	case unicode.IsDigit(rune(token[0])) || token[0] == '.':
+		value, err := decimal.NewFromString(token)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("Invalid number %q", token))
+		}
+		return exprNumber{value: value}, nil
+	case (unicode.IsLetter([]rune(token)[0]) || token[0] == '_') && p.peek() == "(":
+		return p.callOf(token)
+	case unicode.IsLetter([]rune(token)[0]) || token[0] == '_':
+		if p.field == nil {
+			return nil, errors.New(fmt.Sprintf("Unknown name %q", token))
+		}
+		return p.field(token)
+	}
+
+	return nil, errors.New(fmt.Sprintf("Unexpected %q", token))
+}
+
+// callOf parses the arguments of the function call, the opening parenthesis is the current token
+func (p *exprParser) callOf(name string) (exprNode, error) {
+
+	if p.call == nil {
+		return nil, errors.New(fmt.Sprintf("Unknown function %q", name))
+	}
+	p.pos++
+
+	args := []string{}
+	for p.peek() != ")" {
+
+		if len(args) > 0 {
+			if p.peek() != "," {
+				return nil, errors.New(fmt.Sprintf("Missing comma in the arguments of %s", name))
+			}
+			p.pos++
+		}
+
+		arg := p.peek()
+		switch {
+		case arg == "":
+			return nil, errors.New("Missing closing parenthesis")
+		case arg[0] == '\'' || arg[0] == '"':
+			args = append(args, arg[1:len(arg)-1])
+		case unicode.IsDigit(rune(arg[0])) || arg[0] == '.':
+			args = append(args, arg)
+		default:
+			return nil, errors.New(fmt.Sprintf("Unexpected %q in the arguments of %s", arg, name))
+		}
+		p.pos++
+	}
+	p.pos++
+
+	return p.call(name, args)
+}
+
+// balanceItemField resolves the numeric field of TcfBalanceItem by the name
+func balanceItemField(name string) (exprNode, error) {
+
+	field, ok := reflect.TypeOf(TcfBalanceItem{}).FieldByName(name)
+	if ok && len(field.Index) == 1 {
+		switch field.Type {
+		case reflect.TypeOf(decimal.Decimal{}), reflect.TypeOf(0), reflect.TypeOf(0.0):
+			return exprField{index: field.Index[0]}, nil
+		}
+	}
+
+	return nil, errors.New(fmt.Sprintf("Unknown numeric field %q", name))
+}
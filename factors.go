@@ -0,0 +1,202 @@
+package tinkoff
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// TcfFactor is a long-short proxy of a style factor, e.g. the size factor as a small caps ETF minus a large caps ETF
+// or the value factor as a value ETF minus a growth ETF. The daily factor return is the return of the long
+// instrument minus the return of the short one, minus the benchmark return if the short one is not set
+type TcfFactor struct {
+	Name      string
+	LongFIGI  string
+	ShortFIGI string
+}
+
+type TcfFactorExposureRequest struct {
+	AccountID  string
+	PeriodFrom time.Time
+	PeriodTo   time.Time
+	// Benchmark is the market index instrument, the portfolio positions of its currency are analysed
+	Benchmark string
+	Factors   []TcfFactor
+}
+
+// TcfFactorExposure is the regression of the daily portfolio returns on the market and the factor returns
+type TcfFactorExposure struct {
+	Benchmark string
+	Currency  TcfCurrency
+	// Beta is the market loading net of the factors
+	Beta float64
+	// Loadings are the factor loadings by the factor name
+	Loadings map[string]float64
+	// Alpha is the annualized return not explained by the market and the factors, in percents
+	Alpha    float64
+	RSquared float64
+	// Days is the number of the trading days the regression is calculated on
+	Days int
+}
+
+// GetFactorExposure estimates the market beta and the loadings of the factors of the positions in the benchmark's
+// currency. The days the benchmark price has not changed (weekends, holidays) are skipped
+func (acc *TcfAccount) GetFactorExposure(ctx context.Context, request *TcfFactorExposureRequest) (*TcfFactorExposure, error) {
+
+	instrument, err := acc.GetByFigi(ctx, request.Benchmark)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &TcfFactorExposure{Benchmark: request.Benchmark, Currency: TcfCurrency(instrument.Currency), Loadings: make(map[string]float64)}
+
+	portfolio, market, times, err := acc.benchmarkReturns(ctx, &TcfBenchmarkRequest{
+		AccountID:  request.AccountID,
+		PeriodFrom: request.PeriodFrom,
+		PeriodTo:   request.PeriodTo,
+		FIGI:       request.Benchmark,
+	}, res.Currency)
+	if err != nil {
+		return nil, err
+	}
+	if portfolio == nil {
+		return nil, errors.New(fmt.Sprintf("No positions in %s during the period", res.Currency))
+	}
+
+	from := request.PeriodFrom.AddDate(0, 0, -7)
+	returns := func(figi string) ([]float64, error) {
+		candles, err := acc.dailyCandles(ctx, figi, from, request.PeriodTo)
+		if err != nil {
+			return nil, err
+		}
+		return candleReturns(candles, times), nil
+	}
+
+	factors := [][]float64{market}
+	for _, factor := range request.Factors {
+
+		long, err := returns(factor.LongFIGI)
+		if err != nil {
+			return nil, err
+		}
+
+		short := market
+		if factor.ShortFIGI != "" {
+			if short, err = returns(factor.ShortFIGI); err != nil {
+				return nil, err
+			}
+		}
+
+		spread := make([]float64, len(long))
+		for i := range long {
+			spread[i] = long[i] - short[i]
+		}
+		factors = append(factors, spread)
+	}
+
+	// the rows of the trading days
+	y, x := []float64{}, [][]float64{}
+	for i := range market {
+		if market[i] == 0 {
+			continue
+		}
+		row := []float64{1}
+		for _, factor := range factors {
+			row = append(row, factor[i])
+		}
+		y = append(y, portfolio[i])
+		x = append(x, row)
+	}
+
+	res.Days = len(y)
+	if len(y) <= len(factors)+1 {
+		return nil, errors.New(fmt.Sprintf("Not enough trading days (%d) for %d factors", len(y), len(factors)))
+	}
+
+	coefficients, rSquared, ok := regress(y, x)
+	if !ok {
+		return nil, errors.New("Factor returns are collinear")
+	}
+
+	res.Alpha = math.Round(10000*coefficients[0]*252) / 100
+	res.Beta = math.Round(100*coefficients[1]) / 100
+	for i, factor := range request.Factors {
+		res.Loadings[factor.Name] = math.Round(100*coefficients[i+2]) / 100
+	}
+	res.RSquared = math.Round(100*rSquared) / 100
+
+	return res, nil
+}
+
+// regress returns the least squares coefficients of y on the columns of x and the R², false if the columns are collinear
+func regress(y []float64, x [][]float64) ([]float64, float64, bool) {
+
+	n := len(x[0])
+
+	// the normal equations XᵀX b = Xᵀy as the augmented matrix
+	a := make([][]float64, n)
+	for i := range a {
+		a[i] = make([]float64, n+1)
+		for k := range x {
+			for j := 0; j < n; j++ {
+				a[i][j] += x[k][i] * x[k][j]
+			}
+			a[i][n] += x[k][i] * y[k]
+		}
+	}
+
+	// Gaussian elimination with partial pivoting
+	for col := 0; col < n; col++ {
+
+		pivot := col
+		for row := col + 1; row < n; row++ {
+			if math.Abs(a[row][col]) > math.Abs(a[pivot][col]) {
+				pivot = row
+			}
+		}
+		if math.Abs(a[pivot][col]) < 1e-12 {
+			return nil, 0, false
+		}
+		a[col], a[pivot] = a[pivot], a[col]
+
+		for row := 0; row < n; row++ {
+			if row == col {
+				continue
+			}
+			factor := a[row][col] / a[col][col]
+			for j := col; j <= n; j++ {
+				a[row][j] -= factor * a[col][j]
+			}
+		}
+	}
+
+	coefficients := make([]float64, n)
+	for i := range coefficients {
+		coefficients[i] = a[i][n] / a[i][i]
+	}
+
+	mean := 0.0
+	for _, v := range y {
+		mean += v
+	}
+	mean /= float64(len(y))
+
+	residual, total := 0.0, 0.0
+	for k := range y {
+		fitted := 0.0
+		for j := 0; j < n; j++ {
+			fitted += coefficients[j] * x[k][j]
+		}
+		residual += (y[k] - fitted) * (y[k] - fitted)
+		total += (y[k] - mean) * (y[k] - mean)
+	}
+
+	rSquared := 0.0
+	if total > 0 {
+		rSquared = 1 - residual/total
+	}
+
+	return coefficients, rSquared, true
+}
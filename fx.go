@@ -0,0 +1,195 @@
+package tinkoff
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/shopspring/decimal"
+	"golang.org/x/text/encoding/charmap"
+)
+
+// TcfFXProvider returns the official exchange rates
+type TcfFXProvider interface {
+	// Rate returns the roubles for one unit of the currency on the date
+	Rate(ctx context.Context, currency TcfCurrency, date time.Time) (decimal.Decimal, error)
+}
+
+const cbrDailyURL = "https://www.cbr.ru/scripts/XML_daily.asp"
+
+// TcfCBRProvider takes the rates of the Central Bank of Russia, the rates are cached by date
+type TcfCBRProvider struct {
+	Client  *http.Client
+	BaseURL string
+
+	mu    sync.Mutex
+	rates map[string]map[TcfCurrency]decimal.Decimal
+}
+
+func NewCBRProvider() *TcfCBRProvider {
+	return &TcfCBRProvider{
+		Client:  &http.Client{Timeout: 10 * time.Second},
+		BaseURL: cbrDailyURL,
+		rates:   make(map[string]map[TcfCurrency]decimal.Decimal),
+	}
+}
+
+type cbrValCurs struct {
+	Date    string `xml:"Date,attr"`
+	Valutes []struct {
+		CharCode string `xml:"CharCode"`
+		Nominal  string `xml:"Nominal"`
+		Value    string `xml:"Value"`
+	} `xml:"Valute"`
+}
+
+func (p *TcfCBRProvider) Rate(ctx context.Context, currency TcfCurrency, date time.Time) (decimal.Decimal, error) {
+
+	if currency == CurrencyRUB {
+		return decimal.NewFromInt(1), nil
+	}
+
+	// CBR returns the last set rate for weekends and holidays
+	day := date.Format("02/01/2006")
+
+	p.mu.Lock()
+	rates, ok := p.rates[day]
+	p.mu.Unlock()
+
+	if !ok {
+		var err error
+		rates, err = p.fetch(ctx, day)
+		if err != nil {
+			return decimal.Zero, err
+		}
+
+		p.mu.Lock()
+		p.rates[day] = rates
+		p.mu.Unlock()
+	}
+
+	rate, ok := rates[currency]
+	if !ok {
+		return decimal.Zero, errors.New(fmt.Sprintf("CBR rate of %s on %s not found", currency, date.Format("2006-01-02")))
+	}
+
+	return rate, nil
+}
+
+func (p *TcfCBRProvider) fetch(ctx context.Context, day string) (map[TcfCurrency]decimal.Decimal, error) {
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.BaseURL+"?date_req="+day, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.New(fmt.Sprintf("CBR responded with %s", resp.Status))
+	}
+
+	// CBR responds in windows-1251
+	decoder := xml.NewDecoder(resp.Body)
+	decoder.CharsetReader = func(charset string, input io.Reader) (io.Reader, error) {
+		if strings.EqualFold(charset, "windows-1251") {
+			return charmap.Windows1251.NewDecoder().Reader(input), nil
+		}
+		return nil, errors.New(fmt.Sprintf("Unsupported charset %s", charset))
+	}
+
+	var curs cbrValCurs
+	if err := decoder.Decode(&curs); err != nil {
+		return nil, err
+	}
+
+	rates := make(map[TcfCurrency]decimal.Decimal)
+	for _, v := range curs.Valutes {
+
+		value, err := decimal.NewFromString(strings.Replace(v.Value, ",", ".", 1))
+		if err != nil {
+			return nil, err
+		}
+
+		nominal, err := decimal.NewFromString(v.Nominal)
+		if err != nil || !nominal.IsPositive() {
+			return nil, errors.New(fmt.Sprintf("Invalid CBR nominal %q of %s", v.Nominal, v.CharCode))
+		}
+
+		rates[TcfCurrency(v.CharCode)] = value.Div(nominal)
+	}
+
+	return rates, nil
+}
+
+// WithFXProvider makes the tax calculations convert the amounts to roubles at the rates on the operation dates
+func WithFXProvider(provider TcfFXProvider) TcfOption {
+	return func(acc *TcfAccount) {
+		acc.fx = provider
+	}
+}
+
+// Convert converts the amount between the currencies at the rates on the date
+func Convert(ctx context.Context, provider TcfFXProvider, amount decimal.Decimal, from, to TcfCurrency, date time.Time) (decimal.Decimal, error) {
+
+	if from == to {
+		return amount, nil
+	}
+
+	fromRate, err := provider.Rate(ctx, from, date)
+	if err != nil {
+		return decimal.Zero, err
+	}
+
+	toRate, err := provider.Rate(ctx, to, date)
+	if err != nil {
+		return decimal.Zero, err
+	}
+
+	return amount.Mul(fromRate).Div(toRate), nil
+}
+
+// toRoubles converts the realized gains to roubles, the cost is converted at the rate on the purchase date
+// and the proceeds at the rate on the sale date as required for the tax
+func toRoubles(ctx context.Context, provider TcfFXProvider, gains []*TcfRealizedGain) ([]*TcfRealizedGain, error) {
+
+	res := []*TcfRealizedGain{}
+
+	for _, gain := range gains {
+
+		if gain.Currency == CurrencyRUB {
+			res = append(res, gain)
+			continue
+		}
+
+		buyRate, err := provider.Rate(ctx, gain.Currency, gain.OpenedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		sellRate, err := provider.Rate(ctx, gain.Currency, gain.ClosedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		converted := *gain
+		converted.Currency = CurrencyRUB
+		converted.BuyPrice = gain.BuyPrice.Mul(buyRate)
+		converted.SellPrice = gain.SellPrice.Mul(sellRate)
+		converted.GainAmount = converted.SellPrice.Sub(converted.BuyPrice).Mul(decimal.NewFromInt(int64(gain.Quantity)))
+
+		res = append(res, &converted)
+	}
+
+	return res, nil
+}
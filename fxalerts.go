@@ -0,0 +1,123 @@
+package tinkoff
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"time"
+
+	sdk "github.com/TinkoffCreditSystems/invest-openapi-go-sdk"
+)
+
+// TcfFXAlertRule watches the exchange rate of the currency to the rouble on the exchange (the TOM instrument).
+// Zero fields are not checked
+type TcfFXAlertRule struct {
+	Currency TcfCurrency
+	// Above triggers when the rate crosses the level upwards since the previous day close
+	Above float64
+	// Below triggers when the rate crosses the level downwards since the previous day close
+	Below float64
+	// MaxIntradayMove triggers when the rate moves from the day open by more percents in either direction
+	MaxIntradayMove float64
+}
+
+// TcfFXAlert is a triggered rule
+type TcfFXAlert struct {
+	Currency  TcfCurrency `report:"Currency"`
+	Rate      float64     `report:"Rate"`
+	PrevClose float64     `report:"Previous close"`
+	Open      float64     `report:"Open"`
+	Message   string      `report:"Alert"`
+}
+
+// CheckFXAlerts checks the rules against the current rates and returns the triggered ones
+func (acc *TcfAccount) CheckFXAlerts(ctx context.Context, rules []*TcfFXAlertRule) ([]*TcfFXAlert, error) {
+
+	instruments, err := acc.GetInstruments(ctx, &TcfInstrumentsRequest{Type: sdk.InstrumentTypeCurrency})
+	if err != nil {
+		return nil, err
+	}
+
+	res := []*TcfFXAlert{}
+	now := time.Now()
+
+	for _, rule := range rules {
+
+		figi := currencyFIGI(instruments, rule.Currency)
+		if figi == "" {
+			return nil, errors.New(fmt.Sprintf("Exchange instrument of %s not found", rule.Currency))
+		}
+
+		candles, err := acc.dailyCandles(ctx, figi, now.AddDate(0, 0, -7), now)
+		if err != nil {
+			return nil, err
+		}
+
+		rate, err := acc.GetCurrentPrice(ctx, figi)
+		if err != nil {
+			return nil, err
+		}
+
+		res = append(res, fxAlerts(rule, candles, rate, now)...)
+	}
+
+	return res, nil
+}
+
+// currencyFIGI returns the FIGI of the TOM instrument of the currency, the tickers start with the currency code
+// (USD000UTSTOM, EUR_RUB__TOM, CNYRUB_TOM)
+func currencyFIGI(instruments []sdk.Instrument, currency TcfCurrency) string {
+
+	for _, instrument := range instruments {
+		if strings.HasPrefix(instrument.Ticker, string(currency)) && strings.HasSuffix(instrument.Ticker, "TOM") {
+			return instrument.FIGI
+		}
+	}
+
+	return ""
+}
+
+// fxAlerts checks the rule, the last daily candle is the today's one if it started less than a day ago
+func fxAlerts(rule *TcfFXAlertRule, candles []sdk.Candle, rate float64, now time.Time) []*TcfFXAlert {
+
+	if len(candles) == 0 || rate == 0 {
+		return nil
+	}
+
+	last := candles[len(candles)-1]
+	prevClose, open := last.ClosePrice, rate
+	if now.Sub(last.TS) < 24*time.Hour {
+		open = last.OpenPrice
+		prevClose = closeBefore(candles, last.TS)
+	}
+
+	res := []*TcfFXAlert{}
+	alert := func(message string) {
+		res = append(res, &TcfFXAlert{Currency: rule.Currency, Rate: rate, PrevClose: prevClose, Open: open, Message: message})
+	}
+
+	if rule.Above > 0 && prevClose > 0 && prevClose < rule.Above && rate >= rule.Above {
+		alert(fmt.Sprintf("%s/RUB crossed above %.4f", rule.Currency, rule.Above))
+	}
+
+	if rule.Below > 0 && prevClose > rule.Below && rate <= rule.Below {
+		alert(fmt.Sprintf("%s/RUB crossed below %.4f", rule.Currency, rule.Below))
+	}
+
+	if rule.MaxIntradayMove > 0 && open > 0 {
+		move := 100 * (rate - open) / open
+		if math.Abs(move) > rule.MaxIntradayMove {
+			alert(fmt.Sprintf("%s/RUB moved %+.2f%% since the open", rule.Currency, move))
+		}
+	}
+
+	return res
+}
+
+// PrintFXAlerts prints the triggered exchange rate alerts
+func PrintFXAlerts(w io.Writer, alerts []*TcfFXAlert) {
+	RenderTable(w, alerts)
+}
@@ -0,0 +1,122 @@
+package tinkoff
+
+import (
+	"encoding/json"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// TcfHeatmapDay is a cell of the calendar heatmap of the daily P&L
+type TcfHeatmapDay struct {
+	Date    time.Time    `json:"date"`
+	Week    int          `json:"week"`    // column of the grid, weeks start on Monday
+	Weekday time.Weekday `json:"weekday"` // row of the grid
+	PnL     float64      `json:"pnl"`
+	// Level is the intensity from -4 (the largest loss) to 4 (the largest gain), 0 for no change or no data
+	Level int `json:"level"`
+}
+
+// DailyPnLHeatmap returns the grid of the daily changes of the value series for every day of the year.
+// The value of a day is the last value of the series on the day, the days without data have zero P&L
+func DailyPnLHeatmap(series []TcfValuePoint, year int, location *time.Location) []*TcfHeatmapDay {
+
+	points := make([]TcfValuePoint, len(series))
+	copy(points, series)
+	sort.SliceStable(points, func(i, j int) bool {
+		return points[i].Time.Before(points[j].Time)
+	})
+
+	values := make(map[time.Time]float64)
+	for _, point := range points {
+		t := point.Time.In(location)
+		values[time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, location)] = point.Value
+	}
+
+	// the P&L of the first day of the year is counted from the last value of the previous year
+	prev, hasPrev := 0.0, false
+	first := time.Date(year, time.January, 1, 0, 0, 0, 0, location)
+	for _, point := range points {
+		if !point.Time.Before(first) {
+			break
+		}
+		prev, hasPrev = point.Value, true
+	}
+
+	offset := (int(first.Weekday()) + 6) % 7
+
+	days := []*TcfHeatmapDay{}
+	maxAbs := 0.0
+
+	for date := first; date.Year() == year; date = date.AddDate(0, 0, 1) {
+
+		day := &TcfHeatmapDay{
+			Date:    date,
+			Week:    (date.YearDay() - 1 + offset) / 7,
+			Weekday: date.Weekday(),
+		}
+
+		if value, ok := values[date]; ok {
+			if hasPrev {
+				day.PnL = math.Round(100*(value-prev)) / 100
+			}
+			prev, hasPrev = value, true
+		}
+
+		maxAbs = math.Max(maxAbs, math.Abs(day.PnL))
+		days = append(days, day)
+	}
+
+	if maxAbs > 0 {
+		for _, day := range days {
+			level := int(math.Ceil(4 * math.Abs(day.PnL) / maxAbs))
+			if day.PnL < 0 {
+				level = -level
+			}
+			day.Level = level
+		}
+	}
+
+	return days
+}
+
+// WriteHeatmapJSON writes the heatmap days as a JSON array
+func WriteHeatmapJSON(w io.Writer, days []*TcfHeatmapDay) error {
+	return json.NewEncoder(w).Encode(days)
+}
+
+// WriteHeatmapCSV writes the heatmap days as CSV with a header
+func WriteHeatmapCSV(w io.Writer, days []*TcfHeatmapDay) error {
+	return WriteHeatmapCSVDialect(w, days, DefaultCSVDialect())
+}
+
+// WriteHeatmapCSVDialect writes the heatmap days as CSV in the dialect of the spreadsheet app
+func WriteHeatmapCSVDialect(w io.Writer, days []*TcfHeatmapDay, dialect *TcfCSVDialect) error {
+
+	writer, err := newCSVWriter(w, dialect)
+	if err != nil {
+		return err
+	}
+
+	if err := writer.Write([]string{"date", "week", "weekday", "pnl", "level"}); err != nil {
+		return err
+	}
+
+	for _, day := range days {
+		record := []string{
+			writer.date(day.Date),
+			strconv.Itoa(day.Week),
+			strconv.Itoa(int(day.Weekday)),
+			writer.float(day.PnL, 2),
+			strconv.Itoa(day.Level),
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
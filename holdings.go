@@ -0,0 +1,113 @@
+package tinkoff
+
+import (
+	"context"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	sdk "github.com/TinkoffCreditSystems/invest-openapi-go-sdk"
+	"github.com/mikhailbolshakov/tinkoff/utils"
+	"github.com/shopspring/decimal"
+)
+
+// TcfHolding is a position held at the date
+type TcfHolding struct {
+	FIGI     string      `report:"FIGI"`
+	Ticker   string      `report:"Ticker"`
+	Name     string      `report:"Name"`
+	Currency TcfCurrency `report:"Currency"`
+	Quantity int         `report:"Quantity"`
+	// Price is the close price of the last daily candle on or before the date
+	Price decimal.Decimal `report:"Price"`
+	Value decimal.Decimal `report:"Value"`
+	// CostAmount is the purchase cost of the open lots
+	CostAmount decimal.Decimal `report:"Cost"`
+}
+
+// TcfHoldings is the portfolio as of the date, the free cash is not reconstructed
+type TcfHoldings struct {
+	Date  time.Time
+	Items []*TcfHolding
+	// Values is the total value of the positions by currency
+	Values map[TcfCurrency]decimal.Decimal
+}
+
+// GetHoldingsAt replays the operations up to the date and prices the open positions with the candles of the date
+func (acc *TcfAccount) GetHoldingsAt(ctx context.Context, accountID string, date time.Time) (*TcfHoldings, error) {
+
+	operations, err := acc.GetOperations(ctx, &TcfGetOperationsRequest{
+		AccountID:  accountID,
+		PeriodFrom: time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC),
+		PeriodTo:   date,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	res := &TcfHoldings{Date: date, Items: []*TcfHolding{}, Values: make(map[TcfCurrency]decimal.Decimal)}
+
+	group, ctx := acc.newGroup(ctx)
+	var mu sync.Mutex
+
+	for figi, figiOperations := range utils.ByFigi(operations) {
+
+		lots := openLots(utils.Filter(figiOperations, func(oper sdk.Operation) bool { return !oper.DateTime.After(date) }))
+		if lotsQuantity(lots) == 0 {
+			continue
+		}
+
+		figi := figi
+		group.Go(func() error {
+
+			instrument, err := acc.GetByFigi(ctx, figi)
+			if err != nil {
+				return err
+			}
+
+			price, err := acc.priceAt(ctx, figi, date)
+			if err != nil {
+				return err
+			}
+
+			holding := &TcfHolding{
+				FIGI:     figi,
+				Ticker:   instrument.Ticker,
+				Name:     instrument.Name,
+				Currency: TcfCurrency(instrument.Currency),
+				Quantity: lotsQuantity(lots),
+				Price:    money(price),
+			}
+			holding.Value = holding.Price.Mul(decimal.NewFromInt(int64(holding.Quantity)))
+			for _, lot := range lots {
+				holding.CostAmount = holding.CostAmount.Add(lot.CostAmount())
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			res.Items = append(res.Items, holding)
+			res.Values[holding.Currency] = res.Values[holding.Currency].Add(holding.Value)
+			return nil
+		})
+	}
+
+	if err := group.Wait(); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(res.Items, func(i, j int) bool {
+		if res.Items[i].Ticker != res.Items[j].Ticker {
+			return res.Items[i].Ticker < res.Items[j].Ticker
+		}
+		return res.Items[i].FIGI < res.Items[j].FIGI
+	})
+
+	return res, nil
+}
+
+// PrintHoldings prints the positions held at the date
+func PrintHoldings(w io.Writer, holdings *TcfHoldings) {
+	RenderTable(w, holdings.Items)
+}
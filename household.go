@@ -0,0 +1,147 @@
+package tinkoff
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/mikhailbolshakov/tinkoff/utils"
+	"github.com/shopspring/decimal"
+)
+
+// TcfHouseholdMember is an account of one owner of the household
+type TcfHouseholdMember struct {
+	Owner     string
+	Account   *TcfAccount
+	AccountID string
+	// Statement is the owner's bank statement the transfers of the account are labeled from
+	Statement []*TcfStatementEntry
+}
+
+// TcfHousehold combines the accounts of different owners for the cash-flow views only,
+// the taxes are calculated strictly per owner
+type TcfHousehold struct {
+	Members       []*TcfHouseholdMember
+	TransferRules []TcfTransferRule
+}
+
+// TcfHouseholdCashFlow is the cash flow of one month in one currency, the amounts are broken down by owner
+type TcfHouseholdCashFlow struct {
+	Month    time.Time
+	Currency TcfCurrency
+	// Owners lists the owners contributed to the row, the amounts below are the household totals
+	Owners         []string
+	PayInAmount    decimal.Decimal
+	PayOutAmount   decimal.Decimal
+	IncomeAmount   decimal.Decimal
+	ExpensesAmount decimal.Decimal // commissions and taxes
+	ByOwner        map[string]decimal.Decimal
+	// TransfersByLabel are the PayIn (positive) and PayOut (negative) amounts matched with the bank statements
+	TransfersByLabel map[string]decimal.Decimal
+}
+
+// TcfOwnerTaxEstimate labels the tax estimate with the owner, the estimates of different owners are never summed
+type TcfOwnerTaxEstimate struct {
+	Owner string
+	*TcfTaxEstimate
+}
+
+// GetCashFlow returns the combined monthly cash flow of the household accounts
+func (h *TcfHousehold) GetCashFlow(ctx context.Context, from, to time.Time) ([]*TcfHouseholdCashFlow, error) {
+
+	type key struct {
+		month    time.Time
+		currency TcfCurrency
+	}
+	flows := make(map[key]*TcfHouseholdCashFlow)
+
+	for _, member := range h.Members {
+
+		operations, err := member.Account.GetOperations(ctx, &TcfGetOperationsRequest{
+			AccountID:  member.AccountID,
+			PeriodFrom: from,
+			PeriodTo:   to,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		labels := make(map[string]string)
+		for _, transfer := range MatchTransfers(operations, member.Statement, h.TransferRules) {
+			labels[transfer.OperationID] = transfer.Label
+		}
+
+		for month, monthOperations := range utils.ByMonth(operations) {
+			for _, oper := range monthOperations {
+
+				k := key{month: month, currency: TcfCurrency(oper.Currency)}
+				flow, ok := flows[k]
+				if !ok {
+					flow = &TcfHouseholdCashFlow{Month: month, Currency: k.currency, ByOwner: make(map[string]decimal.Decimal), TransfersByLabel: make(map[string]decimal.Decimal)}
+					flows[k] = flow
+				}
+
+				amount := money(oper.Payment)
+
+				switch utils.Category(oper.OperationType) {
+				case utils.CategoryCashFlow:
+					if amount.IsPositive() {
+						flow.PayInAmount = flow.PayInAmount.Add(amount)
+					} else {
+						flow.PayOutAmount = flow.PayOutAmount.Add(amount.Neg())
+					}
+					if label := labels[oper.ID]; label != "" {
+						flow.TransfersByLabel[label] = flow.TransfersByLabel[label].Add(amount)
+					}
+				case utils.CategoryIncome:
+					flow.IncomeAmount = flow.IncomeAmount.Add(amount)
+				case utils.CategoryCommission, utils.CategoryTax:
+					flow.ExpensesAmount = flow.ExpensesAmount.Sub(amount)
+				default:
+					continue
+				}
+
+				if _, ok := flow.ByOwner[member.Owner]; !ok {
+					flow.Owners = append(flow.Owners, member.Owner)
+				}
+				flow.ByOwner[member.Owner] = flow.ByOwner[member.Owner].Add(amount)
+			}
+		}
+	}
+
+	res := []*TcfHouseholdCashFlow{}
+	for _, flow := range flows {
+		if len(flow.Owners) > 0 {
+			res = append(res, flow)
+		}
+	}
+
+	sort.SliceStable(res, func(i, j int) bool {
+		if !res[i].Month.Equal(res[j].Month) {
+			return res[i].Month.Before(res[j].Month)
+		}
+		return res[i].Currency < res[j].Currency
+	})
+
+	return res, nil
+}
+
+// EstimateYearEndTax estimates the tax of every owner separately
+func (h *TcfHousehold) EstimateYearEndTax(ctx context.Context) ([]*TcfOwnerTaxEstimate, error) {
+
+	res := []*TcfOwnerTaxEstimate{}
+
+	for _, member := range h.Members {
+
+		estimates, err := member.Account.EstimateYearEndTax(ctx, member.AccountID)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, estimate := range estimates {
+			res = append(res, &TcfOwnerTaxEstimate{Owner: member.Owner, TcfTaxEstimate: estimate})
+		}
+	}
+
+	return res, nil
+}
@@ -0,0 +1,242 @@
+package tinkoff
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+
+	"github.com/shopspring/decimal"
+)
+
+// htmlAmount is the amount formatted for the locale with the plain value to sort by
+type htmlAmount struct {
+	Text  string
+	Value string
+}
+
+type htmlBalanceRow struct {
+	FIGI       string
+	Ticker     string
+	Name       string
+	Currency   TcfCurrency
+	Balance    htmlAmount
+	Negative   bool
+	Commission htmlAmount
+	Portfolio  htmlAmount
+	Dividend   htmlAmount
+	MarginFee  htmlAmount
+	Computed   []htmlAmount
+}
+
+type htmlBalanceTotal struct {
+	Currency  TcfCurrency
+	Balance   string
+	Negative  bool
+	Portfolio string
+	Note      string
+}
+
+type htmlHeatmapCell struct {
+	Title string
+	Class string
+}
+
+var balanceHTML = template.Must(template.New("balance").Parse(`<!DOCTYPE html>
+<html lang="{{.Lang}}">
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: Arial, Helvetica, sans-serif; font-size: 14px; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; }
+th { background: #f0f0f0; cursor: pointer; }
+td.amount { text-align: right; }
+.positive { color: #080; }
+.negative { color: #c00; }
+tfoot td { font-weight: bold; }
+table.heatmap { margin-top: 16px; }
+table.heatmap td { width: 10px; height: 10px; padding: 0; border: 1px solid #fff; background: #ebedf0; }
+table.heatmap td.empty { background: none; }
+table.heatmap td.g1 { background: #c6e48b; } table.heatmap td.g2 { background: #7bc96f; }
+table.heatmap td.g3 { background: #239a3b; } table.heatmap td.g4 { background: #196127; }
+table.heatmap td.r1 { background: #f8c4c4; } table.heatmap td.r2 { background: #ee8a8a; }
+table.heatmap td.r3 { background: #d94a4a; } table.heatmap td.r4 { background: #a11d1d; }
+</style>
+</head>
+<body>
+<table id="balance">
+<thead>
+<tr>{{range .Headers}}<th>{{.}}</th>{{end}}</tr>
+</thead>
+<tbody>
+{{- range .Rows}}
+<tr><td>{{.FIGI}}</td><td>{{.Ticker}}</td><td>{{.Name}}</td><td>{{.Currency}}</td><td class="amount {{if .Negative}}negative{{else}}positive{{end}}" data-sort="{{.Balance.Value}}">{{.Balance.Text}}</td><td class="amount" data-sort="{{.Commission.Value}}">{{.Commission.Text}}</td><td class="amount" data-sort="{{.Portfolio.Value}}">{{.Portfolio.Text}}</td><td class="amount" data-sort="{{.Dividend.Value}}">{{.Dividend.Text}}</td><td class="amount" data-sort="{{.MarginFee.Value}}">{{.MarginFee.Text}}</td>{{range .Computed}}<td class="amount" data-sort="{{.Value}}">{{.Text}}</td>{{end}}</tr>
+{{- end}}
+</tbody>
+<tfoot>
+{{- range .Totals}}
+<tr><td colspan="3">{{$.Total}}</td><td>{{.Currency}}</td><td class="amount {{if .Negative}}negative{{else}}positive{{end}}">{{.Balance}}</td><td></td><td class="amount">{{.Portfolio}}</td><td colspan="2">{{.Note}}</td>{{range $.Computed}}<td></td>{{end}}</tr>
+{{- end}}
+</tfoot>
+</table>
+{{- if .Warnings}}
+<h4>{{.WarningsTitle}}</h4>
+<ul class="warnings">
+{{- range .Warnings}}
+<li>{{.}}</li>
+{{- end}}
+</ul>
+{{- end}}
+{{- if .Heatmap}}
+<table class="heatmap">
+{{- range .Heatmap}}
+<tr>{{range .}}<td class="{{.Class}}" title="{{.Title}}"></td>{{end}}</tr>
+{{- end}}
+</table>
+{{- end}}
+<script>
+document.querySelectorAll("#balance th").forEach(function (th, col) {
+  th.addEventListener("click", function () {
+    var body = document.querySelector("#balance tbody");
+    var asc = th.dataset.order !== "asc";
+    th.dataset.order = asc ? "asc" : "desc";
+    Array.from(body.rows).sort(function (a, b) {
+      var x = a.cells[col].dataset.sort || a.cells[col].textContent;
+      var y = b.cells[col].dataset.sort || b.cells[col].textContent;
+      var nx = parseFloat(x), ny = parseFloat(y);
+      var res = isNaN(nx) || isNaN(ny) ? x.localeCompare(y) : nx - ny;
+      return asc ? res : -res;
+    }).forEach(function (row) { body.appendChild(row); });
+  });
+});
+</script>
+</body>
+</html>
+`))
+
+// RenderBalanceHTML writes the balance as a self-contained HTML page
+func RenderBalanceHTML(balance *TcfPortfolioBalance, w io.Writer) error {
+	return renderBalanceHTML(balance, nil, LocaleEN, nil, w)
+}
+
+func renderBalanceHTML(balance *TcfPortfolioBalance, heatmap []*TcfHeatmapDay, locale TcfLocale, computed []TcfComputedColumn, w io.Writer) error {
+
+	if locale == "" {
+		locale = LocaleEN
+	}
+	f := reportFormatter{locale: locale}
+
+	amount := func(value decimal.Decimal) htmlAmount {
+		return htmlAmount{Text: f.number(value, 2), Value: value.StringFixed(2)}
+	}
+
+	data := struct {
+		Lang    TcfLocale
+		Title   string
+		Headers []string
+		Total   string
+		Rows    []htmlBalanceRow
+		Totals  []htmlBalanceTotal
+		Heatmap [][]htmlHeatmapCell
+		// Computed are the headers of the computed columns
+		Computed []string
+
+		Warnings      []TcfWarning
+		WarningsTitle string
+	}{
+		Lang:          locale,
+		Title:         f.text("Portfolio balance"),
+		Total:         f.text("Total"),
+		Heatmap:       heatmapGrid(heatmap, locale),
+		Warnings:      balance.Warnings,
+		WarningsTitle: f.text("Warnings"),
+	}
+
+	for _, header := range []string{"FIGI", "Ticker", "Name", "Currency", "Balance", "Commission", "Portfolio", "Dividend", "Margin fee"} {
+		data.Headers = append(data.Headers, f.text(header))
+	}
+
+	expressions, err := compileColumns(computed)
+	if err != nil {
+		return err
+	}
+	for _, column := range computed {
+		data.Headers = append(data.Headers, column.Header)
+		data.Computed = append(data.Computed, column.Header)
+	}
+
+	for _, item := range balance.Items {
+		row := htmlBalanceRow{
+			FIGI:       item.FIGI,
+			Ticker:     item.Ticker,
+			Name:       item.Name,
+			Currency:   item.Currency,
+			Balance:    amount(item.BalanceAmount),
+			Negative:   item.BalanceAmount.IsNegative(),
+			Commission: amount(item.BrokerCommissionAmount),
+			Portfolio:  amount(item.PortfolioAmount),
+			Dividend:   amount(item.DividendAmount.Sub(item.DividendTaxAmount)),
+			MarginFee:  amount(item.MarginFeeAmount),
+		}
+		for _, expr := range expressions {
+			row.Computed = append(row.Computed, amount(expr.eval(exprEnv{item: item}).Round(2)))
+		}
+		data.Rows = append(data.Rows, row)
+	}
+
+	for _, currency := range balance.Total.SortedCurrencies() {
+		total := balance.Total.Currencies[currency]
+		data.Totals = append(data.Totals, htmlBalanceTotal{
+			Currency:  currency,
+			Balance:   f.number(total.BalanceAmount, 2),
+			Negative:  total.BalanceAmount.IsNegative(),
+			Portfolio: f.number(total.PortfolioAmount, 2),
+			Note: fmt.Sprintf(f.text("Service commission %s, tax back %s"),
+				f.number(total.ServiceCommissionAmount, 2), f.number(total.TaxBack, 2)),
+		})
+	}
+
+	return balanceHTML.Execute(w, data)
+}
+
+// heatmapGrid arranges the days by weekday rows (Monday first) and week columns
+func heatmapGrid(days []*TcfHeatmapDay, locale TcfLocale) [][]htmlHeatmapCell {
+
+	if len(days) == 0 {
+		return nil
+	}
+
+	weeks := 0
+	for _, day := range days {
+		if day.Week+1 > weeks {
+			weeks = day.Week + 1
+		}
+	}
+
+	grid := make([][]htmlHeatmapCell, 7)
+	for i := range grid {
+		grid[i] = make([]htmlHeatmapCell, weeks)
+		for j := range grid[i] {
+			grid[i][j] = htmlHeatmapCell{Class: "empty"}
+		}
+	}
+
+	for _, day := range days {
+
+		class := ""
+		if day.Level > 0 {
+			class = fmt.Sprintf("g%d", day.Level)
+		} else if day.Level < 0 {
+			class = fmt.Sprintf("r%d", -day.Level)
+		}
+
+		row := (int(day.Weekday) + 6) % 7
+		grid[row][day.Week] = htmlHeatmapCell{
+			Title: fmt.Sprintf("%s: %s", locale.Date(day.Date), reportFormatter{locale: locale}.number(decimal.NewFromFloat(day.PnL), 2)),
+			Class: class,
+		}
+	}
+
+	return grid
+}
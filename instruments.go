@@ -0,0 +1,139 @@
+package tinkoff
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	sdk "github.com/TinkoffCreditSystems/invest-openapi-go-sdk"
+)
+
+type TcfInstrumentsRequest struct {
+	Type sdk.InstrumentType
+	// ForceRefresh fetches the list from the API even if the cached one is fresh enough
+	ForceRefresh bool
+}
+
+type instrumentList struct {
+	FetchedAt   time.Time        `json:"fetchedAt"`
+	Instruments []sdk.Instrument `json:"instruments"`
+}
+
+// instrumentCache keeps the instrument lists in memory and, if the directory is set, on disk
+type instrumentCache struct {
+	mu     sync.Mutex
+	dir    string
+	maxAge time.Duration
+	lists  map[sdk.InstrumentType]*instrumentList
+}
+
+// WithInstrumentCache sets the directory the instrument lists are persisted to (empty keeps them in memory only)
+// and the age after which they are refreshed, 24 hours by default
+func WithInstrumentCache(dir string, maxAge time.Duration) TcfOption {
+	return func(acc *TcfAccount) {
+		acc.instruments.dir = dir
+		acc.instruments.maxAge = maxAge
+	}
+}
+
+func (c *instrumentCache) path(instrumentType sdk.InstrumentType) string {
+	return filepath.Join(c.dir, fmt.Sprintf("instruments_%s.json", instrumentType))
+}
+
+func (c *instrumentCache) get(instrumentType sdk.InstrumentType) *instrumentList {
+
+	if list, ok := c.lists[instrumentType]; ok {
+		return list
+	}
+
+	if c.dir == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(c.path(instrumentType))
+	if err != nil {
+		return nil
+	}
+
+	list := &instrumentList{}
+	if err := json.Unmarshal(data, list); err != nil {
+		return nil
+	}
+
+	c.lists[instrumentType] = list
+
+	return list
+}
+
+func (c *instrumentCache) put(instrumentType sdk.InstrumentType, list *instrumentList) error {
+
+	c.lists[instrumentType] = list
+
+	if c.dir == "" {
+		return nil
+	}
+
+	if err := os.MkdirAll(c.dir, 0755); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(list)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(c.path(instrumentType), data, 0644)
+}
+
+// GetInstruments returns the list of the instruments of the type, the cached list is used until it gets older than the max age
+func (acc *TcfAccount) GetInstruments(ctx context.Context, request *TcfInstrumentsRequest) ([]sdk.Instrument, error) {
+
+	fetch := map[sdk.InstrumentType]func(ctx context.Context) ([]sdk.Instrument, error){
+		sdk.InstrumentTypeStock:    acc.Client.Stocks,
+		sdk.InstrumentTypeBond:     acc.Client.Bonds,
+		sdk.InstrumentTypeEtf:      acc.Client.ETFs,
+		sdk.InstrumentTypeCurrency: acc.Client.Currencies,
+	}[request.Type]
+
+	if fetch == nil {
+		return nil, errors.New(fmt.Sprintf("Unknown instrument type %s", request.Type))
+	}
+
+	cache := &acc.instruments
+
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	if cache.lists == nil {
+		cache.lists = make(map[sdk.InstrumentType]*instrumentList)
+	}
+
+	maxAge := cache.maxAge
+	if maxAge == 0 {
+		maxAge = 24 * time.Hour
+	}
+
+	if list := cache.get(request.Type); list != nil && !request.ForceRefresh && time.Since(list.FetchedAt) < maxAge {
+		return list.Instruments, nil
+	}
+
+	var instruments []sdk.Instrument
+	err := acc.call(ctx, 20*time.Second, func(ctx context.Context) (err error) {
+		instruments, err = fetch(ctx)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cache.put(request.Type, &instrumentList{FetchedAt: time.Now(), Instruments: instruments}); err != nil {
+		return nil, err
+	}
+
+	return instruments, nil
+}
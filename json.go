@@ -0,0 +1,159 @@
+package tinkoff
+
+import (
+	"encoding/json"
+	"io"
+
+	sdk "github.com/TinkoffCreditSystems/invest-openapi-go-sdk"
+	"github.com/shopspring/decimal"
+)
+
+type jsonIncome struct {
+	DividendAmount    json.Number `json:"dividendAmount"`
+	DividendTaxAmount json.Number `json:"dividendTaxAmount"`
+	CouponAmount      json.Number `json:"couponAmount"`
+	CouponTaxAmount   json.Number `json:"couponTaxAmount"`
+	RepaymentAmount   json.Number `json:"repaymentAmount"`
+}
+
+type jsonBalanceItem struct {
+	FIGI                    string                      `json:"figi"`
+	Name                    string                      `json:"name"`
+	Ticker                  string                      `json:"ticker"`
+	Currency                TcfCurrency                 `json:"currency"`
+	OperationAmount         json.Number                 `json:"operationAmount"`
+	BrokerCommissionAmount  json.Number                 `json:"brokerCommissionAmount"`
+	CurrentPrice            json.Number                 `json:"currentPrice"`
+	PortfolioAmount         json.Number                 `json:"portfolioAmount"`
+	PortfolioQuantity       int                         `json:"portfolioQuantity"`
+	DividendAmount          json.Number                 `json:"dividendAmount"`
+	DividendTaxAmount       json.Number                 `json:"dividendTaxAmount"`
+	CouponAmount            json.Number                 `json:"couponAmount"`
+	CouponTaxAmount         json.Number                 `json:"couponTaxAmount"`
+	RepaymentAmount         json.Number                 `json:"repaymentAmount"`
+	AccruedInterest         json.Number                 `json:"accruedInterest"`
+	AccruedInterestPaid     json.Number                 `json:"accruedInterestPaid"`
+	ServiceCommissionAmount json.Number                 `json:"serviceCommissionAmount"`
+	BalanceAmount           json.Number                 `json:"balanceAmount"`
+	MarginFeeAmount         json.Number                 `json:"marginFeeAmount"`
+	RealizedPnL             json.Number                 `json:"realizedPnL"`
+	UnrealizedPnL           json.Number                 `json:"unrealizedPnL"`
+	XIRR                    float64                     `json:"xirr"`
+	Beta                    float64                     `json:"beta,omitempty"`
+	Correlation             float64                     `json:"correlation,omitempty"`
+	YTM                     float64                     `json:"ytm,omitempty"`
+	ModifiedDuration        float64                     `json:"modifiedDuration,omitempty"`
+	TargetPrice             json.Number                 `json:"targetPrice,omitempty"`
+	TargetDistance          float64                     `json:"targetDistance,omitempty"`
+	TargetReached           bool                        `json:"targetReached,omitempty"`
+	IncomeByCurrency        map[TcfCurrency]*jsonIncome `json:"incomeByCurrency,omitempty"`
+}
+
+type jsonTotal struct {
+	BalanceAmount           json.Number `json:"balanceAmount"`
+	ServiceCommissionAmount json.Number `json:"serviceCommissionAmount"`
+	TaxBack                 json.Number `json:"taxBack"`
+	PortfolioAmount         json.Number `json:"portfolioAmount"`
+	XIRR                    float64     `json:"xirr"`
+}
+
+type jsonBalance struct {
+	Items            []*jsonBalanceItem         `json:"items"`
+	Total            map[TcfCurrency]*jsonTotal `json:"total"`
+	Operations       []sdk.Operation            `json:"operations,omitempty"`
+	OperationsByFigi map[string][]sdk.Operation `json:"operationsByFigi,omitempty"`
+	Warnings         []TcfWarning               `json:"warnings,omitempty"`
+	Discrepancies    []*TcfPositionDiscrepancy  `json:"discrepancies,omitempty"`
+}
+
+// jsonMoney keeps the exact decimal amount as a JSON number
+func jsonMoney(amount decimal.Decimal) json.Number {
+	return json.Number(amount.String())
+}
+
+// MarshalJSON encodes the balance with the amounts as exact JSON numbers
+func (b *TcfPortfolioBalance) MarshalJSON() ([]byte, error) {
+
+	res := &jsonBalance{
+		Items:            []*jsonBalanceItem{},
+		Total:            make(map[TcfCurrency]*jsonTotal),
+		Operations:       b.Operations,
+		OperationsByFigi: b.OperationsByFigi,
+		Warnings:         b.Warnings,
+		Discrepancies:    b.Discrepancies,
+	}
+
+	for _, item := range b.Items {
+
+		jsonItem := &jsonBalanceItem{
+			FIGI:                    item.FIGI,
+			Name:                    item.Name,
+			Ticker:                  item.Ticker,
+			Currency:                item.Currency,
+			OperationAmount:         jsonMoney(item.OperationAmount),
+			BrokerCommissionAmount:  jsonMoney(item.BrokerCommissionAmount),
+			CurrentPrice:            jsonMoney(item.CurrentPrice),
+			PortfolioAmount:         jsonMoney(item.PortfolioAmount),
+			PortfolioQuantity:       item.PortfolioQuantity,
+			DividendAmount:          jsonMoney(item.DividendAmount),
+			DividendTaxAmount:       jsonMoney(item.DividendTaxAmount),
+			CouponAmount:            jsonMoney(item.CouponAmount),
+			CouponTaxAmount:         jsonMoney(item.CouponTaxAmount),
+			RepaymentAmount:         jsonMoney(item.RepaymentAmount),
+			AccruedInterest:         jsonMoney(item.AccruedInterest),
+			AccruedInterestPaid:     jsonMoney(item.AccruedInterestPaid),
+			ServiceCommissionAmount: jsonMoney(item.ServiceCommissionAmount),
+			BalanceAmount:           jsonMoney(item.BalanceAmount),
+			MarginFeeAmount:         jsonMoney(item.MarginFeeAmount),
+			RealizedPnL:             jsonMoney(item.RealizedPnL),
+			UnrealizedPnL:           jsonMoney(item.UnrealizedPnL),
+			XIRR:                    item.XIRR,
+			Beta:                    item.Beta,
+			Correlation:             item.Correlation,
+			YTM:                     item.YTM,
+			ModifiedDuration:        item.ModifiedDuration,
+			TargetDistance:          item.TargetDistance,
+			TargetReached:           item.TargetReached,
+		}
+
+		if item.TargetPrice.IsPositive() {
+			jsonItem.TargetPrice = jsonMoney(item.TargetPrice)
+		}
+
+		if len(item.IncomeByCurrency) > 0 {
+			jsonItem.IncomeByCurrency = make(map[TcfCurrency]*jsonIncome)
+			for currency, income := range item.IncomeByCurrency {
+				jsonItem.IncomeByCurrency[currency] = &jsonIncome{
+					DividendAmount:    jsonMoney(income.DividendAmount),
+					DividendTaxAmount: jsonMoney(income.DividendTaxAmount),
+					CouponAmount:      jsonMoney(income.CouponAmount),
+					CouponTaxAmount:   jsonMoney(income.CouponTaxAmount),
+					RepaymentAmount:   jsonMoney(income.RepaymentAmount),
+				}
+			}
+		}
+
+		res.Items = append(res.Items, jsonItem)
+	}
+
+	if b.Total != nil {
+		for currency, total := range b.Total.Currencies {
+			res.Total[currency] = &jsonTotal{
+				BalanceAmount:           jsonMoney(total.BalanceAmount),
+				ServiceCommissionAmount: jsonMoney(total.ServiceCommissionAmount),
+				TaxBack:                 jsonMoney(total.TaxBack),
+				PortfolioAmount:         jsonMoney(total.PortfolioAmount),
+				XIRR:                    total.XIRR,
+			}
+		}
+	}
+
+	return json.Marshal(res)
+}
+
+// WriteJSON writes the balance as indented JSON
+func (b *TcfPortfolioBalance) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(b)
+}
@@ -0,0 +1,129 @@
+package tinkoff
+
+import (
+	"context"
+	"math"
+	"sort"
+	"time"
+
+	sdk "github.com/TinkoffCreditSystems/invest-openapi-go-sdk"
+	"github.com/shopspring/decimal"
+)
+
+type TcfLadderBond struct {
+	FIGI         string
+	Ticker       string
+	Quantity     float64
+	MaturityDate time.Time
+	MarketAmount decimal.Decimal
+	FaceAmount   decimal.Decimal
+	// YTM is the yield to maturity in percents
+	YTM float64
+}
+
+// TcfLadderRung groups the bonds maturing in the same year
+type TcfLadderRung struct {
+	Year         int
+	Currency     TcfCurrency
+	Bonds        []*TcfLadderBond
+	MarketAmount decimal.Decimal
+	FaceAmount   decimal.Decimal
+	// YTM is the market value weighted average yield to maturity in percents
+	YTM float64
+}
+
+// GetBondLadder groups the held bonds by the maturity year
+func (acc *TcfAccount) GetBondLadder(ctx context.Context, provider TcfBondTermsProvider, accountID string) ([]*TcfLadderRung, error) {
+
+	var portfolio sdk.Portfolio
+	err := acc.call(ctx, 20*time.Second, func(ctx context.Context) (err error) {
+		portfolio, err = acc.Client.Portfolio(ctx, acc.accountID(accountID))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	type rungKey struct {
+		year     int
+		currency TcfCurrency
+	}
+
+	rungs := make(map[rungKey]*TcfLadderRung)
+	weightedYTM := make(map[rungKey]float64)
+	now := time.Now()
+
+	for _, position := range portfolio.Positions {
+
+		if position.InstrumentType != sdk.InstrumentTypeBond || position.Balance <= 0 {
+			continue
+		}
+
+		terms, err := provider.BondTerms(ctx, position.FIGI)
+		if err != nil {
+			return nil, err
+		}
+
+		if terms.MaturityDate.IsZero() {
+			continue
+		}
+
+		instrument, err := acc.GetByFigi(ctx, position.FIGI)
+		if err != nil {
+			return nil, err
+		}
+
+		quote, err := acc.GetCurrentPrice(ctx, position.FIGI)
+		if err != nil {
+			return nil, err
+		}
+
+		price := bondPrice(quote, terms)
+		ytm, _ := bondYTM(price, terms, now)
+
+		bond := &TcfLadderBond{
+			FIGI:         position.FIGI,
+			Ticker:       position.Ticker,
+			Quantity:     position.Balance,
+			MaturityDate: terms.MaturityDate,
+			MarketAmount: money(price).Mul(decimal.NewFromFloat(position.Balance)),
+			FaceAmount:   money(terms.FaceValue).Mul(decimal.NewFromFloat(position.Balance)),
+			YTM:          math.Round(10000*ytm) / 100,
+		}
+
+		key := rungKey{terms.MaturityDate.Year(), TcfCurrency(instrument.Currency)}
+		rung, ok := rungs[key]
+		if !ok {
+			rung = &TcfLadderRung{Year: key.year, Currency: key.currency, Bonds: []*TcfLadderBond{}}
+			rungs[key] = rung
+		}
+
+		rung.Bonds = append(rung.Bonds, bond)
+		rung.MarketAmount = rung.MarketAmount.Add(bond.MarketAmount)
+		rung.FaceAmount = rung.FaceAmount.Add(bond.FaceAmount)
+		weightedYTM[key] += bond.YTM * bond.MarketAmount.InexactFloat64()
+	}
+
+	res := []*TcfLadderRung{}
+	for key, rung := range rungs {
+
+		if rung.MarketAmount.IsPositive() {
+			rung.YTM = math.Round(100*weightedYTM[key]/rung.MarketAmount.InexactFloat64()) / 100
+		}
+
+		sort.SliceStable(rung.Bonds, func(i, j int) bool {
+			return rung.Bonds[i].MaturityDate.Before(rung.Bonds[j].MaturityDate)
+		})
+
+		res = append(res, rung)
+	}
+
+	sort.SliceStable(res, func(i, j int) bool {
+		if res[i].Year != res[j].Year {
+			return res[i].Year < res[j].Year
+		}
+		return res[i].Currency < res[j].Currency
+	})
+
+	return res, nil
+}
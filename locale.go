@@ -0,0 +1,206 @@
+package tinkoff
+
+import (
+	"strings"
+	"time"
+
+	sdk "github.com/TinkoffCreditSystems/invest-openapi-go-sdk"
+	"github.com/mikhailbolshakov/tinkoff/utils"
+	"github.com/shopspring/decimal"
+)
+
+type TcfLocale string
+
+const (
+	LocaleEN TcfLocale = "en"
+	LocaleRU TcfLocale = "ru"
+)
+
+var translations = map[TcfLocale]map[string]string{
+	LocaleRU: {
+		"FIGI":               "FIGI",
+		"Ticker":             "Тикер",
+		"Name":               "Название",
+		"Currency":           "Валюта",
+		"Balance":            "Баланс",
+		"Commission":         "Комиссия",
+		"Portfolio":          "Портфель",
+		"Quantity":           "Количество",
+		"Current price":      "Текущая цена",
+		"Dividend":           "Дивиденды",
+		"Service commission": "Комиссия за обслуживание",
+		"Tax back":           "Возврат налога",
+		"Foreign income":     "Доход в других валютах",
+		"Margin fee":         "Плата за маржу",
+		"Target":             "Цель",
+		"To target, %":       "До цели, %",
+		"Total":              "Итого",
+		"reached":            "достигнута",
+		"Dividend tax":       "Налог на дивиденды",
+		"Portfolio balance":  "Баланс портфеля",
+		"Warnings":           "Предупреждения",
+		"Realized P&L":       "Зафиксированный результат",
+		"Unrealized P&L":     "Нереализованный результат",
+		"Beta":               "Бета",
+		"Correlation":        "Корреляция",
+		"Coupon tax":         "Налог на купоны",
+		"Accrued interest":   "НКД",
+		"YTM, %":             "Доходность к погашению, %",
+		"Duration":           "Дюрация",
+		"Target price reached: %s (%s) current %s, target %s": "Цель достигнута: %s (%s) текущая цена %s, цель %s",
+		"Service commission %s, tax back %s":                  "Комиссия за обслуживание %s, возврат налога %s",
+		// operation categories
+		"Trade":    "Сделки",
+		"Income":   "Доход",
+		"Tax":      "Налог",
+		"CashFlow": "Пополнения и выводы",
+		"Other":    "Прочее",
+		// operation types
+		"Buy":                "Покупка",
+		"BuyCard":            "Покупка с карты",
+		"Sell":               "Продажа",
+		"BrokerCommission":   "Комиссия брокера",
+		"ExchangeCommission": "Комиссия биржи",
+		"ServiceCommission":  "Комиссия за обслуживание",
+		"MarginCommission":   "Комиссия за маржинальную торговлю",
+		"OtherCommission":    "Прочая комиссия",
+		"PayIn":              "Пополнение",
+		"PayOut":             "Вывод",
+		"TaxLucre":           "Налог на доход",
+		"TaxDividend":        "Налог на дивиденды",
+		"TaxCoupon":          "Налог на купоны",
+		"TaxBack":            "Возврат налога",
+		"Repayment":          "Погашение",
+		"PartRepayment":      "Частичное погашение",
+		"Coupon":             "Купон",
+		"SecurityIn":         "Зачисление бумаг",
+		"SecurityOut":        "Списание бумаг",
+	},
+}
+
+var currencyNames = map[TcfLocale]map[TcfCurrency]string{
+	LocaleEN: {
+		CurrencyRUB: "Russian ruble",
+		CurrencyUSD: "US dollar",
+		CurrencyEUR: "Euro",
+		CurrencyGBP: "Pound sterling",
+		CurrencyHKD: "Hong Kong dollar",
+		CurrencyCHF: "Swiss franc",
+		CurrencyJPY: "Japanese yen",
+		CurrencyCNY: "Chinese yuan",
+		CurrencyTRY: "Turkish lira",
+	},
+	LocaleRU: {
+		CurrencyRUB: "Российский рубль",
+		CurrencyUSD: "Доллар США",
+		CurrencyEUR: "Евро",
+		CurrencyGBP: "Фунт стерлингов",
+		CurrencyHKD: "Гонконгский доллар",
+		CurrencyCHF: "Швейцарский франк",
+		CurrencyJPY: "Японская иена",
+		CurrencyCNY: "Китайский юань",
+		CurrencyTRY: "Турецкая лира",
+	},
+}
+
+// Text translates the report text (headers, operation types and categories), the text is returned as is if there is no translation
+func (l TcfLocale) Text(s string) string {
+	if t, ok := translations[l][s]; ok {
+		return t
+	}
+	return s
+}
+
+// OperationType returns the label of the operation type
+func (l TcfLocale) OperationType(operationType sdk.OperationType) string {
+	return l.Text(string(operationType))
+}
+
+// Category returns the name of the operation category
+func (l TcfLocale) Category(category utils.OperationCategory) string {
+	return l.Text(string(category))
+}
+
+// CurrencyName returns the name of the currency, the code is returned for an unknown currency
+func (l TcfLocale) CurrencyName(currency TcfCurrency) string {
+	if name, ok := currencyNames[l][currency]; ok {
+		return name
+	}
+	if name, ok := currencyNames[LocaleEN][currency]; ok {
+		return name
+	}
+	return string(currency)
+}
+
+// Date formats the date in the locale's format
+func (l TcfLocale) Date(t time.Time) string {
+	if l == LocaleRU {
+		return t.Format("02.01.2006")
+	}
+	return t.Format("2006-01-02")
+}
+
+// reportFormatter formats the report cells for the locale, the amounts are left as numbers if the locale is not set
+type reportFormatter struct {
+	locale TcfLocale
+}
+
+// text translates the text, the text is returned as is if there is no translation
+func (f reportFormatter) text(s string) string {
+	return f.locale.Text(s)
+}
+
+func (f reportFormatter) percent(value float64) interface{} {
+	if f.locale == "" {
+		return value
+	}
+	return f.number(decimal.NewFromFloat(value), 2)
+}
+
+func (f reportFormatter) money(amount decimal.Decimal) interface{} {
+	if f.locale == "" {
+		return presentMoney(amount)
+	}
+	return f.number(amount, 2)
+}
+
+// number formats the amount with the thousand separators and the decimal separator of the locale,
+// without the locale the amount is formatted as a plain number
+func (f reportFormatter) number(amount decimal.Decimal, places int32) string {
+
+	if f.locale == "" {
+		return amount.StringFixed(places)
+	}
+
+	thousands, point := ",", "."
+	if f.locale == LocaleRU {
+		thousands, point = " ", ","
+	}
+
+	text := amount.StringFixed(places)
+
+	sign := ""
+	if strings.HasPrefix(text, "-") {
+		sign, text = "-", text[1:]
+	}
+
+	integer, fraction := text, ""
+	if i := strings.Index(text, "."); i >= 0 {
+		integer, fraction = text[:i], text[i+1:]
+	}
+
+	var b strings.Builder
+	for i, r := range integer {
+		if i > 0 && (len(integer)-i)%3 == 0 {
+			b.WriteString(thousands)
+		}
+		b.WriteRune(r)
+	}
+
+	if fraction != "" {
+		b.WriteString(point)
+		b.WriteString(fraction)
+	}
+
+	return sign + b.String()
+}
@@ -0,0 +1,318 @@
+package tinkoff
+
+import (
+	"context"
+	"io"
+	"math"
+	"sort"
+	"time"
+
+	sdk "github.com/TinkoffCreditSystems/invest-openapi-go-sdk"
+	"github.com/mikhailbolshakov/tinkoff/utils"
+	"github.com/shopspring/decimal"
+)
+
+// exemptionYears is the holding period after which the gain is exempt from the tax (ЛДВ)
+const exemptionYears = 3
+
+// exemptAfter returns the time the lot opened at is held long enough for the exemption, the calendar years
+// are counted so the leap days are included
+func exemptAfter(openedAt time.Time) time.Time {
+	return openedAt.AddDate(exemptionYears, 0, 0)
+}
+
+// TcfLot is the quantity of the instrument bought by one operation
+type TcfLot struct {
+	FIGI     string
+	Currency TcfCurrency
+	OpenedAt time.Time
+	Quantity int
+	// Price is the cost of one unit including the commission
+	Price decimal.Decimal
+}
+
+// CostAmount is the cost of the lot quantity
+func (l *TcfLot) CostAmount() decimal.Decimal {
+	return l.Price.Mul(decimal.NewFromInt(int64(l.Quantity)))
+}
+
+// HoldingPeriod is the time the lot is held by the moment
+func (l *TcfLot) HoldingPeriod(now time.Time) time.Duration {
+	return now.Sub(l.OpenedAt)
+}
+
+// TcfRealizedGain is the part of a lot closed by a sell
+type TcfRealizedGain struct {
+	FIGI      string
+	Currency  TcfCurrency
+	OpenedAt  time.Time
+	ClosedAt  time.Time
+	Quantity  int
+	BuyPrice  decimal.Decimal
+	SellPrice decimal.Decimal // the proceeds of one unit net of the commission
+	// GainAmount is negative for a loss
+	GainAmount decimal.Decimal
+	Exempt     bool // held longer than 3 years, the gain is not taxed
+}
+
+// CostAmount is the cost basis of the closed quantity
+func (g *TcfRealizedGain) CostAmount() decimal.Decimal {
+	return g.BuyPrice.Mul(decimal.NewFromInt(int64(g.Quantity)))
+}
+
+// HoldingPeriod is the time the closed quantity was held
+func (g *TcfRealizedGain) HoldingPeriod() time.Duration {
+	return g.ClosedAt.Sub(g.OpenedAt)
+}
+
+// TcfLotLedger is the result of matching the sells of an instrument against the buy lots (FIFO)
+type TcfLotLedger struct {
+	FIGI   string
+	Open   []*TcfLot
+	Closed []*TcfRealizedGain
+	// UnmatchedQuantity is the quantity sold without the lots in the history, the history is incomplete if positive
+	UnmatchedQuantity int
+}
+
+// RealizedGain is the total gain of the closed lots
+func (l *TcfLotLedger) RealizedGain() decimal.Decimal {
+
+	res := decimal.Zero
+	for _, gain := range l.Closed {
+		res = res.Add(gain.GainAmount)
+	}
+
+	return res
+}
+
+// MatchLots matches the sells against the earliest buy lots for every instrument of the operations
+func MatchLots(operations []sdk.Operation) map[string]*TcfLotLedger {
+
+	res := make(map[string]*TcfLotLedger)
+
+	for figi, figiOperations := range utils.ByFigi(operations) {
+		open, closed := replayLots(figiOperations)
+		res[figi] = &TcfLotLedger{
+			FIGI:              figi,
+			Open:              open,
+			Closed:            closed,
+			UnmatchedQuantity: unmatchedQuantity(figiOperations),
+		}
+	}
+
+	return res
+}
+
+// GetLotLedger returns the lot ledgers of the instruments, the whole history up to the end of the period is replayed
+// so the lots sold in the period are matched against the purchases made before it
+func (acc *TcfAccount) GetLotLedger(ctx context.Context, request *TcfGetOperationsRequest) (map[string]*TcfLotLedger, error) {
+
+	operations, err := acc.GetOperations(ctx, &TcfGetOperationsRequest{
+		AccountID:    request.AccountID,
+		PeriodFrom:   time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC),
+		PeriodTo:     request.PeriodTo,
+		Figi:         request.Figi,
+		ForPortfolio: request.ForPortfolio,
+		ExcludeFIGIs: request.ExcludeFIGIs,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return MatchLots(operations), nil
+}
+
+// openLots replays the trades of one instrument matching sells against the earliest lots (FIFO)
+func openLots(operations []sdk.Operation) []*TcfLot {
+	lots, _ := replayLots(operations)
+	return lots
+}
+
+// replayLots returns the lots left open and the gains realized by the sells. The principal returned
+// by the bond amortization (PartRepayment) reduces the price of the lots held at the time
+func replayLots(operations []sdk.Operation) ([]*TcfLot, []*TcfRealizedGain) {
+
+	trades := filterOperations(operations, &filterOperationsCriteria{OperationTypes: []string{"Buy", "BuyCard", "Sell", "PartRepayment"}})
+
+	sort.SliceStable(trades, func(i, j int) bool {
+		return trades[i].DateTime.Before(trades[j].DateTime)
+	})
+
+	lots := []*TcfLot{}
+	realized := []*TcfRealizedGain{}
+
+	for _, trade := range trades {
+
+		if trade.OperationType == "PartRepayment" {
+			if held := lotsQuantity(lots); held > 0 {
+				repayment := moneyAbs(trade.Payment).Div(decimal.NewFromInt(int64(held)))
+				for _, lot := range lots {
+					lot.Price = lot.Price.Sub(repayment)
+				}
+			}
+			continue
+		}
+
+		if trade.Quantity == 0 {
+			continue
+		}
+
+		if trade.OperationType != "Sell" {
+			cost := moneyAbs(trade.Payment).Add(moneyAbs(trade.Commission.Value))
+			lots = append(lots, &TcfLot{
+				FIGI:     trade.FIGI,
+				Currency: TcfCurrency(trade.Currency),
+				OpenedAt: trade.DateTime,
+				Quantity: trade.Quantity,
+				Price:    cost.Div(decimal.NewFromInt(int64(trade.Quantity))),
+			})
+			continue
+		}
+
+		proceeds := moneyAbs(trade.Payment).Sub(moneyAbs(trade.Commission.Value))
+		sellPrice := proceeds.Div(decimal.NewFromInt(int64(trade.Quantity)))
+
+		// the history may be incomplete, the sold quantity without lots is ignored
+		quantity := trade.Quantity
+		for quantity > 0 && len(lots) > 0 {
+			matched := quantity
+			if lots[0].Quantity < matched {
+				matched = lots[0].Quantity
+			}
+
+			realized = append(realized, &TcfRealizedGain{
+				FIGI:       trade.FIGI,
+				Currency:   TcfCurrency(trade.Currency),
+				OpenedAt:   lots[0].OpenedAt,
+				ClosedAt:   trade.DateTime,
+				Quantity:   matched,
+				BuyPrice:   lots[0].Price,
+				SellPrice:  sellPrice,
+				GainAmount: sellPrice.Sub(lots[0].Price).Mul(decimal.NewFromInt(int64(matched))),
+				Exempt:     trade.DateTime.After(exemptAfter(lots[0].OpenedAt)),
+			})
+
+			lots[0].Quantity -= matched
+			quantity -= matched
+			if lots[0].Quantity == 0 {
+				lots = lots[1:]
+			}
+		}
+	}
+
+	return lots, realized
+}
+
+// unmatchedQuantity returns the quantity sold without the lots bought before, it is positive when the history is incomplete
+func unmatchedQuantity(operations []sdk.Operation) int {
+
+	trades := filterOperations(operations, &filterOperationsCriteria{OperationTypes: []string{"Buy", "BuyCard", "Sell"}})
+
+	sort.SliceStable(trades, func(i, j int) bool {
+		return trades[i].DateTime.Before(trades[j].DateTime)
+	})
+
+	held, unmatched := 0, 0
+	for _, trade := range trades {
+		if trade.OperationType != "Sell" {
+			held += trade.Quantity
+			continue
+		}
+		if trade.Quantity > held {
+			unmatched += trade.Quantity - held
+			held = 0
+			continue
+		}
+		held -= trade.Quantity
+	}
+
+	return unmatched
+}
+
+type TcfLotView struct {
+	FIGI            string          `report:"FIGI"`
+	Ticker          string          `report:"Ticker"`
+	OpenedAt        time.Time       `report:"Opened"`
+	Quantity        int             `report:"Quantity"`
+	Price           decimal.Decimal `report:"Price"`
+	CurrentPrice    decimal.Decimal `report:"Current price"`
+	GainAmount      decimal.Decimal `report:"Gain"`
+	GainPercent     float64         `report:"Gain, %"`
+	DaysToExemption int             `report:"Days to exemption"`
+}
+
+// GetOpenLots returns the open lots of the positions with the current gain and the days left to the 3-year tax exemption,
+// the whole history up to the end of the period is replayed like in GetLotLedger
+func (acc *TcfAccount) GetOpenLots(ctx context.Context, request *TcfGetOperationsRequest) ([]*TcfLotView, error) {
+
+	operations, err := acc.GetOperations(ctx, &TcfGetOperationsRequest{
+		AccountID:    request.AccountID,
+		PeriodFrom:   time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC),
+		PeriodTo:     request.PeriodTo,
+		Figi:         request.Figi,
+		ForPortfolio: request.ForPortfolio,
+		ExcludeFIGIs: request.ExcludeFIGIs,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	views := []*TcfLotView{}
+
+	for figi, figiOperations := range utils.ByFigi(operations) {
+
+		lots := openLots(figiOperations)
+		if len(lots) == 0 {
+			continue
+		}
+
+		quote, err := acc.GetCurrentPrice(ctx, figi)
+		if err != nil {
+			return nil, err
+		}
+		currentPrice := money(quote)
+
+		instrument, err := acc.GetByFigi(ctx, figi)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, lot := range lots {
+
+			view := &TcfLotView{
+				FIGI:         figi,
+				Ticker:       instrument.Ticker,
+				OpenedAt:     lot.OpenedAt,
+				Quantity:     lot.Quantity,
+				Price:        lot.Price,
+				CurrentPrice: currentPrice,
+				GainAmount:   currentPrice.Sub(lot.Price).Mul(decimal.NewFromInt(int64(lot.Quantity))),
+			}
+
+			if lot.Price.IsPositive() {
+				view.GainPercent, _ = currentPrice.Div(lot.Price).Sub(decimal.NewFromInt(1)).Mul(decimal.NewFromInt(100)).Round(2).Float64()
+			}
+
+			if left := exemptAfter(lot.OpenedAt).Sub(now); left > 0 {
+				view.DaysToExemption = int(math.Ceil(left.Hours() / 24))
+			}
+
+			views = append(views, view)
+		}
+	}
+
+	sort.SliceStable(views, func(i, j int) bool {
+		if views[i].Ticker != views[j].Ticker {
+			return views[i].Ticker < views[j].Ticker
+		}
+		return views[i].OpenedAt.Before(views[j].OpenedAt)
+	})
+
+	return views, nil
+}
+
+// PrintLots renders the open lots as a drill-down table
+func PrintLots(w io.Writer, lots []*TcfLotView) {
+	RenderTable(w, lots)
+}
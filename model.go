@@ -1,50 +1,213 @@
 package tinkoff
 
-import sdk "github.com/TinkoffCreditSystems/invest-openapi-go-sdk"
+import (
+	"fmt"
+	"sort"
+
+	sdk "github.com/TinkoffCreditSystems/invest-openapi-go-sdk"
+	"github.com/shopspring/decimal"
+)
+
+type TcfCurrency string
+
+const (
+	CurrencyRUB TcfCurrency = "RUB"
+	CurrencyUSD TcfCurrency = "USD"
+	CurrencyEUR TcfCurrency = "EUR"
+	CurrencyGBP TcfCurrency = "GBP"
+	CurrencyHKD TcfCurrency = "HKD"
+	CurrencyCHF TcfCurrency = "CHF"
+	CurrencyJPY TcfCurrency = "JPY"
+	CurrencyCNY TcfCurrency = "CNY"
+	CurrencyTRY TcfCurrency = "TRY"
+)
+
+var currencies = []TcfCurrency{
+	CurrencyRUB,
+	CurrencyUSD,
+	CurrencyEUR,
+	CurrencyGBP,
+	CurrencyHKD,
+	CurrencyCHF,
+	CurrencyJPY,
+	CurrencyCNY,
+	CurrencyTRY,
+}
+
+// Validate checks the currency is one of the currencies traded on the exchange
+func (c TcfCurrency) Validate() error {
+	for _, currency := range currencies {
+		if c == currency {
+			return nil
+		}
+	}
+	return fmt.Errorf("Unknown currency %q", string(c))
+}
+
+// TcfIncome is the income of the position paid in one currency
+type TcfIncome struct {
+	DividendAmount    decimal.Decimal
+	DividendTaxAmount decimal.Decimal
+	CouponAmount      decimal.Decimal
+	CouponTaxAmount   decimal.Decimal
+	// RepaymentAmount is the principal returned by the amortization, it is not an income
+	// but is kept with the payments of its currency
+	RepaymentAmount decimal.Decimal
+}
 
 type TcfBalanceItem struct {
 	FIGI                    string
 	Name                    string
 	Ticker                  string
-	Currency                string
-	OperationAmount         float64
-	BrokerCommissionAmount  float64
-	CurrentPrice            float64
-	PortfolioAmount         float64
+	Currency                TcfCurrency
+	OperationAmount         decimal.Decimal
+	BrokerCommissionAmount  decimal.Decimal
+	CurrentPrice            decimal.Decimal // of one bond for the bonds with the known terms, not the quote in percents
+	PortfolioAmount         decimal.Decimal
 	PortfolioQuantity       int
-	DividendAmount          float64
-	DividendTaxAmount       float64
-	ServiceCommissionAmount float64
-	BalanceAmount           float64
+	DividendAmount          decimal.Decimal
+	DividendTaxAmount       decimal.Decimal
+	ServiceCommissionAmount decimal.Decimal
+	BalanceAmount           decimal.Decimal
+	MarginFeeAmount         decimal.Decimal // estimated margin fee accrued for the short position, subtracted from BalanceAmount
+	TargetPrice             decimal.Decimal
+	TargetDistance          float64 // percents from the current price to the target price
+	TargetReached           bool
+	// IncomeByCurrency is the income broken down by the payment currency, the dividend and the coupon amounts
+	// contain only the income paid in the instrument's currency
+	IncomeByCurrency map[TcfCurrency]*TcfIncome
+	// RealizedPnL is the gain of the closed lots (net of the commissions) plus the dividends net of the tax,
+	// UnrealizedPnL is the gain of the open lots at the current price
+	RealizedPnL   decimal.Decimal
+	UnrealizedPnL decimal.Decimal
+	// XIRR is the annualized money-weighted return in percents, zero if it can't be determined
+	XIRR float64
+	// Beta and Correlation against the benchmark are set by ApplyBeta
+	Beta        float64
+	Correlation float64
+	// CouponAmount and CouponTaxAmount are the bond coupons and the tax withheld from them
+	CouponAmount    decimal.Decimal
+	CouponTaxAmount decimal.Decimal
+	// RepaymentAmount is the principal returned by the amortization of the bond (PartRepayment)
+	RepaymentAmount decimal.Decimal
+	// AccruedInterest is the coupon interest accrued on the held bonds (НКД), it is included in PortfolioAmount.
+	// AccruedInterestPaid is the interest paid on the bond purchases net of the interest received on the sales
+	AccruedInterest     decimal.Decimal
+	AccruedInterestPaid decimal.Decimal
+	// YTM is the yield to maturity of the bond in percents and ModifiedDuration is in years, both of the full price
+	// (CurrentPrice plus the accrued interest), set for the held bonds if the bond terms are known (WithBondTerms)
+	YTM              float64
+	ModifiedDuration float64
+}
+
+func (i *TcfBalanceItem) income(currency TcfCurrency) *TcfIncome {
+
+	if i.IncomeByCurrency == nil {
+		i.IncomeByCurrency = make(map[TcfCurrency]*TcfIncome)
+	}
+
+	income, ok := i.IncomeByCurrency[currency]
+	if !ok {
+		income = &TcfIncome{}
+		i.IncomeByCurrency[currency] = income
+	}
+
+	return income
+}
+
+// ForeignIncome returns the income paid in currencies other than the instrument's one
+func (i *TcfBalanceItem) ForeignIncome() map[TcfCurrency]*TcfIncome {
+
+	res := make(map[TcfCurrency]*TcfIncome)
+
+	for currency, income := range i.IncomeByCurrency {
+		if currency != i.Currency {
+			res[currency] = income
+		}
+	}
+
+	return res
 }
 
 type TcfTotal struct {
-	BalanceAmount           float64
-	ServiceCommissionAmount float64
-	TaxBack                 float64
-	PortfolioAmount         float64
+	BalanceAmount           decimal.Decimal
+	ServiceCommissionAmount decimal.Decimal
+	TaxBack                 decimal.Decimal
+	PortfolioAmount         decimal.Decimal
+	// XIRR is the money-weighted return of the positions in the currency (the free cash is not included), in percents
+	XIRR float64
 }
 
 type TcfBalanceTotal struct {
-	Currencies map[string]*TcfTotal
+	Currencies map[TcfCurrency]*TcfTotal
+}
+
+// Currency returns the total of the given currency, the bucket is created on the first access
+func (t *TcfBalanceTotal) Currency(currency TcfCurrency) *TcfTotal {
+
+	if t.Currencies == nil {
+		t.Currencies = make(map[TcfCurrency]*TcfTotal)
+	}
+
+	total, ok := t.Currencies[currency]
+	if !ok {
+		total = &TcfTotal{}
+		t.Currencies[currency] = total
+	}
+
+	return total
+}
+
+// SortedCurrencies returns the currencies having a total in the stable order
+func (t *TcfBalanceTotal) SortedCurrencies() []TcfCurrency {
+
+	res := []TcfCurrency{}
+	for currency := range t.Currencies {
+		res = append(res, currency)
+	}
+
+	sort.SliceStable(res, func(i, j int) bool {
+		return res[i] < res[j]
+	})
+
+	return res
 }
 
 type TcfPortfolioBalance struct {
 	Items []*TcfBalanceItem
 	Total *TcfBalanceTotal
+	// Operations and OperationsByFigi are populated only when requested with IncludeOperations
+	Operations       []sdk.Operation
+	OperationsByFigi map[string][]sdk.Operation
+	Warnings         []TcfWarning
+	// Discrepancies are the positions the computed quantity differs from the portfolio, set with ReconcilePositions
+	Discrepancies []*TcfPositionDiscrepancy
+}
+
+// totalItems adds the amounts of the items to the totals of their currencies
+func (b *TcfPortfolioBalance) totalItems() {
+
+	for _, item := range b.Items {
+		total := b.Total.Currency(item.Currency)
+		total.BalanceAmount = total.BalanceAmount.Add(item.BalanceAmount)
+		total.PortfolioAmount = total.PortfolioAmount.Add(item.PortfolioAmount)
+
+		// income paid in a currency other than the instrument's one goes to the bucket of its own currency
+		for currency, income := range item.ForeignIncome() {
+			total := b.Total.Currency(currency)
+			total.BalanceAmount = total.BalanceAmount.Add(netIncome(income)).Add(income.RepaymentAmount)
+		}
+	}
 }
 
 func createEmptyBalance() *TcfPortfolioBalance {
 
+	// currency buckets are created when the first item in the currency is added
 	total := &TcfBalanceTotal{
-		Currencies: make(map[string]*TcfTotal),
+		Currencies: make(map[TcfCurrency]*TcfTotal),
 	}
 
-	total.Currencies["RUB"] = &TcfTotal{BalanceAmount: 0.0, ServiceCommissionAmount: 0.0, TaxBack: 0.0}
-	total.Currencies["USD"] = &TcfTotal{BalanceAmount: 0.0, ServiceCommissionAmount: 0.0, TaxBack: 0.0}
-	total.Currencies["EUR"] = &TcfTotal{BalanceAmount: 0.0, ServiceCommissionAmount: 0.0, TaxBack: 0.0}
-
-	balance := &TcfPortfolioBalance{Items: []*TcfBalanceItem{}, Total: total}
+	balance := &TcfPortfolioBalance{Items: []*TcfBalanceItem{}, Total: total, Warnings: []TcfWarning{}}
 
 	return balance
 }
@@ -54,15 +217,66 @@ func createBalanceItem(instrument *sdk.SearchInstrument) *TcfBalanceItem {
 		FIGI:                    instrument.FIGI,
 		Ticker:                  instrument.Ticker,
 		Name:                    instrument.Name,
-		Currency:                string(instrument.Currency),
-		BalanceAmount:           0.0,
-		OperationAmount:         0.0,
-		BrokerCommissionAmount:  0.0,
+		Currency:                TcfCurrency(instrument.Currency),
+		BalanceAmount:           decimal.Zero,
+		OperationAmount:         decimal.Zero,
+		BrokerCommissionAmount:  decimal.Zero,
 		PortfolioQuantity:       0,
-		PortfolioAmount:         0.0,
-		DividendAmount:          0.0,
-		DividendTaxAmount:       0.0,
-		ServiceCommissionAmount: 0.0,
+		PortfolioAmount:         decimal.Zero,
+		DividendAmount:          decimal.Zero,
+		DividendTaxAmount:       decimal.Zero,
+		ServiceCommissionAmount: decimal.Zero,
 	}
 	return balanceItem
 }
+
+type TcfSortOrder string
+
+const (
+	SortByTicker         TcfSortOrder = "ticker"
+	SortByBalanceDesc    TcfSortOrder = "balance_desc"
+	SortByCurrencyTicker TcfSortOrder = "currency_ticker"
+)
+
+// Sort orders the balance items, the ties are ordered by FIGI so the order is stable between runs
+func (b *TcfPortfolioBalance) Sort(order TcfSortOrder) {
+
+	sort.SliceStable(b.Items, func(i, j int) bool {
+
+		x, y := b.Items[i], b.Items[j]
+
+		switch order {
+		case SortByBalanceDesc:
+			if !x.BalanceAmount.Equal(y.BalanceAmount) {
+				return x.BalanceAmount.GreaterThan(y.BalanceAmount)
+			}
+		case SortByCurrencyTicker:
+			if x.Currency != y.Currency {
+				return x.Currency < y.Currency
+			}
+			if x.Ticker != y.Ticker {
+				return x.Ticker < y.Ticker
+			}
+		default:
+			if x.Ticker != y.Ticker {
+				return x.Ticker < y.Ticker
+			}
+		}
+
+		return x.FIGI < y.FIGI
+	})
+}
+
+// TargetsReached returns the balance items whose current price has reached the target price
+func (b *TcfPortfolioBalance) TargetsReached() []*TcfBalanceItem {
+
+	res := []*TcfBalanceItem{}
+
+	for _, item := range b.Items {
+		if item.TargetReached {
+			res = append(res, item)
+		}
+	}
+
+	return res
+}
@@ -0,0 +1,85 @@
+package tinkoff
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestCurrencyValidate(t *testing.T) {
+
+	for _, currency := range []TcfCurrency{CurrencyRUB, CurrencyUSD, CurrencyGBP, CurrencyHKD, CurrencyCHF, CurrencyCNY} {
+		if err := currency.Validate(); err != nil {
+			t.Errorf("%s: unexpected error %v", currency, err)
+		}
+	}
+
+	for _, currency := range []TcfCurrency{"", "XXX", "usd", "GBPX"} {
+		if err := currency.Validate(); err == nil {
+			t.Errorf("%q: expected an error", currency)
+		}
+	}
+}
+
+func TestBalanceTotalCurrency(t *testing.T) {
+
+	total := &TcfBalanceTotal{}
+
+	gbp := total.Currency(CurrencyGBP)
+	if gbp == nil {
+		t.Fatal("the bucket is not created")
+	}
+	gbp.BalanceAmount = decimal.NewFromInt(10)
+
+	if total.Currency(CurrencyGBP) != gbp {
+		t.Error("the existing bucket is not returned")
+	}
+	if len(total.Currencies) != 1 {
+		t.Errorf("expected 1 bucket, got %d", len(total.Currencies))
+	}
+}
+
+func TestBalanceExoticCurrencies(t *testing.T) {
+
+	balance := createEmptyBalance()
+	balance.Items = append(balance.Items,
+		&TcfBalanceItem{FIGI: "BBG000BDTBL9", Ticker: "BP", Currency: CurrencyGBP, BalanceAmount: decimal.NewFromInt(100), PortfolioAmount: decimal.NewFromInt(150)},
+		&TcfBalanceItem{FIGI: "BBG000BGLRN3", Ticker: "700", Currency: CurrencyHKD, BalanceAmount: decimal.NewFromInt(-20), PortfolioAmount: decimal.NewFromInt(80)},
+		&TcfBalanceItem{FIGI: "BBG00ZTJTN56", Ticker: "BABA", Currency: CurrencyHKD, BalanceAmount: decimal.NewFromInt(5), PortfolioAmount: decimal.NewFromInt(40),
+			IncomeByCurrency: map[TcfCurrency]*TcfIncome{CurrencyCNY: {DividendAmount: decimal.NewFromInt(12), DividendTaxAmount: decimal.NewFromInt(2)}}},
+	)
+
+	// the buckets of the currencies met first in the items are created on the aggregation
+	balance.totalItems()
+
+	if len(balance.Total.Currencies) != 3 {
+		t.Errorf("expected 3 buckets, got %d", len(balance.Total.Currencies))
+	}
+	if got := balance.Total.Currencies[CurrencyGBP].BalanceAmount; !got.Equal(decimal.NewFromInt(100)) {
+		t.Errorf("GBP balance %s", got)
+	}
+	if got := balance.Total.Currencies[CurrencyHKD].BalanceAmount; !got.Equal(decimal.NewFromInt(-15)) {
+		t.Errorf("HKD balance %s", got)
+	}
+	if got := balance.Total.Currencies[CurrencyHKD].PortfolioAmount; !got.Equal(decimal.NewFromInt(120)) {
+		t.Errorf("HKD portfolio %s", got)
+	}
+	// the CNY dividend of the HKD instrument is totalled in CNY net of the tax
+	if got := balance.Total.Currencies[CurrencyCNY].BalanceAmount; !got.Equal(decimal.NewFromInt(10)) {
+		t.Errorf("CNY balance %s", got)
+	}
+
+	var buf bytes.Buffer
+	if err := (TcfTextRenderer{}).Render(balance, &buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "GBP") || !strings.Contains(buf.String(), "HKD") || !strings.Contains(buf.String(), "CNY") {
+		t.Errorf("the report misses the currencies:\n%s", buf.String())
+	}
+
+	if _, err := balance.MarshalJSON(); err != nil {
+		t.Fatal(err)
+	}
+}
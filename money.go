@@ -0,0 +1,19 @@
+package tinkoff
+
+import "github.com/shopspring/decimal"
+
+// money converts the amount reported by the API to the decimal, the amounts are kept unrounded
+// and rounded only when presented
+func money(amount float64) decimal.Decimal {
+	return decimal.NewFromFloat(amount)
+}
+
+// moneyAbs converts the absolute value of the amount reported by the API to the decimal
+func moneyAbs(amount float64) decimal.Decimal {
+	return decimal.NewFromFloat(amount).Abs()
+}
+
+// presentMoney rounds the amount to cents for the presentation
+func presentMoney(amount decimal.Decimal) float64 {
+	return amount.Round(2).InexactFloat64()
+}
@@ -0,0 +1,74 @@
+package tinkoff
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+type TcfNewsItem struct {
+	Ticker    string
+	Headline  string
+	URL       string
+	Source    string
+	Published time.Time
+}
+
+// TcfNewsProvider is a user configured source of headlines
+type TcfNewsProvider interface {
+	Headlines(ctx context.Context, ticker string, since time.Time) ([]TcfNewsItem, error)
+}
+
+type TcfNewsDigestRequest struct {
+	Since time.Time
+	// MaxPerTicker limits the number of headlines per ticker, 0 means no limit
+	MaxPerTicker int
+}
+
+type TcfNewsDigest struct {
+	FIGI   string
+	Ticker string
+	Items  []TcfNewsItem
+}
+
+// GetNewsDigest gathers the recent headlines for the held tickers
+func (acc *TcfAccount) GetNewsDigest(ctx context.Context, provider TcfNewsProvider, request *TcfNewsDigestRequest) ([]*TcfNewsDigest, error) {
+
+	ctx, cancel := context.WithTimeout(ctx, acc.calculationTimeoutOr(20*time.Second))
+	defer cancel()
+
+	figiByTicker, err := acc.heldTickers(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	digest := []*TcfNewsDigest{}
+
+	for ticker, figi := range figiByTicker {
+
+		items, err := provider.Headlines(ctx, ticker, request.Since)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(items) == 0 {
+			continue
+		}
+
+		sort.SliceStable(items, func(i, j int) bool {
+			return items[i].Published.After(items[j].Published)
+		})
+
+		if request.MaxPerTicker > 0 && len(items) > request.MaxPerTicker {
+			items = items[:request.MaxPerTicker]
+		}
+
+		digest = append(digest, &TcfNewsDigest{FIGI: figi, Ticker: ticker, Items: items})
+	}
+
+	sort.SliceStable(digest, func(i, j int) bool {
+		return digest[i].Ticker < digest[j].Ticker
+	})
+
+	return digest, nil
+}
@@ -0,0 +1,111 @@
+package tinkoff
+
+import (
+	"context"
+	"time"
+
+	sdk "github.com/TinkoffCreditSystems/invest-openapi-go-sdk"
+	"golang.org/x/sync/errgroup"
+	"golang.org/x/time/rate"
+)
+
+// the API allows 120 requests per minute for most of the methods
+const defaultRequestsPerMinute = 120
+
+const defaultConcurrency = 10
+
+// defaultLimiter allows a burst of one minute's budget, so a balance of many instruments is not throttled
+// beyond the API's own limit within its deadline
+func defaultLimiter() *rate.Limiter {
+	return rate.NewLimiter(rate.Limit(float64(defaultRequestsPerMinute)/60), defaultRequestsPerMinute)
+}
+
+type TcfOption func(acc *TcfAccount)
+
+// WithTimeout sets the deadline of every API request, by default the request specific deadlines (5-20 seconds)
+// are used. The deadline of the whole calculation is set by WithCalculationTimeout
+func WithTimeout(timeout time.Duration) TcfOption {
+	return func(acc *TcfAccount) {
+		acc.timeout = timeout
+	}
+}
+
+// WithCalculationTimeout sets the deadline of the whole balance (the earnings, the news) calculation
+// made of many requests, 20 seconds by default. Long periods of many instruments may need more
+func WithCalculationTimeout(timeout time.Duration) TcfOption {
+	return func(acc *TcfAccount) {
+		acc.calculationTimeout = timeout
+	}
+}
+
+// WithRetry makes a request failed with a transient error (429, 5xx, network timeout) to be repeated
+// up to maxAttempts times in total. The pause between attempts grows exponentially starting from backoff
+// and is jittered, so the concurrent workers don't retry at once
+func WithRetry(maxAttempts int, backoff time.Duration) TcfOption {
+	return func(acc *TcfAccount) {
+		acc.retryAttempts = maxAttempts
+		acc.retryBackoff = backoff
+	}
+}
+
+// WithRestClient replaces the SDK client, e.g. one created with sdk.NewRestClientCustom for the sandbox.
+// The SDK client doesn't accept a custom http.Client, so this is the way to tune the transport
+func WithRestClient(client *sdk.RestClient) TcfOption {
+	return func(acc *TcfAccount) {
+		acc.Client = client
+	}
+}
+
+// WithRateLimit limits the API requests made by all the account methods to requestsPerMinute
+// allowing bursts of the given size, zero requestsPerMinute disables the limiting
+func WithRateLimit(requestsPerMinute int, burst int) TcfOption {
+	return func(acc *TcfAccount) {
+		if requestsPerMinute <= 0 {
+			acc.limiter = nil
+			return
+		}
+		if burst < 1 {
+			burst = 1
+		}
+		acc.limiter = rate.NewLimiter(rate.Limit(float64(requestsPerMinute)/60), burst)
+	}
+}
+
+// WithConcurrency limits the number of instruments processed in parallel, zero or negative removes the limit
+func WithConcurrency(n int) TcfOption {
+	return func(acc *TcfAccount) {
+		acc.concurrency = n
+	}
+}
+
+// WithAccountID sets the broker account used when a request doesn't specify one
+func WithAccountID(accountID string) TcfOption {
+	return func(acc *TcfAccount) {
+		acc.AccountID = accountID
+	}
+}
+
+// newGroup creates the errgroup limited to the configured concurrency
+func (acc *TcfAccount) newGroup(ctx context.Context) (*errgroup.Group, context.Context) {
+
+	group, ctx := errgroup.WithContext(ctx)
+	if acc.concurrency > 0 {
+		group.SetLimit(acc.concurrency)
+	}
+
+	return group, ctx
+}
+
+func (acc *TcfAccount) timeoutOr(def time.Duration) time.Duration {
+	if acc.timeout > 0 {
+		return acc.timeout
+	}
+	return def
+}
+
+func (acc *TcfAccount) calculationTimeoutOr(def time.Duration) time.Duration {
+	if acc.calculationTimeout > 0 {
+		return acc.calculationTimeout
+	}
+	return def
+}
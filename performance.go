@@ -0,0 +1,304 @@
+package tinkoff
+
+import (
+	"context"
+	"math"
+	"sort"
+	"time"
+)
+
+// TcfDrawdown is the decline of the value from a peak to the following trough
+type TcfDrawdown struct {
+	// Depth is the decline in percents of the peak value
+	Depth    float64
+	PeakAt   time.Time
+	TroughAt time.Time
+	// RecoveredAt is the time the value got back to the peak, zero if it has not recovered yet
+	RecoveredAt time.Time
+}
+
+// Recovered reports if the value has got back to the peak
+func (d *TcfDrawdown) Recovered() bool {
+	return !d.RecoveredAt.IsZero()
+}
+
+type TcfPerformanceStatsRequest struct {
+	AccountID  string
+	PeriodFrom time.Time
+	PeriodTo   time.Time
+	// RiskFreeRate is the annual rate of the currency (e.g. 0.16 for 16%), the same rate is used for all the currencies
+	RiskFreeRate float64
+	// VaRConfidences are the confidence levels of the value at risk (0.95 and 0.99 by default),
+	// VaRHorizons are the horizons in days (1 by default). The value at risk is estimated for every combination
+	VaRConfidences []float64
+	VaRHorizons    []int
+}
+
+// TcfPerformanceStats are the risk metrics of the value series of a currency
+type TcfPerformanceStats struct {
+	Currency TcfCurrency
+	// MaxDrawdown is nil if the value has never declined
+	MaxDrawdown *TcfDrawdown
+	// Volatility is the annualized standard deviation of the returns, in percents
+	Volatility float64
+	// Sharpe and Sortino are the annualized excess returns over the volatility and over the downside deviation,
+	// zero if the deviation is zero
+	Sharpe  float64
+	Sortino float64
+	// ValueAtRisk are the estimates of the loss of the current value
+	ValueAtRisk []*TcfValueAtRisk
+}
+
+// TcfValueAtRisk is the loss of the current value not exceeded over the horizon with the confidence (VaR)
+// and the average loss in the worst cases beyond it (CVaR), in the currency of the series
+type TcfValueAtRisk struct {
+	Confidence float64
+	// Horizon is the number of the periods of the series, days for the daily series
+	Horizon int
+	// Historical estimates are the quantiles of the observed returns over the horizon (overlapping windows),
+	// Parametric ones assume the normally distributed returns. A negative loss is a gain
+	HistoricalVaR  float64
+	HistoricalCVaR float64
+	ParametricVaR  float64
+	ParametricCVaR float64
+}
+
+// PerformanceStats calculates the metrics of the value series with the annual risk-free rate. Like RollingReturns
+// the series is expected to be adjusted for the deposits and the withdrawals
+func PerformanceStats(series []TcfValuePoint, riskFreeRate float64) *TcfPerformanceStats {
+
+	stats := &TcfPerformanceStats{MaxDrawdown: maxDrawdown(series)}
+
+	returns, periodsPerYear := periodReturns(series)
+	if len(returns) < 2 {
+		return stats
+	}
+
+	// the risk-free rate of one period of the series
+	rf := riskFreeRate / periodsPerYear
+
+	mean := 0.0
+	for _, r := range returns {
+		mean += r
+	}
+	mean /= float64(len(returns))
+
+	variance, downside := 0.0, 0.0
+	for _, r := range returns {
+		variance += (r - mean) * (r - mean)
+		if r < rf {
+			downside += (r - rf) * (r - rf)
+		}
+	}
+	deviation := math.Sqrt(variance / float64(len(returns)-1))
+	downsideDeviation := math.Sqrt(downside / float64(len(returns)))
+
+	stats.Volatility = math.Round(10000*deviation*math.Sqrt(periodsPerYear)) / 100
+
+	excess := (mean - rf) * periodsPerYear
+	if deviation > 0 {
+		stats.Sharpe = math.Round(100*excess/(deviation*math.Sqrt(periodsPerYear))) / 100
+	}
+	if downsideDeviation > 0 {
+		stats.Sortino = math.Round(100*excess/(downsideDeviation*math.Sqrt(periodsPerYear))) / 100
+	}
+
+	return stats
+}
+
+// GetPerformanceStats calculates the metrics of the daily value series of the positions by currency,
+// the series is rebuilt from the returns net of the deposits and the withdrawals (see TcfBalanceSeries.Index)
+func (acc *TcfAccount) GetPerformanceStats(ctx context.Context, request *TcfPerformanceStatsRequest) ([]*TcfPerformanceStats, error) {
+
+	series, err := acc.GetBalanceTimeSeries(ctx, &TcfBalanceTimeSeriesRequest{
+		AccountID:  request.AccountID,
+		PeriodFrom: request.PeriodFrom,
+		PeriodTo:   request.PeriodTo,
+		Bucket:     BucketDay,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	confidences, horizons := request.VaRConfidences, request.VaRHorizons
+	if len(confidences) == 0 {
+		confidences = []float64{0.95, 0.99}
+	}
+	if len(horizons) == 0 {
+		horizons = []int{1}
+	}
+
+	res := []*TcfPerformanceStats{}
+	for _, s := range series {
+		index := s.Index()
+		stats := PerformanceStats(index, request.RiskFreeRate)
+		stats.Currency = s.Currency
+		res = append(res, stats)
+
+		// nothing is at risk if no positions are held at the end of the period
+		if len(s.Points) == 0 || s.Points[len(s.Points)-1].Value <= 0 {
+			continue
+		}
+
+		for _, horizon := range horizons {
+			for _, confidence := range confidences {
+				if v := ValueAtRisk(index, confidence, horizon); v != nil {
+					stats.ValueAtRisk = append(stats.ValueAtRisk, v)
+				}
+			}
+		}
+	}
+
+	return res, nil
+}
+
+// ValueAtRisk estimates the loss of the last value of the series over the horizon with the confidence (e.g. 0.99),
+// nil if the confidence is not in (0, 1) or there are not enough returns
+func ValueAtRisk(series []TcfValuePoint, confidence float64, horizon int) *TcfValueAtRisk {
+
+	if confidence <= 0 || confidence >= 1 || horizon < 1 {
+		return nil
+	}
+
+	returns, _ := periodReturns(series)
+	if len(returns) < horizon+1 {
+		return nil
+	}
+
+	value := latestValue(series)
+
+	res := &TcfValueAtRisk{Confidence: confidence, Horizon: horizon}
+
+	// historical: the compound returns of the overlapping windows of the horizon
+	windows := []float64{}
+	for i := 0; i+horizon <= len(returns); i++ {
+		growth := 1.0
+		for _, r := range returns[i : i+horizon] {
+			growth *= 1 + r
+		}
+		windows = append(windows, growth-1)
+	}
+	sort.Float64s(windows)
+
+	tail := int(math.Ceil((1 - confidence) * float64(len(windows))))
+	if tail < 1 {
+		tail = 1
+	}
+	tailSum := 0.0
+	for _, r := range windows[:tail] {
+		tailSum += r
+	}
+	res.HistoricalVaR = math.Round(-100*value*windows[tail-1]) / 100
+	res.HistoricalCVaR = math.Round(-100*value*tailSum/float64(tail)) / 100
+
+	// parametric: the normal distribution with the mean and the deviation of the returns scaled to the horizon
+	mean := 0.0
+	for _, r := range returns {
+		mean += r
+	}
+	mean /= float64(len(returns))
+
+	variance := 0.0
+	for _, r := range returns {
+		variance += (r - mean) * (r - mean)
+	}
+	deviation := math.Sqrt(variance/float64(len(returns)-1)) * math.Sqrt(float64(horizon))
+	mean *= float64(horizon)
+
+	// the standard normal quantile of the tail and its density
+	z := math.Sqrt2 * math.Erfinv(1-2*confidence)
+	density := math.Exp(-z*z/2) / math.Sqrt(2*math.Pi)
+
+	res.ParametricVaR = math.Round(-100*value*(mean+z*deviation)) / 100
+	res.ParametricCVaR = math.Round(-100*value*(mean-deviation*density/(1-confidence))) / 100
+
+	return res
+}
+
+// latestValue returns the value of the latest point of the series
+func latestValue(series []TcfValuePoint) float64 {
+
+	var latest TcfValuePoint
+	for i, point := range series {
+		if i == 0 || point.Time.After(latest.Time) {
+			latest = point
+		}
+	}
+
+	return latest.Value
+}
+
+// periodReturns returns the returns between the consecutive points and the number of the periods in a year
+// by the average distance between the points
+func periodReturns(series []TcfValuePoint) ([]float64, float64) {
+
+	points := make([]TcfValuePoint, len(series))
+	copy(points, series)
+	sort.SliceStable(points, func(i, j int) bool {
+		return points[i].Time.Before(points[j].Time)
+	})
+
+	if len(points) < 2 {
+		return nil, 0
+	}
+
+	returns := []float64{}
+	for i := 1; i < len(points); i++ {
+		if points[i-1].Value > 0 {
+			returns = append(returns, points[i].Value/points[i-1].Value-1)
+		}
+	}
+
+	step := points[len(points)-1].Time.Sub(points[0].Time) / time.Duration(len(points)-1)
+	if step <= 0 {
+		return nil, 0
+	}
+
+	return returns, float64(365*24*time.Hour) / float64(step)
+}
+
+func maxDrawdown(series []TcfValuePoint) *TcfDrawdown {
+
+	points := make([]TcfValuePoint, len(series))
+	copy(points, series)
+	sort.SliceStable(points, func(i, j int) bool {
+		return points[i].Time.Before(points[j].Time)
+	})
+
+	var res *TcfDrawdown
+	var current *TcfDrawdown
+	peak := TcfValuePoint{}
+
+	for i, point := range points {
+
+		if i == 0 || point.Value >= peak.Value {
+			if current != nil {
+				current.RecoveredAt = point.Time
+			}
+			peak, current = point, nil
+			continue
+		}
+
+		if peak.Value <= 0 {
+			continue
+		}
+
+		depth := 100 * (peak.Value - point.Value) / peak.Value
+		if current == nil {
+			current = &TcfDrawdown{PeakAt: peak.Time}
+		}
+		if depth > current.Depth {
+			current.Depth = depth
+			current.TroughAt = point.Time
+		}
+		if res == nil || current.Depth > res.Depth {
+			res = current
+		}
+	}
+
+	if res != nil {
+		res.Depth = math.Round(100*res.Depth) / 100
+	}
+
+	return res
+}
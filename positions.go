@@ -0,0 +1,125 @@
+package tinkoff
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"time"
+
+	sdk "github.com/TinkoffCreditSystems/invest-openapi-go-sdk"
+)
+
+// TcfPositionDiscrepancy is a position whose quantity calculated by the operations differs from the broker's one,
+// usually the history is incomplete (the period starts after the purchases, the securities transferred in)
+type TcfPositionDiscrepancy struct {
+	FIGI     string  `json:"figi" report:"FIGI"`
+	Ticker   string  `json:"ticker" report:"Ticker"`
+	Computed int     `json:"computed" report:"Computed"`
+	Actual   float64 `json:"actual" report:"Actual"`
+	// Difference is the actual quantity minus the computed one
+	Difference float64 `json:"difference" report:"Difference"`
+}
+
+// ReconcilePositions compares the quantities of the balance items with the portfolio positions, the positions
+// without the items are compared as zero. The currency positions are skipped, their balance is cash
+func ReconcilePositions(items []*TcfBalanceItem, positions []sdk.PositionBalance) []*TcfPositionDiscrepancy {
+
+	actual := make(map[string]sdk.PositionBalance)
+	for _, position := range positions {
+		if position.InstrumentType != sdk.InstrumentTypeCurrency {
+			actual[position.FIGI] = position
+		}
+	}
+
+	res := []*TcfPositionDiscrepancy{}
+	compared := make(map[string]bool)
+
+	for _, item := range items {
+
+		position := actual[item.FIGI]
+		compared[item.FIGI] = true
+
+		if difference := position.Balance - float64(item.PortfolioQuantity); math.Abs(difference) > 1e-9 {
+			res = append(res, &TcfPositionDiscrepancy{
+				FIGI:       item.FIGI,
+				Ticker:     item.Ticker,
+				Computed:   item.PortfolioQuantity,
+				Actual:     position.Balance,
+				Difference: difference,
+			})
+		}
+	}
+
+	for figi, position := range actual {
+		if !compared[figi] && position.Balance != 0 {
+			res = append(res, &TcfPositionDiscrepancy{
+				FIGI:       figi,
+				Ticker:     position.Ticker,
+				Actual:     position.Balance,
+				Difference: position.Balance,
+			})
+		}
+	}
+
+	sort.SliceStable(res, func(i, j int) bool {
+		return res[i].Ticker < res[j].Ticker
+	})
+
+	return res
+}
+
+// reconcilePositions adds the discrepancies of the balance items against the current portfolio to the balance,
+// the items of the currencies bought on the exchange are not compared
+func (acc *TcfAccount) reconcilePositions(ctx context.Context, accountID string, balance *TcfPortfolioBalance, operations []sdk.Operation) error {
+
+	var portfolio sdk.Portfolio
+	err := acc.call(ctx, 20*time.Second, func(ctx context.Context) (err error) {
+		portfolio, err = acc.Client.Portfolio(ctx, acc.accountID(accountID))
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	currencies := make(map[string]bool)
+	for _, oper := range operations {
+		if oper.InstrumentType == sdk.InstrumentTypeCurrency {
+			currencies[oper.FIGI] = true
+		}
+	}
+
+	items := []*TcfBalanceItem{}
+	for _, item := range balance.Items {
+		if !currencies[item.FIGI] {
+			items = append(items, item)
+		}
+	}
+
+	balance.Discrepancies = ReconcilePositions(items, portfolio.Positions)
+
+	// less computed than held means the purchases before the period or the transfers in are missing,
+	// a short position held in the portfolio as well is not a discrepancy
+	for _, d := range balance.Discrepancies {
+
+		warning := TcfWarning{
+			Code:    WarningQuantityMismatch,
+			FIGI:    d.FIGI,
+			Message: fmt.Sprintf("Computed quantity %d, the portfolio holds %v", d.Computed, d.Actual),
+		}
+		if d.Difference > 0 {
+			warning.Code = WarningIncompleteHistory
+			warning.Message = fmt.Sprintf("Computed quantity %d, the portfolio holds %v, the history misses the purchases or the transfers in", d.Computed, d.Actual)
+		}
+
+		balance.Warnings = append(balance.Warnings, warning)
+	}
+
+	return nil
+}
+
+// PrintPositionDiscrepancies prints the positions the computed quantity of which differs from the portfolio
+func PrintPositionDiscrepancies(w io.Writer, discrepancies []*TcfPositionDiscrepancy) {
+	RenderTable(w, discrepancies)
+}
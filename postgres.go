@@ -0,0 +1,90 @@
+package tinkoff
+
+import (
+	"context"
+	"database/sql"
+)
+
+// TcfPostgresStore keeps the balance snapshots and the operations in PostgreSQL. The database is opened by the caller
+// with the driver of choice (e.g. github.com/lib/pq or github.com/jackc/pgx/v5/stdlib)
+type TcfPostgresStore struct {
+	sqlStore
+}
+
+var postgresSchema = []string{
+	`CREATE TABLE IF NOT EXISTS balance_snapshots (
+		id       BIGSERIAL PRIMARY KEY,
+		taken_at BIGINT NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS balance_snapshots_taken_at ON balance_snapshots (taken_at)`,
+	`CREATE TABLE IF NOT EXISTS balance_snapshot_items (
+		snapshot_id               BIGINT NOT NULL REFERENCES balance_snapshots (id) ON DELETE CASCADE,
+		position                  INTEGER NOT NULL,
+		figi                      TEXT NOT NULL,
+		ticker                    TEXT NOT NULL,
+		name                      TEXT NOT NULL,
+		currency                  TEXT NOT NULL,
+		operation_amount          NUMERIC NOT NULL,
+		broker_commission_amount  NUMERIC NOT NULL,
+		current_price             NUMERIC NOT NULL,
+		portfolio_amount          NUMERIC NOT NULL,
+		portfolio_quantity        INTEGER NOT NULL,
+		dividend_amount           NUMERIC NOT NULL,
+		dividend_tax_amount       NUMERIC NOT NULL,
+		service_commission_amount NUMERIC NOT NULL,
+		balance_amount            NUMERIC NOT NULL,
+		margin_fee_amount         NUMERIC NOT NULL,
+		realized_pnl              NUMERIC NOT NULL,
+		unrealized_pnl            NUMERIC NOT NULL,
+		xirr                      DOUBLE PRECISION NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS balance_snapshot_items_snapshot_id ON balance_snapshot_items (snapshot_id)`,
+	`CREATE TABLE IF NOT EXISTS balance_snapshot_totals (
+		snapshot_id               BIGINT NOT NULL REFERENCES balance_snapshots (id) ON DELETE CASCADE,
+		currency                  TEXT NOT NULL,
+		balance_amount            NUMERIC NOT NULL,
+		service_commission_amount NUMERIC NOT NULL,
+		tax_back                  NUMERIC NOT NULL,
+		portfolio_amount          NUMERIC NOT NULL,
+		xirr                      DOUBLE PRECISION NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS balance_snapshot_totals_snapshot_id ON balance_snapshot_totals (snapshot_id)`,
+	`CREATE TABLE IF NOT EXISTS operations (
+		account_id     TEXT NOT NULL,
+		id             TEXT NOT NULL,
+		date_time      BIGINT NOT NULL,
+		figi           TEXT NOT NULL,
+		operation_type TEXT NOT NULL,
+		data           JSONB NOT NULL,
+		PRIMARY KEY (account_id, id)
+	)`,
+	`CREATE INDEX IF NOT EXISTS operations_date_time ON operations (account_id, date_time)`,
+	`CREATE TABLE IF NOT EXISTS operations_sync (
+		account_id TEXT PRIMARY KEY,
+		synced_at  BIGINT NOT NULL
+	)`,
+}
+
+// postgresColumns are added to the tables created by the earlier versions
+var postgresColumns = []sqlColumn{
+	{table: "balance_snapshot_items", name: "coupon_amount", definition: "NUMERIC NOT NULL DEFAULT 0"},
+	{table: "balance_snapshot_items", name: "coupon_tax_amount", definition: "NUMERIC NOT NULL DEFAULT 0"},
+	{table: "balance_snapshot_items", name: "repayment_amount", definition: "NUMERIC NOT NULL DEFAULT 0"},
+	{table: "balance_snapshot_items", name: "accrued_interest", definition: "NUMERIC NOT NULL DEFAULT 0"},
+	{table: "balance_snapshot_items", name: "accrued_interest_paid", definition: "NUMERIC NOT NULL DEFAULT 0"},
+	{table: "balance_snapshot_items", name: "ytm", definition: "DOUBLE PRECISION NOT NULL DEFAULT 0"},
+	{table: "balance_snapshot_items", name: "modified_duration", definition: "DOUBLE PRECISION NOT NULL DEFAULT 0"},
+	{table: "balance_snapshot_items", name: "details", definition: "JSONB NOT NULL DEFAULT '{}'"},
+	{table: "balance_snapshots", name: "details", definition: "JSONB NOT NULL DEFAULT '{}'"},
+}
+
+// NewPostgresStore creates the tables if they don't exist
+func NewPostgresStore(ctx context.Context, db *sql.DB) (*TcfPostgresStore, error) {
+
+	store, err := newSQLStore(ctx, db, sqlDialect{numbered: true, returning: true}, postgresSchema, postgresColumns)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TcfPostgresStore{sqlStore: store}, nil
+}
@@ -0,0 +1,150 @@
+package tinkoff
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	sdk "github.com/TinkoffCreditSystems/invest-openapi-go-sdk"
+)
+
+// candleMaxPeriods are the longest periods the API returns the candles of the interval for by one request
+var candleMaxPeriods = map[sdk.CandleInterval]time.Duration{
+	"1min":  24 * time.Hour,
+	"2min":  24 * time.Hour,
+	"3min":  24 * time.Hour,
+	"5min":  24 * time.Hour,
+	"10min": 24 * time.Hour,
+	"15min": 24 * time.Hour,
+	"30min": 24 * time.Hour,
+	"hour":  7 * 24 * time.Hour,
+	"day":   365 * 24 * time.Hour,
+	"week":  2 * 365 * 24 * time.Hour,
+	"month": 10 * 365 * 24 * time.Hour,
+}
+
+// TcfCandleRequirement is the history an indicator or a strategy needs
+type TcfCandleRequirement struct {
+	FIGI     string
+	Interval sdk.CandleInterval
+	Lookback time.Duration
+}
+
+// TcfCandleFetch is an API request of the candles
+type TcfCandleFetch struct {
+	FIGI     string
+	Interval sdk.CandleInterval
+	From     time.Time
+	To       time.Time
+}
+
+// PlanCandlePrefetch merges the requirements of the same FIGI and interval and returns the requests
+// of the candles missing in the store, split by the longest period the API allows. The last stored candle
+// is requested again as it may have been stored while forming
+func PlanCandlePrefetch(store TcfCandleStore, requirements []TcfCandleRequirement, now time.Time) ([]*TcfCandleFetch, error) {
+
+	type key struct {
+		figi     string
+		interval sdk.CandleInterval
+	}
+
+	lookbacks := make(map[key]time.Duration)
+	for _, r := range requirements {
+		if _, ok := candleMaxPeriods[r.Interval]; !ok {
+			return nil, errors.New(fmt.Sprintf("Unknown candle interval %s", r.Interval))
+		}
+		k := key{figi: r.FIGI, interval: r.Interval}
+		if r.Lookback > lookbacks[k] {
+			lookbacks[k] = r.Lookback
+		}
+	}
+
+	res := []*TcfCandleFetch{}
+
+	for k, lookback := range lookbacks {
+
+		from := now.Add(-lookback)
+
+		stored, err := store.LoadCandles(k.figi, k.interval, from, now)
+		if err != nil {
+			return nil, err
+		}
+
+		gaps := [][2]time.Time{{from, now}}
+		if len(stored) > 0 {
+			gaps = [][2]time.Time{{from, stored[0].TS}, {stored[len(stored)-1].TS, now}}
+		}
+
+		maxPeriod := candleMaxPeriods[k.interval]
+		for _, gap := range gaps {
+			for start := gap[0]; start.Before(gap[1]); start = start.Add(maxPeriod) {
+				end := start.Add(maxPeriod)
+				if end.After(gap[1]) {
+					end = gap[1]
+				}
+				res = append(res, &TcfCandleFetch{FIGI: k.figi, Interval: k.interval, From: start, To: end})
+			}
+		}
+	}
+
+	sort.SliceStable(res, func(i, j int) bool {
+		if res[i].FIGI != res[j].FIGI {
+			return res[i].FIGI < res[j].FIGI
+		}
+		if res[i].Interval != res[j].Interval {
+			return res[i].Interval < res[j].Interval
+		}
+		return res[i].From.Before(res[j].From)
+	})
+
+	return res, nil
+}
+
+// PrefetchCandles fetches the candles missing for the requirements into the store in parallel,
+// the requests are rate limited as any other. The number of the fetched candles is returned
+func (acc *TcfAccount) PrefetchCandles(ctx context.Context, store TcfCandleStore, requirements []TcfCandleRequirement) (int, error) {
+
+	fetches, err := PlanCandlePrefetch(store, requirements, time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	group, ctx := acc.newGroup(ctx)
+	var mu sync.Mutex
+	total := 0
+
+	for _, fetch := range fetches {
+
+		fetch := fetch
+		group.Go(func() error {
+
+			var candles []sdk.Candle
+			err := acc.call(ctx, 10*time.Second, func(ctx context.Context) (err error) {
+				candles, err = acc.Client.Candles(ctx, fetch.From, fetch.To, fetch.Interval, fetch.FIGI)
+				return err
+			})
+			if err != nil {
+				return err
+			}
+
+			if len(candles) == 0 {
+				return nil
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			total += len(candles)
+			return store.SaveCandles(candles)
+		})
+	}
+
+	if err := group.Wait(); err != nil {
+		return 0, err
+	}
+
+	return total, nil
+}
@@ -0,0 +1,99 @@
+package tinkoff
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	sdk "github.com/TinkoffCreditSystems/invest-openapi-go-sdk"
+)
+
+type cachedPrice struct {
+	price     float64
+	at        time.Time // time of the candle the price is taken from
+	fetchedAt time.Time
+}
+
+type priceCache struct {
+	mu     sync.Mutex
+	ttl    time.Duration
+	prices map[string]cachedPrice
+}
+
+// WithPriceCache makes the current prices to be reused for the ttl, zero ttl disables the cache
+func WithPriceCache(ttl time.Duration) TcfOption {
+	return func(acc *TcfAccount) {
+		acc.prices.ttl = ttl
+	}
+}
+
+func (c *priceCache) get(figi string) (float64, time.Time, bool) {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.ttl == 0 {
+		return 0.0, time.Time{}, false
+	}
+
+	cached, ok := c.prices[figi]
+	if !ok || time.Since(cached.fetchedAt) > c.ttl {
+		return 0.0, time.Time{}, false
+	}
+
+	return cached.price, cached.at, true
+}
+
+func (c *priceCache) put(figi string, price float64, at time.Time) {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.ttl == 0 {
+		return
+	}
+
+	if c.prices == nil {
+		c.prices = make(map[string]cachedPrice)
+	}
+
+	c.prices[figi] = cachedPrice{price: price, at: at, fetchedAt: time.Now()}
+}
+
+// WarmPrices prefetches the current prices of the FIGIs concurrently into the price cache
+func (acc *TcfAccount) WarmPrices(ctx context.Context, figis []string) error {
+
+	group, ctx := acc.newGroup(ctx)
+
+	for _, figi := range figis {
+		figi := figi
+		group.Go(func() error {
+			_, err := acc.GetCurrentPrice(ctx, figi)
+			return err
+		})
+	}
+
+	return group.Wait()
+}
+
+// priceAt returns the close price of the last daily candle on or before the time, the week before is searched
+func (acc *TcfAccount) priceAt(ctx context.Context, figi string, t time.Time) (float64, error) {
+
+	var candles []sdk.Candle
+	err := acc.call(ctx, 10*time.Second, func(ctx context.Context) (err error) {
+		candles, err = acc.Client.Candles(ctx, t.Add(-7*24*time.Hour), t, sdk.CandleInterval1Day, figi)
+		return err
+	})
+	if err != nil {
+		return 0.0, err
+	}
+
+	candle := candleLatest(candles)
+	if candle == nil {
+		return 0.0, errors.New(fmt.Sprintf("Price of %s at %s not found", figi, t.Format("2006-01-02")))
+	}
+
+	return candle.ClosePrice, nil
+}
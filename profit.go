@@ -0,0 +1,158 @@
+package tinkoff
+
+import (
+	"context"
+	"math"
+	"sort"
+	"time"
+
+	sdk "github.com/TinkoffCreditSystems/invest-openapi-go-sdk"
+	"github.com/mikhailbolshakov/tinkoff/utils"
+)
+
+type TcfProfitRequest struct {
+	AccountID         string
+	PeriodFrom        time.Time
+	PeriodTo          time.Time
+	Figi              string
+	ForWholePortfolio bool
+}
+
+type TcfProfitResponse struct {
+	Figi string
+	// Currency is the currency of the profit, the profit of a FIGI paid in several currencies is one item per currency
+	Currency    TcfCurrency
+	ProfitTotal float32
+	PeriodFrom  time.Time
+	PeriodTo    time.Time
+	Warnings    []TcfWarning
+}
+
+type profitKey struct {
+	figi     string
+	currency TcfCurrency
+}
+
+// GetProfit returns the profit per FIGI (or a single item per currency for the whole portfolio) over the period.
+// The realized profit is the gain of the sells in the period against the earliest bought lots (FIFO)
+// plus the income (dividends, coupons) net of the tax, the unrealized profit is the expected yield
+// of the positions open now at the current prices, even if the period ends in the past
+func (acc *TcfAccount) GetProfit(ctx context.Context, request *TcfProfitRequest) ([]TcfProfitResponse, error) {
+
+	figi := request.Figi
+	if request.ForWholePortfolio {
+		figi = ""
+	}
+
+	// the lots sold in the period may be bought before it
+	operations, err := acc.GetOperations(ctx, &TcfGetOperationsRequest{
+		AccountID:  request.AccountID,
+		PeriodFrom: time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC),
+		PeriodTo:   request.PeriodTo,
+		Figi:       figi,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var positions []sdk.PositionBalance
+	err = acc.call(ctx, 20*time.Second, func(ctx context.Context) (err error) {
+		positions, err = acc.Client.PositionsPortfolio(ctx, acc.accountID(request.AccountID))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	profit := make(map[profitKey]float64)
+	warnings := make(map[string][]TcfWarning)
+
+	add := func(figi, currency string, amount float64) error {
+		if err := TcfCurrency(currency).Validate(); err != nil {
+			return err
+		}
+		profit[profitKey{figi: figi, currency: TcfCurrency(currency)}] += amount
+		return nil
+	}
+
+	for _, p := range positions {
+		if (figi == "" || p.FIGI == figi) && p.ExpectedYield.Value != 0 {
+			if err := add(p.FIGI, string(p.ExpectedYield.Currency), p.ExpectedYield.Value); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	for f, figiOperations := range utils.ByFigi(operations) {
+
+		if quantity := unmatchedQuantity(figiOperations); quantity > 0 {
+			warnings[f] = append(warnings[f], TcfWarning{
+				Code:    WarningIncompleteHistory,
+				FIGI:    f,
+				Message: "The sells without the purchases in the history are not counted",
+			})
+		}
+
+		_, realized := replayLots(figiOperations)
+		for _, gain := range realized {
+			if !gain.ClosedAt.Before(request.PeriodFrom) {
+				if err := add(f, string(gain.Currency), gain.GainAmount.InexactFloat64()); err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		for _, oper := range figiOperations {
+			if oper.DateTime.Before(request.PeriodFrom) {
+				continue
+			}
+			switch oper.OperationType {
+			case sdk.OperationTypeDividend, sdk.OperationTypeCoupon, sdk.OperationTypeTaxDividend, sdk.OperationTypeTaxCoupon:
+				if err := add(f, string(oper.Currency), oper.Payment); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	res := []TcfProfitResponse{}
+
+	// the amounts of the different currencies are not summed up, the whole portfolio is one item per currency
+	if request.ForWholePortfolio {
+		totals := make(map[TcfCurrency]float64)
+		all := make(map[TcfCurrency][]TcfWarning)
+		for key, p := range profit {
+			totals[key.currency] += p
+			all[key.currency] = append(all[key.currency], warnings[key.figi]...)
+		}
+		for currency, total := range totals {
+			res = append(res, TcfProfitResponse{
+				Currency:    currency,
+				ProfitTotal: float32(math.Round(100*total) / 100),
+				PeriodFrom:  request.PeriodFrom,
+				PeriodTo:    request.PeriodTo,
+				Warnings:    all[currency],
+			})
+		}
+	} else {
+		for key, p := range profit {
+			res = append(res, TcfProfitResponse{
+				Figi:        key.figi,
+				Currency:    key.currency,
+				ProfitTotal: float32(math.Round(100*p) / 100),
+				PeriodFrom:  request.PeriodFrom,
+				PeriodTo:    request.PeriodTo,
+				Warnings:    warnings[key.figi],
+			})
+		}
+	}
+
+	sort.SliceStable(res, func(i, j int) bool {
+		if res[i].Figi != res[j].Figi {
+			return res[i].Figi < res[j].Figi
+		}
+		return res[i].Currency < res[j].Currency
+	})
+
+	return res, nil
+}
@@ -0,0 +1,152 @@
+package tinkoff
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	sdk "github.com/TinkoffCreditSystems/invest-openapi-go-sdk"
+	"github.com/mikhailbolshakov/tinkoff/utils"
+	"github.com/shopspring/decimal"
+)
+
+type TcfDividendProjectionRequest struct {
+	AccountID string
+	// Regimes maps the country of the issuer (the ISIN prefix, e.g. "US") or the FIGI to the withholding regime
+	// of the dividends paid in a foreign currency, the FIGI one takes precedence. The US dividends are taxed
+	// without W-8BEN unless configured, the other countries withhold nothing and the russian tax is declared
+	Regimes map[string]TcfWithholdingRegime
+}
+
+type TcfDividendProjectionItem struct {
+	FIGI     string
+	Ticker   string
+	Currency TcfCurrency
+	// GrossAmount is the dividends paid for the last 12 months scaled to the current quantity
+	GrossAmount decimal.Decimal
+	// TaxRate is the total tax rate (withheld abroad and declared in Russia) in percents
+	TaxRate   float64
+	NetAmount decimal.Decimal
+}
+
+type TcfDividendProjection struct {
+	Items []*TcfDividendProjectionItem
+	// NetByCurrency is the projected annual net income by currency
+	NetByCurrency map[TcfCurrency]decimal.Decimal
+}
+
+// dividendTaxRate returns the total tax rate of the dividend paid in the currency by the issuer of the ISIN
+func dividendTaxRate(currency TcfCurrency, figi, isin string, regimes map[string]TcfWithholdingRegime) decimal.Decimal {
+
+	// the broker withholds the russian tax from the dividends paid in roubles
+	if currency == CurrencyRUB {
+		return decimal.NewFromFloat(ruTaxRate)
+	}
+
+	if regime, ok := regimes[figi]; ok {
+		return regime.TotalRate()
+	}
+
+	country := ""
+	if len(isin) >= 2 {
+		country = isin[:2]
+	}
+	if regime, ok := regimes[country]; ok {
+		return regime.TotalRate()
+	}
+	if country == "US" {
+		return WithholdingUSNoW8BEN.TotalRate()
+	}
+
+	return TcfWithholdingRegime{}.TotalRate()
+}
+
+// ProjectDividends projects the annual net dividend income of the held positions from the last 12 months payments
+func (acc *TcfAccount) ProjectDividends(ctx context.Context, request *TcfDividendProjectionRequest) (*TcfDividendProjection, error) {
+
+	to := time.Now()
+	from := to.AddDate(-1, 0, 0)
+
+	operations, err := acc.GetOperations(ctx, &TcfGetOperationsRequest{
+		AccountID:    request.AccountID,
+		PeriodFrom:   from,
+		PeriodTo:     to,
+		ForPortfolio: true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var portfolio sdk.Portfolio
+	err = acc.call(ctx, 20*time.Second, func(ctx context.Context) (err error) {
+		portfolio, err = acc.Client.Portfolio(ctx, acc.accountID(request.AccountID))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// the quantity held when the dividend was paid is restored replaying the trades back from the current one
+	quantities := make(map[string]float64)
+	tickers := make(map[string]string)
+	isins := make(map[string]string)
+	for _, p := range portfolio.Positions {
+		quantities[p.FIGI] = p.Balance
+		tickers[p.FIGI] = p.Ticker
+		isins[p.FIGI] = p.ISIN
+	}
+
+	projection := &TcfDividendProjection{Items: []*TcfDividendProjectionItem{}, NetByCurrency: make(map[TcfCurrency]decimal.Decimal)}
+
+	for figi, figiOperations := range utils.ByFigi(operations) {
+
+		current, ok := quantities[figi]
+		if !ok || current <= 0 {
+			continue
+		}
+
+		sort.SliceStable(figiOperations, func(i, j int) bool {
+			return figiOperations[i].DateTime.After(figiOperations[j].DateTime)
+		})
+
+		gross := make(map[TcfCurrency]decimal.Decimal)
+		quantity := current
+
+		for _, operation := range figiOperations {
+			switch operation.OperationType {
+			case "Buy", "BuyCard":
+				quantity -= float64(operation.Quantity)
+			case "Sell":
+				quantity += float64(operation.Quantity)
+			case "Dividend":
+				if quantity > 0 {
+					currency := TcfCurrency(operation.Currency)
+					gross[currency] = gross[currency].Add(moneyAbs(operation.Payment).Mul(decimal.NewFromFloat(current / quantity)))
+				}
+			}
+		}
+
+		for currency, amount := range gross {
+
+			rate := dividendTaxRate(currency, figi, isins[figi], request.Regimes)
+
+			item := &TcfDividendProjectionItem{
+				FIGI:        figi,
+				Ticker:      tickers[figi],
+				Currency:    currency,
+				GrossAmount: amount,
+				TaxRate:     rate.Mul(decimal.NewFromInt(100)).Round(2).InexactFloat64(),
+				NetAmount:   amount.Mul(decimal.NewFromInt(1).Sub(rate)),
+			}
+
+			projection.Items = append(projection.Items, item)
+			projection.NetByCurrency[currency] = projection.NetByCurrency[currency].Add(item.NetAmount)
+		}
+	}
+
+	sort.SliceStable(projection.Items, func(i, j int) bool {
+		return projection.Items[i].NetAmount.GreaterThan(projection.Items[j].NetAmount)
+	})
+
+	return projection, nil
+}
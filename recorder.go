@@ -0,0 +1,176 @@
+package tinkoff
+
+import (
+	"context"
+	"log"
+	"math/rand"
+	"os"
+	"time"
+
+	sdk "github.com/TinkoffCreditSystems/invest-openapi-go-sdk"
+)
+
+// TcfCandleRecorder subscribes to 1-minute candle streams and appends the closed candles to the store,
+// building a local candle archive beyond the API retention
+type TcfCandleRecorder struct {
+	Account *TcfAccount
+	Store   TcfCandleStore
+	FIGIs   []string
+	Logger  sdk.Logger
+	// ReconnectDelay is the pause before reconnecting after the stream fails, 5 seconds by default
+	ReconnectDelay time.Duration
+}
+
+// Run records the candles until the context is cancelled. Before (re)connecting to the stream
+// the gap since the last stored candle is backfilled, so the local dataset stays continuous
+func (r *TcfCandleRecorder) Run(ctx context.Context) error {
+
+	if r.Logger == nil {
+		r.Logger = log.New(os.Stdout, "[recorder] ", log.LstdFlags)
+	}
+
+	delay := r.ReconnectDelay
+	if delay == 0 {
+		delay = 5 * time.Second
+	}
+
+	for {
+
+		err := r.backfill(ctx)
+		if err == nil {
+			err = r.stream(ctx)
+		}
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		r.Logger.Printf("stream failed: %v, reconnecting in %v", err, delay)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(delay):
+		}
+	}
+}
+
+// backfill fetches via REST the candles missed since the last stored candle of every FIGI
+func (r *TcfCandleRecorder) backfill(ctx context.Context) error {
+
+	// the current minute is still forming, it comes from the stream
+	now := time.Now().Truncate(time.Minute)
+
+	for _, figi := range r.FIGIs {
+
+		last, err := r.Store.LastCandle(figi, sdk.CandleInterval1Min)
+		if err != nil {
+			return err
+		}
+
+		// nothing recorded yet, so there is no gap to fill
+		if last == nil {
+			continue
+		}
+
+		from := last.TS.Add(time.Minute)
+
+		// 1-minute candles are requested by one day at most
+		for from.Before(now) {
+
+			to := from.Add(24 * time.Hour)
+			if to.After(now) {
+				to = now
+			}
+
+			var candles []sdk.Candle
+			err := r.Account.call(ctx, 10*time.Second, func(ctx context.Context) (err error) {
+				candles, err = r.Account.Client.Candles(ctx, from, to, sdk.CandleInterval1Min, figi)
+				return err
+			})
+			if err != nil {
+				return err
+			}
+
+			if len(candles) > 0 {
+				if err := r.Store.SaveCandles(candles); err != nil {
+					return err
+				}
+				r.Logger.Printf("backfilled %d candles of %s from %v to %v", len(candles), figi, from, to)
+			}
+
+			from = to
+		}
+	}
+
+	return nil
+}
+
+func (r *TcfCandleRecorder) stream(ctx context.Context) error {
+
+	client, err := sdk.NewStreamingClient(r.Logger, r.Account.Token)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			client.Close()
+		case <-done:
+		}
+	}()
+
+	for _, figi := range r.FIGIs {
+		if err := client.SubscribeCandle(figi, sdk.CandleInterval1Min, requestID()); err != nil {
+			return err
+		}
+	}
+
+	// a streamed candle is updated until the next one starts, only the closed candles are stored
+	forming := make(map[string]sdk.Candle)
+
+	return client.RunReadLoop(func(event interface{}) error {
+
+		candleEvent, ok := event.(sdk.CandleEvent)
+		if !ok {
+			return nil
+		}
+
+		candle := sdk.Candle{
+			FIGI:       candleEvent.Candle.FIGI,
+			Interval:   candleEvent.Candle.Interval,
+			OpenPrice:  candleEvent.Candle.OpenPrice,
+			ClosePrice: candleEvent.Candle.ClosePrice,
+			HighPrice:  candleEvent.Candle.HighPrice,
+			LowPrice:   candleEvent.Candle.LowPrice,
+			Volume:     candleEvent.Candle.Volume,
+			TS:         candleEvent.Candle.TS,
+		}
+
+		if prev, ok := forming[candle.FIGI]; ok && prev.TS.Before(candle.TS) {
+			if err := r.Store.SaveCandles([]sdk.Candle{prev}); err != nil {
+				return err
+			}
+		}
+
+		forming[candle.FIGI] = candle
+
+		return nil
+	})
+}
+
+var letterRunes = []rune("abcdefghzABCDEFOPQRSTUVWXYZ")
+
+// Генерируем уникальный ID для запроса
+func requestID() string {
+	b := make([]rune, 12)
+	for i := range b {
+		b[i] = letterRunes[rand.Intn(len(letterRunes))]
+	}
+
+	return string(b)
+}
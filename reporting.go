@@ -1,54 +1,289 @@
 package tinkoff
 
 import (
+	"errors"
+	"fmt"
+	"io"
 	"os"
+	"reflect"
+	"strings"
+	"time"
 
 	"github.com/jedib0t/go-pretty/table"
+	"github.com/jedib0t/go-pretty/text"
+	"github.com/shopspring/decimal"
 )
 
+type TcfReportFormat string
+
+const (
+	ReportFormatText     TcfReportFormat = "text"
+	ReportFormatMarkdown TcfReportFormat = "markdown"
+	ReportFormatHTML     TcfReportFormat = "html"
+	ReportFormatXLSX     TcfReportFormat = "xlsx"
+	ReportFormatCSV      TcfReportFormat = "csv"
+)
+
+// TcfRenderer renders the calculated balance
+type TcfRenderer interface {
+	Render(balance *TcfPortfolioBalance, w io.Writer) error
+}
+
+type TcfTextRenderer struct {
+	Options *TcfReportOptions
+}
+
+func (r TcfTextRenderer) Render(balance *TcfPortfolioBalance, w io.Writer) error {
+	mode := ColorsAuto
+	if r.Options != nil {
+		mode = r.Options.Colors
+	}
+	t, err := balanceTable(balance, w, r.Options, mode.enabled(w))
+	if err != nil {
+		return err
+	}
+	t.Render()
+	printTargetsReached(balance, w, r.Options.formatter())
+	printWarnings(w, balance.Warnings, r.Options.formatter())
+	return nil
+}
+
+type TcfMarkdownRenderer struct {
+	Options *TcfReportOptions
+}
+
+func (r TcfMarkdownRenderer) Render(balance *TcfPortfolioBalance, w io.Writer) error {
+	// the markdown table is rendered without the mirror and written once
+	t, err := balanceTable(balance, nil, r.Options, false)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(w, t.RenderMarkdown())
+	printTargetsReached(balance, w, r.Options.formatter())
+	printWarnings(w, balance.Warnings, r.Options.formatter())
+	return nil
+}
+
+type TcfHTMLRenderer struct {
+	// Heatmap adds the calendar of the daily P&L below the balance table
+	Heatmap  []*TcfHeatmapDay
+	Locale   TcfLocale
+	Computed []TcfComputedColumn
+}
+
+func (r TcfHTMLRenderer) Render(balance *TcfPortfolioBalance, w io.Writer) error {
+	return renderBalanceHTML(balance, r.Heatmap, r.Locale, r.Computed, w)
+}
+
+type TcfXLSXRenderer struct {
+	Locale TcfLocale
+}
+
+func (r TcfXLSXRenderer) Render(balance *TcfPortfolioBalance, w io.Writer) error {
+	return exportBalanceXLSX(balance, r.Locale, w)
+}
+
+// RendererFor returns the renderer of the report format
+func RendererFor(format TcfReportFormat) (TcfRenderer, error) {
+
+	switch format {
+	case ReportFormatText, "":
+		return TcfTextRenderer{}, nil
+	case ReportFormatMarkdown:
+		return TcfMarkdownRenderer{}, nil
+	case ReportFormatHTML:
+		return TcfHTMLRenderer{}, nil
+	case ReportFormatXLSX:
+		return TcfXLSXRenderer{}, nil
+	case ReportFormatCSV:
+		return TcfCSVRenderer{}, nil
+	}
+
+	return nil, errors.New(fmt.Sprintf("Unknown report format %q", string(format)))
+}
+
 func PrintBalanceReport(request *TcfPortfolioBalance) {
+	_ = TcfTextRenderer{}.Render(request, os.Stdout)
+}
+
+// WriteBalanceReport writes the balance report in the given format
+func WriteBalanceReport(balance *TcfPortfolioBalance, w io.Writer, format TcfReportFormat) error {
+
+	renderer, err := RendererFor(format)
+	if err != nil {
+		return err
+	}
+
+	return renderer.Render(balance, w)
+}
+
+func balanceTable(request *TcfPortfolioBalance, w io.Writer, options *TcfReportOptions, colors bool) (table.Writer, error) {
+
+	if options == nil || len(options.Columns) == 0 {
+		defaults := DefaultReportOptions()
+		if options != nil {
+			defaults.Locale = options.Locale
+			defaults.Computed = options.Computed
+		}
+		options = defaults
+	}
+
+	columns := []reportColumn{}
+	configs := []table.ColumnConfig{}
+	for _, c := range options.Columns {
+
+		column, ok := reportColumns[c]
+		if !ok {
+			continue
+		}
+		columns = append(columns, column)
+
+		if colors {
+			config := table.ColumnConfig{Number: len(columns), ColorsFooter: text.Colors{text.Bold}}
+			if c == ColumnBalance {
+				config.Transformer = signColor
+				config.TransformerFooter = signColor
+			}
+			configs = append(configs, config)
+		}
+	}
+
+	// the computed columns are compiled once, an incorrect expression fails the render
+	expressions, err := compileColumns(options.Computed)
+	if err != nil {
+		return nil, err
+	}
+	for i, expr := range expressions {
+		columns = append(columns, computedReportColumn(options.Computed[i].Header, expr))
+	}
 
 	t := table.NewWriter()
-	t.SetOutputMirror(os.Stdout)
-	t.AppendHeader(table.Row{"FIGI",
-		"Ticker",
-		"Name",
-		"Currency",
-		"Balance",
-		"Commission",
-		"Portfolio",
-		"Dividend",
-		"Service commission",
-		"Tax back"})
-
-	for _, row := range request.Items {
-		t.AppendRow([]interface{}{
-			row.FIGI,
-			row.Ticker,
-			row.Name,
-			row.Currency,
-			row.BalanceAmount,
-			row.BrokerCommissionAmount,
-			row.PortfolioAmount,
-			row.DividendAmount - row.DividendTaxAmount,
-			"",
-			"",
-		})
-	}
-
-	for currency, total := range request.Total.Currencies {
-		t.AppendFooter([]interface{}{
-			"",
-			"",
-			"Total",
-			currency,
-			total.BalanceAmount,
-			"",
-			total.PortfolioAmount,
-			"",
-			total.ServiceCommissionAmount,
-			total.TaxBack,
-		})
+	if w != nil {
+		t.SetOutputMirror(w)
+	}
+	t.SetColumnConfigs(configs)
+
+	f := reportFormatter{locale: options.Locale}
+
+	header := table.Row{}
+	for _, column := range columns {
+		header = append(header, f.text(column.header))
+	}
+	t.AppendHeader(header)
+
+	for _, item := range request.Items {
+		row := table.Row{}
+		for _, column := range columns {
+			row = append(row, column.cell(item, f))
+		}
+		t.AppendRow(row)
+	}
+
+	for _, currency := range request.Total.SortedCurrencies() {
+		total := request.Total.Currencies[currency]
+		footer := table.Row{}
+		for _, column := range columns {
+			var value interface{} = ""
+			if column.footer != nil {
+				value = column.footer(currency, total, f)
+			}
+			footer = append(footer, value)
+		}
+		t.AppendFooter(footer)
+	}
+
+	return t, nil
+}
+
+// signColor renders positive amounts green and negative red
+func signColor(val interface{}) string {
+
+	s := fmt.Sprint(val)
+
+	switch {
+	case strings.HasPrefix(s, "-"):
+		return text.FgRed.Sprint(s)
+	case strings.Trim(s, "0., ") != "":
+		return text.FgGreen.Sprint(s)
+	}
+
+	return s
+}
+
+func printTargetsReached(balance *TcfPortfolioBalance, w io.Writer, f reportFormatter) {
+	for _, item := range balance.TargetsReached() {
+		fmt.Fprintf(w, f.text("Target price reached: %s (%s) current %s, target %s")+"\n", item.Ticker, item.FIGI, f.number(item.CurrentPrice, 2), f.number(item.TargetPrice, 2))
+	}
+}
+
+// RenderTable renders any slice of structs (or pointers to structs) as a table.
+// Columns are configured with the `report` field tag: `report:"Header"` sets the column header,
+// `report:"-"` hides the field. Untagged exported fields are rendered with the field name as the header.
+// Decimal amounts are rounded to cents and times are rendered as dates.
+func RenderTable[T any](w io.Writer, rows []T) {
+
+	t := table.NewWriter()
+	t.SetOutputMirror(w)
+
+	rowType := reflect.TypeOf((*T)(nil)).Elem()
+	for rowType.Kind() == reflect.Ptr {
+		rowType = rowType.Elem()
+	}
+
+	if rowType.Kind() != reflect.Struct {
+		return
+	}
+
+	fields := []int{}
+	header := table.Row{}
+
+	for i := 0; i < rowType.NumField(); i++ {
+
+		field := rowType.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+
+		title := field.Tag.Get("report")
+		if title == "-" {
+			continue
+		}
+		if title == "" {
+			title = field.Name
+		}
+
+		fields = append(fields, i)
+		header = append(header, title)
+	}
+
+	t.AppendHeader(header)
+
+	for _, row := range rows {
+
+		value := reflect.ValueOf(row)
+		for value.Kind() == reflect.Ptr {
+			if value.IsNil() {
+				break
+			}
+			value = value.Elem()
+		}
+
+		if value.Kind() != reflect.Struct {
+			continue
+		}
+
+		r := table.Row{}
+		for _, i := range fields {
+			cell := value.Field(i).Interface()
+			switch v := cell.(type) {
+			case decimal.Decimal:
+				cell = presentMoney(v)
+			case time.Time:
+				cell = v.Format("2006-01-02")
+			}
+			r = append(r, cell)
+		}
+		t.AppendRow(r)
 	}
 
 	t.Render()
@@ -0,0 +1,128 @@
+package tinkoff
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"regexp"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+const (
+	defaultRetryAttempts = 3
+	defaultRetryBackoff  = 500 * time.Millisecond
+	maxRetryBackoff      = 30 * time.Second
+)
+
+// the SDK reports unsuccessful responses as "bad response to <url> code=<status>, ..."
+var statusCodeRe = regexp.MustCompile(`code=(\d{3})`)
+
+// isTransient reports whether the failed request is worth to be repeated
+func isTransient(err error) bool {
+
+	if err == nil {
+		return false
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return true
+	}
+
+	if code, ok := statusCode(err); ok {
+		return code == 429 || code >= 500
+	}
+
+	return false
+}
+
+// isNotFound reports whether the request failed as the requested object doesn't exist
+func isNotFound(err error) bool {
+
+	code, ok := statusCode(err)
+	return ok && code == 404
+}
+
+// statusCode returns the HTTP status of the unsuccessful response reported by the SDK
+func statusCode(err error) (int, bool) {
+
+	if err == nil {
+		return 0, false
+	}
+
+	match := statusCodeRe.FindStringSubmatch(err.Error())
+	if match == nil {
+		return 0, false
+	}
+
+	code, _ := strconv.Atoi(match[1])
+	return code, true
+}
+
+// retryDelay returns the jittered exponential delay before the next attempt, zero base means no delay
+func retryDelay(base time.Duration, attempt int) time.Duration {
+
+	if base <= 0 {
+		return 0
+	}
+
+	// the shift is capped before it's made, so it doesn't overflow
+	delay := maxRetryBackoff
+	if shift := uint(attempt - 1); base <= maxRetryBackoff>>shift {
+		delay = base << shift
+	}
+
+	// equal jitter: a half of the delay is fixed, the other half is random
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// call executes the API request applying the rate limit, the timeout and the retry policy
+func (acc *TcfAccount) call(ctx context.Context, timeout time.Duration, fn func(ctx context.Context) error) error {
+
+	attempts := acc.retryAttempts
+	if attempts < 1 {
+		attempts = 1
+	}
+
+	if acc.chaos != nil {
+		fn = acc.chaos.wrap(fn)
+	}
+
+	var err error
+
+	for attempt := 1; attempt <= attempts; attempt++ {
+
+		if acc.limiter != nil {
+			if err := acc.limiter.Wait(ctx); err != nil {
+				return err
+			}
+		}
+
+		rqCtx, cancel := context.WithTimeout(ctx, acc.timeoutOr(timeout))
+		err = fn(rqCtx)
+		cancel()
+
+		if err == nil || attempt == attempts || ctx.Err() != nil || !isTransient(err) {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(retryDelay(acc.retryBackoff, attempt)):
+		}
+	}
+
+	return err
+}
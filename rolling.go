@@ -0,0 +1,109 @@
+package tinkoff
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// TcfValuePoint is the value of the portfolio at a moment
+type TcfValuePoint struct {
+	Time  time.Time
+	Value float64
+}
+
+type TcfRollingWindow string
+
+const (
+	RollingWindow1M TcfRollingWindow = "1M"
+	RollingWindow3M TcfRollingWindow = "3M"
+	RollingWindow1Y TcfRollingWindow = "1Y"
+)
+
+// start returns the start of the window ending at the time
+func (w TcfRollingWindow) start(end time.Time) time.Time {
+	switch w {
+	case RollingWindow3M:
+		return end.AddDate(0, -3, 0)
+	case RollingWindow1Y:
+		return end.AddDate(-1, 0, 0)
+	default:
+		return end.AddDate(0, -1, 0)
+	}
+}
+
+// TcfRollingReturn is the return in percents over the window ending at the time
+type TcfRollingReturn struct {
+	Start  time.Time
+	Time   time.Time
+	Return float64
+}
+
+// TcfRollingSummary is the series of the rolling returns of a window with the best and the worst ones
+type TcfRollingSummary struct {
+	Window  TcfRollingWindow
+	Series  []*TcfRollingReturn
+	Best    *TcfRollingReturn
+	Worst   *TcfRollingReturn
+	Average float64
+}
+
+// RollingReturns calculates the returns over the window ending at every point of the value series.
+// The series is expected to be adjusted for the deposits and the withdrawals, the points with the window
+// reaching before the series start are skipped
+func RollingReturns(series []TcfValuePoint, window TcfRollingWindow) *TcfRollingSummary {
+
+	points := make([]TcfValuePoint, len(series))
+	copy(points, series)
+	sort.SliceStable(points, func(i, j int) bool {
+		return points[i].Time.Before(points[j].Time)
+	})
+
+	summary := &TcfRollingSummary{Window: window, Series: []*TcfRollingReturn{}}
+	if len(points) == 0 {
+		return summary
+	}
+
+	total := 0.0
+	first := 0
+
+	for _, point := range points {
+
+		start := window.start(point.Time)
+		if start.Before(points[0].Time) {
+			continue
+		}
+
+		// the window starts at the last point on or before the start
+		for first+1 < len(points) && !points[first+1].Time.After(start) {
+			first++
+		}
+
+		base := points[first]
+		if base.Value <= 0 {
+			continue
+		}
+
+		r := &TcfRollingReturn{
+			Start:  base.Time,
+			Time:   point.Time,
+			Return: math.Round(10000*(point.Value/base.Value-1)) / 100,
+		}
+
+		summary.Series = append(summary.Series, r)
+		total += r.Return
+
+		if summary.Best == nil || r.Return > summary.Best.Return {
+			summary.Best = r
+		}
+		if summary.Worst == nil || r.Return < summary.Worst.Return {
+			summary.Worst = r
+		}
+	}
+
+	if len(summary.Series) > 0 {
+		summary.Average = math.Round(100*total/float64(len(summary.Series))) / 100
+	}
+
+	return summary
+}
@@ -0,0 +1,126 @@
+package tinkoff
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+type TcfSellPlanRequest struct {
+	AccountID string
+	FIGI      string
+	Quantity  int
+	// TaxBudget is the maximum tax acceptable for the sale, zero means no budget
+	TaxBudget decimal.Decimal
+}
+
+// TcfLotSale is the part of an open lot consumed by the planned sale
+type TcfLotSale struct {
+	OpenedAt   time.Time
+	Quantity   int
+	Price      decimal.Decimal
+	GainAmount decimal.Decimal
+	Exempt     bool // held longer than 3 years, the gain is not taxed
+}
+
+type TcfSellPlan struct {
+	FIGI         string
+	Quantity     int
+	SellPrice    decimal.Decimal
+	Lots         []*TcfLotSale
+	RealizedGain decimal.Decimal
+	TaxAmount    decimal.Decimal
+	// SuggestedQuantity is the largest quantity up to the requested one whose tax stays within the budget,
+	// it is set only when the requested quantity exceeds the budget
+	SuggestedQuantity int
+}
+
+// PlanSell shows the FIFO lots consumed by selling the quantity at the current price and the resulting tax
+func (acc *TcfAccount) PlanSell(ctx context.Context, request *TcfSellPlanRequest) (*TcfSellPlan, error) {
+
+	if request.Quantity <= 0 {
+		return nil, errors.New(fmt.Sprintf("Invalid quantity %d", request.Quantity))
+	}
+
+	operations, err := acc.GetOperations(ctx, &TcfGetOperationsRequest{
+		AccountID:  request.AccountID,
+		PeriodFrom: time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC),
+		PeriodTo:   time.Now(),
+		Figi:       request.FIGI,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	lots := openLots(operations)
+
+	held := lotsQuantity(lots)
+	if held < request.Quantity {
+		return nil, errors.New(fmt.Sprintf("Not enough quantity of %s: held %d, requested %d", request.FIGI, held, request.Quantity))
+	}
+
+	quote, err := acc.GetCurrentPrice(ctx, request.FIGI)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	plan := planSell(lots, money(quote), request.Quantity, now)
+	plan.FIGI = request.FIGI
+
+	if request.TaxBudget.IsPositive() && plan.TaxAmount.GreaterThan(request.TaxBudget) {
+		for quantity := request.Quantity - 1; quantity >= 0; quantity-- {
+			if planSell(lots, plan.SellPrice, quantity, now).TaxAmount.LessThanOrEqual(request.TaxBudget) {
+				plan.SuggestedQuantity = quantity
+				break
+			}
+		}
+	}
+
+	return plan, nil
+}
+
+// planSell consumes the earliest lots for the quantity, the tax is calculated on the total gain of the taxable lots
+func planSell(lots []*TcfLot, price decimal.Decimal, quantity int, now time.Time) *TcfSellPlan {
+
+	plan := &TcfSellPlan{Quantity: quantity, SellPrice: price, Lots: []*TcfLotSale{}}
+
+	taxable := decimal.Zero
+	left := quantity
+
+	for _, lot := range lots {
+
+		if left == 0 {
+			break
+		}
+
+		matched := lot.Quantity
+		if left < matched {
+			matched = left
+		}
+		left -= matched
+
+		sale := &TcfLotSale{
+			OpenedAt:   lot.OpenedAt,
+			Quantity:   matched,
+			Price:      lot.Price,
+			GainAmount: price.Sub(lot.Price).Mul(decimal.NewFromInt(int64(matched))),
+			Exempt:     now.After(exemptAfter(lot.OpenedAt)),
+		}
+
+		plan.Lots = append(plan.Lots, sale)
+		plan.RealizedGain = plan.RealizedGain.Add(sale.GainAmount)
+		if !sale.Exempt {
+			taxable = taxable.Add(sale.GainAmount)
+		}
+	}
+
+	if taxable.IsPositive() {
+		plan.TaxAmount = taxable.Mul(decimal.NewFromFloat(ruTaxRate)).Round(2)
+	}
+
+	return plan
+}
@@ -0,0 +1,444 @@
+package tinkoff
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	sdk "github.com/TinkoffCreditSystems/invest-openapi-go-sdk"
+	"github.com/shopspring/decimal"
+)
+
+// TcfSnapshot is a balance stored at the time
+type TcfSnapshot struct {
+	ID      int64
+	Time    time.Time
+	Balance *TcfPortfolioBalance
+}
+
+// TcfStore persists the balance snapshots and the operations
+type TcfStore interface {
+	SaveSnapshot(ctx context.Context, balance *TcfPortfolioBalance, at time.Time) (int64, error)
+	SaveOperations(ctx context.Context, accountID string, operations []sdk.Operation) error
+	// LoadRange returns the snapshots taken in the period ordered by time
+	LoadRange(ctx context.Context, from, to time.Time) ([]*TcfSnapshot, error)
+}
+
+// sqlDialect is the difference between the databases the SQL store supports
+type sqlDialect struct {
+	// numbered placeholders ($1, $2...) instead of ?
+	numbered bool
+	// the inserted id is returned by RETURNING instead of LastInsertId
+	returning bool
+}
+
+// sqlStore is the TcfStore on database/sql. The amounts are stored as decimals and the times as the Unix milliseconds,
+// the operations are stored as the API JSON and the balance fields without the columns of their own as JSON details
+type sqlStore struct {
+	DB      *sql.DB
+	dialect sqlDialect
+}
+
+// snapshotDetails are the fields of the balance without the columns of their own, stored as JSON
+type snapshotDetails struct {
+	Warnings      []TcfWarning              `json:"warnings,omitempty"`
+	Discrepancies []*TcfPositionDiscrepancy `json:"discrepancies,omitempty"`
+}
+
+// snapshotItemDetails are the fields of the balance item without the columns of their own, stored as JSON
+type snapshotItemDetails struct {
+	IncomeByCurrency map[TcfCurrency]*TcfIncome `json:"income_by_currency,omitempty"`
+	TargetPrice      decimal.Decimal            `json:"target_price"`
+	TargetDistance   float64                    `json:"target_distance"`
+	TargetReached    bool                       `json:"target_reached"`
+	Beta             float64                    `json:"beta"`
+	Correlation      float64                    `json:"correlation"`
+}
+
+// sqlColumn is a column added to the table after it was released, the databases created before get it on open
+type sqlColumn struct {
+	table      string
+	name       string
+	definition string
+}
+
+func newSQLStore(ctx context.Context, db *sql.DB, dialect sqlDialect, schema []string, columns []sqlColumn) (sqlStore, error) {
+
+	for _, statement := range schema {
+		if _, err := db.ExecContext(ctx, statement); err != nil {
+			return sqlStore{}, err
+		}
+	}
+
+	for _, column := range columns {
+
+		// both SQLite and PostgreSQL fail to select an unknown column
+		rows, err := db.QueryContext(ctx, fmt.Sprintf(`SELECT %s FROM %s LIMIT 0`, column.name, column.table))
+		if err == nil {
+			rows.Close()
+			continue
+		}
+
+		if _, err := db.ExecContext(ctx, fmt.Sprintf(`ALTER TABLE %s ADD COLUMN %s %s`, column.table, column.name, column.definition)); err != nil {
+			return sqlStore{}, err
+		}
+	}
+
+	return sqlStore{DB: db, dialect: dialect}, nil
+}
+
+// rebind replaces the ? placeholders of the query with the dialect's ones
+func (s *sqlStore) rebind(query string) string {
+
+	if !s.dialect.numbered {
+		return query
+	}
+
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+
+	return b.String()
+}
+
+// SaveSnapshot stores the items and the totals of the balance calculated at the time
+func (s *sqlStore) SaveSnapshot(ctx context.Context, balance *TcfPortfolioBalance, at time.Time) (int64, error) {
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	details, err := json.Marshal(snapshotDetails{Warnings: balance.Warnings, Discrepancies: balance.Discrepancies})
+	if err != nil {
+		return 0, err
+	}
+
+	var id int64
+	if s.dialect.returning {
+		err = tx.QueryRowContext(ctx, s.rebind(`INSERT INTO balance_snapshots (taken_at, details) VALUES (?, ?) RETURNING id`),
+			at.UnixMilli(), string(details)).Scan(&id)
+	} else {
+		var result sql.Result
+		result, err = tx.ExecContext(ctx, s.rebind(`INSERT INTO balance_snapshots (taken_at, details) VALUES (?, ?)`), at.UnixMilli(), string(details))
+		if err == nil {
+			id, err = result.LastInsertId()
+		}
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	for position, item := range balance.Items {
+
+		details, err := json.Marshal(snapshotItemDetails{
+			IncomeByCurrency: item.IncomeByCurrency,
+			TargetPrice:      item.TargetPrice,
+			TargetDistance:   item.TargetDistance,
+			TargetReached:    item.TargetReached,
+			Beta:             item.Beta,
+			Correlation:      item.Correlation,
+		})
+		if err != nil {
+			return 0, err
+		}
+
+		_, err = tx.ExecContext(ctx, s.rebind(`INSERT INTO balance_snapshot_items (snapshot_id, position, figi, ticker, name, currency,
+			operation_amount, broker_commission_amount, current_price, portfolio_amount, portfolio_quantity,
+			dividend_amount, dividend_tax_amount, service_commission_amount, balance_amount, margin_fee_amount,
+			realized_pnl, unrealized_pnl, xirr, coupon_amount, coupon_tax_amount,
+			repayment_amount, accrued_interest, accrued_interest_paid, ytm, modified_duration, details)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`),
+			id, position, item.FIGI, item.Ticker, item.Name, string(item.Currency),
+			item.OperationAmount.String(), item.BrokerCommissionAmount.String(), item.CurrentPrice.String(),
+			item.PortfolioAmount.String(), item.PortfolioQuantity,
+			item.DividendAmount.String(), item.DividendTaxAmount.String(), item.ServiceCommissionAmount.String(),
+			item.BalanceAmount.String(), item.MarginFeeAmount.String(),
+			item.RealizedPnL.String(), item.UnrealizedPnL.String(), item.XIRR,
+			item.CouponAmount.String(), item.CouponTaxAmount.String(),
+			item.RepaymentAmount.String(), item.AccruedInterest.String(), item.AccruedInterestPaid.String(),
+			item.YTM, item.ModifiedDuration, string(details))
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	for currency, total := range balance.Total.Currencies {
+		_, err := tx.ExecContext(ctx, s.rebind(`INSERT INTO balance_snapshot_totals (snapshot_id, currency, balance_amount,
+			service_commission_amount, tax_back, portfolio_amount, xirr) VALUES (?, ?, ?, ?, ?, ?, ?)`),
+			id, string(currency), total.BalanceAmount.String(), total.ServiceCommissionAmount.String(),
+			total.TaxBack.String(), total.PortfolioAmount.String(), total.XIRR)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return id, tx.Commit()
+}
+
+// LoadRange returns the snapshots taken in the period ordered by time
+func (s *sqlStore) LoadRange(ctx context.Context, from, to time.Time) ([]*TcfSnapshot, error) {
+
+	rows, err := s.DB.QueryContext(ctx, s.rebind(`SELECT id, taken_at, details FROM balance_snapshots
+		WHERE taken_at >= ? AND taken_at <= ? ORDER BY taken_at, id`), from.UnixMilli(), to.UnixMilli())
+	if err != nil {
+		return nil, err
+	}
+
+	res := []*TcfSnapshot{}
+	byID := make(map[int64]*TcfSnapshot)
+
+	for rows.Next() {
+		var takenAt int64
+		var data string
+		snapshot := &TcfSnapshot{Balance: createEmptyBalance()}
+		if err := rows.Scan(&snapshot.ID, &takenAt, &data); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		snapshot.Time = time.UnixMilli(takenAt)
+
+		var details snapshotDetails
+		if err := json.Unmarshal([]byte(data), &details); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		snapshot.Balance.Warnings = append(snapshot.Balance.Warnings, details.Warnings...)
+		snapshot.Balance.Discrepancies = details.Discrepancies
+		res = append(res, snapshot)
+		byID[snapshot.ID] = snapshot
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(res) == 0 {
+		return res, nil
+	}
+
+	if err := s.loadItems(ctx, byID, from, to); err != nil {
+		return nil, err
+	}
+
+	if err := s.loadTotals(ctx, byID, from, to); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// LatestSnapshot returns the last stored snapshot, nil if there are none
+func (s *sqlStore) LatestSnapshot(ctx context.Context) (*TcfSnapshot, error) {
+
+	var takenAt int64
+	err := s.DB.QueryRowContext(ctx, s.rebind(`SELECT taken_at FROM balance_snapshots ORDER BY taken_at DESC, id DESC LIMIT 1`)).Scan(&takenAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	snapshots, err := s.LoadRange(ctx, time.UnixMilli(takenAt), time.UnixMilli(takenAt))
+	if err != nil {
+		return nil, err
+	}
+
+	return snapshots[len(snapshots)-1], nil
+}
+
+func (s *sqlStore) loadItems(ctx context.Context, byID map[int64]*TcfSnapshot, from, to time.Time) error {
+
+	rows, err := s.DB.QueryContext(ctx, s.rebind(`SELECT i.snapshot_id, i.figi, i.ticker, i.name, i.currency,
+		i.operation_amount, i.broker_commission_amount, i.current_price, i.portfolio_amount, i.portfolio_quantity,
+		i.dividend_amount, i.dividend_tax_amount, i.service_commission_amount, i.balance_amount, i.margin_fee_amount,
+		i.realized_pnl, i.unrealized_pnl, i.xirr, i.coupon_amount, i.coupon_tax_amount,
+		i.repayment_amount, i.accrued_interest, i.accrued_interest_paid, i.ytm, i.modified_duration, i.details
+		FROM balance_snapshot_items i JOIN balance_snapshots s ON s.id = i.snapshot_id
+		WHERE s.taken_at >= ? AND s.taken_at <= ? ORDER BY i.snapshot_id, i.position`), from.UnixMilli(), to.UnixMilli())
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+
+		var id int64
+		var currency, data string
+		item := &TcfBalanceItem{}
+		amounts := make([]string, 16)
+
+		err := rows.Scan(&id, &item.FIGI, &item.Ticker, &item.Name, &currency,
+			&amounts[0], &amounts[1], &amounts[2], &amounts[3], &item.PortfolioQuantity,
+			&amounts[4], &amounts[5], &amounts[6], &amounts[7], &amounts[8],
+			&amounts[9], &amounts[10], &item.XIRR, &amounts[11], &amounts[12],
+			&amounts[13], &amounts[14], &amounts[15], &item.YTM, &item.ModifiedDuration, &data)
+		if err != nil {
+			return err
+		}
+
+		item.Currency = TcfCurrency(currency)
+		err = parseDecimals(amounts, &item.OperationAmount, &item.BrokerCommissionAmount, &item.CurrentPrice,
+			&item.PortfolioAmount, &item.DividendAmount, &item.DividendTaxAmount, &item.ServiceCommissionAmount,
+			&item.BalanceAmount, &item.MarginFeeAmount, &item.RealizedPnL, &item.UnrealizedPnL,
+			&item.CouponAmount, &item.CouponTaxAmount,
+			&item.RepaymentAmount, &item.AccruedInterest, &item.AccruedInterestPaid)
+		if err != nil {
+			return err
+		}
+
+		var details snapshotItemDetails
+		if err := json.Unmarshal([]byte(data), &details); err != nil {
+			return err
+		}
+		item.IncomeByCurrency = details.IncomeByCurrency
+		item.TargetPrice, item.TargetDistance, item.TargetReached = details.TargetPrice, details.TargetDistance, details.TargetReached
+		item.Beta, item.Correlation = details.Beta, details.Correlation
+
+		if snapshot, ok := byID[id]; ok {
+			snapshot.Balance.Items = append(snapshot.Balance.Items, item)
+		}
+	}
+
+	return rows.Err()
+}
+
+func (s *sqlStore) loadTotals(ctx context.Context, byID map[int64]*TcfSnapshot, from, to time.Time) error {
+
+	rows, err := s.DB.QueryContext(ctx, s.rebind(`SELECT t.snapshot_id, t.currency, t.balance_amount, t.service_commission_amount,
+		t.tax_back, t.portfolio_amount, t.xirr
+		FROM balance_snapshot_totals t JOIN balance_snapshots s ON s.id = t.snapshot_id
+		WHERE s.taken_at >= ? AND s.taken_at <= ?`), from.UnixMilli(), to.UnixMilli())
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+
+		var id int64
+		var currency string
+		amounts := make([]string, 4)
+		total := &TcfTotal{}
+
+		if err := rows.Scan(&id, &currency, &amounts[0], &amounts[1], &amounts[2], &amounts[3], &total.XIRR); err != nil {
+			return err
+		}
+
+		if err := parseDecimals(amounts, &total.BalanceAmount, &total.ServiceCommissionAmount, &total.TaxBack, &total.PortfolioAmount); err != nil {
+			return err
+		}
+
+		if snapshot, ok := byID[id]; ok {
+			snapshot.Balance.Total.Currencies[TcfCurrency(currency)] = total
+		}
+	}
+
+	return rows.Err()
+}
+
+// SaveOperations stores the operations of the account, the operations stored before are updated
+func (s *sqlStore) SaveOperations(ctx context.Context, accountID string, operations []sdk.Operation) error {
+
+	tx, err := s.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, oper := range operations {
+
+		data, err := json.Marshal(oper)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx, s.rebind(`INSERT INTO operations (account_id, id, date_time, figi, operation_type, data)
+			VALUES (?, ?, ?, ?, ?, ?) ON CONFLICT (account_id, id) DO UPDATE SET date_time = excluded.date_time,
+			figi = excluded.figi, operation_type = excluded.operation_type, data = excluded.data`),
+			accountID, oper.ID, oper.DateTime.UnixMilli(), oper.FIGI, string(oper.OperationType), string(data))
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// LoadOperations returns the stored operations of the account in the period ordered by time
+func (s *sqlStore) LoadOperations(ctx context.Context, accountID string, from, to time.Time) ([]sdk.Operation, error) {
+
+	rows, err := s.DB.QueryContext(ctx, s.rebind(`SELECT data FROM operations
+		WHERE account_id = ? AND date_time >= ? AND date_time <= ? ORDER BY date_time, id`), accountID, from.UnixMilli(), to.UnixMilli())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := []sdk.Operation{}
+	for rows.Next() {
+
+		var data string
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+
+		var oper sdk.Operation
+		if err := json.Unmarshal([]byte(data), &oper); err != nil {
+			return nil, err
+		}
+		res = append(res, oper)
+	}
+
+	return res, rows.Err()
+}
+
+func parseDecimals(values []string, targets ...*decimal.Decimal) error {
+
+	for i, value := range values {
+		d, err := decimal.NewFromString(value)
+		if err != nil {
+			return err
+		}
+		*targets[i] = d
+	}
+
+	return nil
+}
+
+// SyncedAt returns the time the operations of the account were synced last, zero if they never were
+func (s *sqlStore) SyncedAt(ctx context.Context, accountID string) (time.Time, error) {
+
+	var syncedAt int64
+	err := s.DB.QueryRowContext(ctx, s.rebind(`SELECT synced_at FROM operations_sync WHERE account_id = ?`), accountID).Scan(&syncedAt)
+	if err == sql.ErrNoRows {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return time.UnixMilli(syncedAt), nil
+}
+
+// SetSyncedAt remembers the time the operations of the account were synced
+func (s *sqlStore) SetSyncedAt(ctx context.Context, accountID string, at time.Time) error {
+
+	_, err := s.DB.ExecContext(ctx, s.rebind(`INSERT INTO operations_sync (account_id, synced_at) VALUES (?, ?)
+		ON CONFLICT (account_id) DO UPDATE SET synced_at = excluded.synced_at`), accountID, at.UnixMilli())
+
+	return err
+}
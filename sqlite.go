@@ -0,0 +1,90 @@
+package tinkoff
+
+import (
+	"context"
+	"database/sql"
+)
+
+// TcfSQLiteStore keeps the balance snapshots and the operations in SQLite. The database is opened by the caller
+// with the driver of choice (e.g. github.com/mattn/go-sqlite3 or modernc.org/sqlite), SQLite 3.24 or newer is required
+type TcfSQLiteStore struct {
+	sqlStore
+}
+
+var sqliteSchema = []string{
+	`CREATE TABLE IF NOT EXISTS balance_snapshots (
+		id       INTEGER PRIMARY KEY AUTOINCREMENT,
+		taken_at INTEGER NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS balance_snapshots_taken_at ON balance_snapshots (taken_at)`,
+	`CREATE TABLE IF NOT EXISTS balance_snapshot_items (
+		snapshot_id               INTEGER NOT NULL REFERENCES balance_snapshots (id) ON DELETE CASCADE,
+		position                  INTEGER NOT NULL,
+		figi                      TEXT NOT NULL,
+		ticker                    TEXT NOT NULL,
+		name                      TEXT NOT NULL,
+		currency                  TEXT NOT NULL,
+		operation_amount          TEXT NOT NULL,
+		broker_commission_amount  TEXT NOT NULL,
+		current_price             TEXT NOT NULL,
+		portfolio_amount          TEXT NOT NULL,
+		portfolio_quantity        INTEGER NOT NULL,
+		dividend_amount           TEXT NOT NULL,
+		dividend_tax_amount       TEXT NOT NULL,
+		service_commission_amount TEXT NOT NULL,
+		balance_amount            TEXT NOT NULL,
+		margin_fee_amount         TEXT NOT NULL,
+		realized_pnl              TEXT NOT NULL,
+		unrealized_pnl            TEXT NOT NULL,
+		xirr                      REAL NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS balance_snapshot_items_snapshot_id ON balance_snapshot_items (snapshot_id)`,
+	`CREATE TABLE IF NOT EXISTS balance_snapshot_totals (
+		snapshot_id               INTEGER NOT NULL REFERENCES balance_snapshots (id) ON DELETE CASCADE,
+		currency                  TEXT NOT NULL,
+		balance_amount            TEXT NOT NULL,
+		service_commission_amount TEXT NOT NULL,
+		tax_back                  TEXT NOT NULL,
+		portfolio_amount          TEXT NOT NULL,
+		xirr                      REAL NOT NULL
+	)`,
+	`CREATE INDEX IF NOT EXISTS balance_snapshot_totals_snapshot_id ON balance_snapshot_totals (snapshot_id)`,
+	`CREATE TABLE IF NOT EXISTS operations (
+		account_id     TEXT NOT NULL,
+		id             TEXT NOT NULL,
+		date_time      INTEGER NOT NULL,
+		figi           TEXT NOT NULL,
+		operation_type TEXT NOT NULL,
+		data           TEXT NOT NULL,
+		PRIMARY KEY (account_id, id)
+	)`,
+	`CREATE INDEX IF NOT EXISTS operations_date_time ON operations (account_id, date_time)`,
+	`CREATE TABLE IF NOT EXISTS operations_sync (
+		account_id TEXT PRIMARY KEY,
+		synced_at  INTEGER NOT NULL
+	)`,
+}
+
+// sqliteColumns are added to the tables created by the earlier versions
+var sqliteColumns = []sqlColumn{
+	{table: "balance_snapshot_items", name: "coupon_amount", definition: "TEXT NOT NULL DEFAULT '0'"},
+	{table: "balance_snapshot_items", name: "coupon_tax_amount", definition: "TEXT NOT NULL DEFAULT '0'"},
+	{table: "balance_snapshot_items", name: "repayment_amount", definition: "TEXT NOT NULL DEFAULT '0'"},
+	{table: "balance_snapshot_items", name: "accrued_interest", definition: "TEXT NOT NULL DEFAULT '0'"},
+	{table: "balance_snapshot_items", name: "accrued_interest_paid", definition: "TEXT NOT NULL DEFAULT '0'"},
+	{table: "balance_snapshot_items", name: "ytm", definition: "REAL NOT NULL DEFAULT 0"},
+	{table: "balance_snapshot_items", name: "modified_duration", definition: "REAL NOT NULL DEFAULT 0"},
+	{table: "balance_snapshot_items", name: "details", definition: "TEXT NOT NULL DEFAULT '{}'"},
+	{table: "balance_snapshots", name: "details", definition: "TEXT NOT NULL DEFAULT '{}'"},
+}
+
+// NewSQLiteStore creates the tables if they don't exist
+func NewSQLiteStore(ctx context.Context, db *sql.DB) (*TcfSQLiteStore, error) {
+
+	store, err := newSQLStore(ctx, db, sqlDialect{}, sqliteSchema, sqliteColumns)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TcfSQLiteStore{sqlStore: store}, nil
+}
@@ -0,0 +1,102 @@
+package tinkoff
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	sdk "github.com/TinkoffCreditSystems/invest-openapi-go-sdk"
+	"github.com/mikhailbolshakov/tinkoff/utils"
+)
+
+// syncOverlap is how far back from the last sync the operations are fetched again,
+// the operations in progress at the time of the sync are completed later
+const syncOverlap = 7 * 24 * time.Hour
+
+// TcfOperationsStore keeps the operations of the accounts and the time they were synced last.
+// TcfSQLiteStore and TcfPostgresStore implement it
+type TcfOperationsStore interface {
+	SaveOperations(ctx context.Context, accountID string, operations []sdk.Operation) error
+	// LoadOperations returns the stored operations of the account in the period ordered by time
+	LoadOperations(ctx context.Context, accountID string, from, to time.Time) ([]sdk.Operation, error)
+	// SyncedAt returns zero time if the account was never synced
+	SyncedAt(ctx context.Context, accountID string) (time.Time, error)
+	SetSyncedAt(ctx context.Context, accountID string, at time.Time) error
+}
+
+type operationsSync struct {
+	store TcfOperationsStore
+	// the syncs of the account are serialized, so the concurrent requests don't fetch the same delta
+	mu sync.Mutex
+}
+
+// WithOperationsStore makes GetOperations (and so every report) sync the operations into the store
+// and read them from there, only the operations since the last sync are requested from the API
+func WithOperationsStore(store TcfOperationsStore) TcfOption {
+	return func(acc *TcfAccount) {
+		acc.operations = &operationsSync{store: store}
+	}
+}
+
+// SyncOperations fetches the operations of the account made since the last sync (all of them on the first run)
+// into the store and returns the number of the operations fetched
+func (acc *TcfAccount) SyncOperations(ctx context.Context, store TcfOperationsStore, accountID string) (int, error) {
+
+	accountID = acc.accountID(accountID)
+
+	syncedAt, err := store.SyncedAt(ctx, accountID)
+	if err != nil {
+		return 0, err
+	}
+
+	from := time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+	if !syncedAt.IsZero() {
+		from = syncedAt.Add(-syncOverlap)
+	}
+	now := time.Now()
+
+	var operations []sdk.Operation
+	err = acc.call(ctx, 20*time.Second, func(ctx context.Context) (err error) {
+		operations, err = acc.Client.Operations(ctx, accountID, from, now, "")
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if err := store.SaveOperations(ctx, accountID, operations); err != nil {
+		return 0, err
+	}
+
+	if err := store.SetSyncedAt(ctx, accountID, now); err != nil {
+		return 0, err
+	}
+
+	return len(operations), nil
+}
+
+// storedOperations syncs the account and loads the requested operations of the FIGIs from the store
+func (acc *TcfAccount) storedOperations(ctx context.Context, request *TcfGetOperationsRequest, figis []string) ([]sdk.Operation, error) {
+
+	acc.operations.mu.Lock()
+	_, err := acc.SyncOperations(ctx, acc.operations.store, request.AccountID)
+	acc.operations.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	operations, err := acc.operations.store.LoadOperations(ctx, acc.accountID(request.AccountID), request.PeriodFrom, request.PeriodTo)
+	if err != nil {
+		return nil, err
+	}
+
+	if request.Figi != "" {
+		wanted := make(map[string]bool)
+		for _, figi := range figis {
+			wanted[figi] = true
+		}
+		operations = utils.Filter(operations, func(oper sdk.Operation) bool { return wanted[oper.FIGI] })
+	}
+
+	return operations, nil
+}
@@ -0,0 +1,294 @@
+package tinkoff
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	sdk "github.com/TinkoffCreditSystems/invest-openapi-go-sdk"
+	"github.com/mikhailbolshakov/tinkoff/utils"
+	"github.com/shopspring/decimal"
+)
+
+// TcfTaxEstimate is the estimated tax on the gains realized in one currency during the year.
+// The broker converts the gains to roubles at the CBR rate on the settlement dates, without the FX provider
+// (see WithFXProvider) the estimate is kept in the trade currency and is approximate for the foreign currencies
+type TcfTaxEstimate struct {
+	Year     int
+	Currency TcfCurrency
+	// RealizedGain is the net taxable gain to date, the lots held longer than 3 years are excluded
+	RealizedGain decimal.Decimal
+	TaxAmount    decimal.Decimal
+	// WithheldAmount is the tax already withheld by the broker during the year (on withdrawals)
+	WithheldAmount decimal.Decimal
+	DueAmount      decimal.Decimal
+	// WithholdingDate is the date the broker withholds the rest of the tax, if the cash is not enough
+	// the broker withholds it from the next incoming payments in January
+	WithholdingDate time.Time
+	CashAmount      decimal.Decimal
+	// CarryForwardAmount is the loss of the prior years available to offset the gain when declared,
+	// the broker does not apply it and withholds the full tax
+	CarryForwardAmount decimal.Decimal
+	// DeclaredTaxAmount is the tax after the carry-forward, the difference is returned after the declaration
+	DeclaredTaxAmount decimal.Decimal
+	// CashRequired is the cash to add to the account before the withholding date
+	CashRequired decimal.Decimal
+	Warnings     []TcfWarning
+}
+
+// EstimateYearEndTax estimates the tax withheld by the broker at the end of the current year
+func (acc *TcfAccount) EstimateYearEndTax(ctx context.Context, accountID string) ([]*TcfTaxEstimate, error) {
+
+	now := time.Now()
+
+	operations, err := acc.GetOperations(ctx, &TcfGetOperationsRequest{
+		AccountID:  accountID,
+		PeriodFrom: time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC),
+		PeriodTo:   now,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var portfolio sdk.Portfolio
+	err = acc.call(ctx, 20*time.Second, func(ctx context.Context) (err error) {
+		portfolio, err = acc.Client.Portfolio(ctx, acc.accountID(accountID))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	gains, warnings, err := acc.taxableGains(ctx, operations)
+	if err != nil {
+		return nil, err
+	}
+
+	estimates := estimateYearEndTax(gains, operations, portfolio.Currencies, now)
+
+	// the warnings are attached to the estimate of the currency the gains of the instrument are counted in
+	currencyByFigi := make(map[string]TcfCurrency)
+	for _, oper := range operations {
+		currencyByFigi[oper.FIGI] = TcfCurrency(oper.Currency)
+		if acc.fx != nil {
+			currencyByFigi[oper.FIGI] = CurrencyRUB
+		}
+	}
+	for _, estimate := range estimates {
+		estimate.Warnings = []TcfWarning{}
+		for _, warning := range warnings {
+			if currencyByFigi[warning.FIGI] == estimate.Currency {
+				estimate.Warnings = append(estimate.Warnings, warning)
+			}
+		}
+	}
+
+	return estimates, nil
+}
+
+func estimateYearEndTax(gains []*TcfRealizedGain, operations []sdk.Operation, cash []sdk.CurrencyBalance, now time.Time) []*TcfTaxEstimate {
+
+	year := now.Year()
+	estimates := make(map[TcfCurrency]*TcfTaxEstimate)
+
+	estimate := func(currency TcfCurrency) *TcfTaxEstimate {
+		e, ok := estimates[currency]
+		if !ok {
+			e = &TcfTaxEstimate{
+				Year:            year,
+				Currency:        currency,
+				WithholdingDate: time.Date(year, time.December, 31, 0, 0, 0, 0, now.Location()),
+			}
+			estimates[currency] = e
+		}
+		return e
+	}
+
+	byYear := realizedByYear(gains)
+	for currency, years := range byYear {
+		if gain, ok := years[year]; ok {
+			estimate(currency).RealizedGain = gain
+		}
+	}
+
+	for _, oper := range operations {
+		if oper.DateTime.Year() != year {
+			continue
+		}
+		switch oper.OperationType {
+		case sdk.OperationTypeTax, sdk.OperationTypeTaxLucre:
+			e := estimate(TcfCurrency(oper.Currency))
+			e.WithheldAmount = e.WithheldAmount.Add(moneyAbs(oper.Payment))
+		case sdk.OperationTypeTaxBack:
+			e := estimate(TcfCurrency(oper.Currency))
+			e.WithheldAmount = e.WithheldAmount.Sub(moneyAbs(oper.Payment))
+		}
+	}
+
+	for _, c := range cash {
+		if e, ok := estimates[TcfCurrency(c.Currency)]; ok {
+			e.CashAmount = e.CashAmount.Add(money(c.Balance - c.Blocked))
+		}
+	}
+
+	res := []*TcfTaxEstimate{}
+	for _, currency := range currencies {
+
+		e, ok := estimates[currency]
+		if !ok {
+			continue
+		}
+
+		if e.RealizedGain.IsPositive() {
+			e.TaxAmount = e.RealizedGain.Mul(decimal.NewFromFloat(ruTaxRate)).Round(2)
+		}
+
+		for _, loss := range lossCarryForward(currency, byYear[currency], year) {
+			e.CarryForwardAmount = e.CarryForwardAmount.Add(loss.RemainingAmount)
+		}
+
+		declared := e.RealizedGain.Sub(e.CarryForwardAmount)
+		if declared.IsPositive() {
+			e.DeclaredTaxAmount = declared.Mul(decimal.NewFromFloat(ruTaxRate)).Round(2)
+		}
+
+		e.DueAmount = decimal.Max(e.TaxAmount.Sub(e.WithheldAmount), decimal.Zero)
+		e.CashRequired = decimal.Max(e.DueAmount.Sub(e.CashAmount), decimal.Zero)
+
+		res = append(res, e)
+	}
+
+	return res
+}
+
+// TcfLossCarryForward is the net loss of a year not yet offset by the gains of the following years
+type TcfLossCarryForward struct {
+	Year            int
+	Currency        TcfCurrency
+	LossAmount      decimal.Decimal
+	RemainingAmount decimal.Decimal
+}
+
+// carryForwardYears is the number of years a loss can be carried forward
+const carryForwardYears = 10
+
+// GetLossCarryForward returns the realized losses of the years before the given one that are still available to offset the gains
+func (acc *TcfAccount) GetLossCarryForward(ctx context.Context, accountID string, year int) ([]*TcfLossCarryForward, error) {
+
+	operations, err := acc.GetOperations(ctx, &TcfGetOperationsRequest{
+		AccountID:  accountID,
+		PeriodFrom: time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC),
+		PeriodTo:   time.Date(year, time.January, 1, 0, 0, 0, 0, time.Local),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	gains, _, err := acc.taxableGains(ctx, operations)
+	if err != nil {
+		return nil, err
+	}
+
+	res := []*TcfLossCarryForward{}
+	byYear := realizedByYear(gains)
+	for _, currency := range currencies {
+		if years, ok := byYear[currency]; ok {
+			res = append(res, lossCarryForward(currency, years, year)...)
+		}
+	}
+
+	return res, nil
+}
+
+// taxableGains replays the lots of all the instruments and returns the gains not exempt from the tax,
+// the gains are converted to roubles when the account has the FX provider
+func (acc *TcfAccount) taxableGains(ctx context.Context, operations []sdk.Operation) ([]*TcfRealizedGain, []TcfWarning, error) {
+
+	gains := []*TcfRealizedGain{}
+	warnings := []TcfWarning{}
+
+	for figi, figiOperations := range utils.ByFigi(operations) {
+
+		if quantity := unmatchedQuantity(figiOperations); quantity > 0 {
+			warnings = append(warnings, TcfWarning{
+				Code:    WarningIncompleteHistory,
+				FIGI:    figi,
+				Message: fmt.Sprintf("%d sold without the purchases in the history, the gain is not counted", quantity),
+			})
+		}
+
+		_, realized := replayLots(figiOperations)
+		for _, gain := range realized {
+			if !gain.Exempt {
+				gains = append(gains, gain)
+			}
+		}
+	}
+
+	if acc.fx == nil {
+		return gains, warnings, nil
+	}
+
+	gains, err := toRoubles(ctx, acc.fx, gains)
+	return gains, warnings, err
+}
+
+// realizedByYear returns the net gain by currency and year, the losses are negative
+func realizedByYear(gains []*TcfRealizedGain) map[TcfCurrency]map[int]decimal.Decimal {
+
+	res := make(map[TcfCurrency]map[int]decimal.Decimal)
+
+	for _, gain := range gains {
+		if res[gain.Currency] == nil {
+			res[gain.Currency] = make(map[int]decimal.Decimal)
+		}
+		res[gain.Currency][gain.ClosedAt.Year()] = res[gain.Currency][gain.ClosedAt.Year()].Add(gain.GainAmount)
+	}
+
+	return res
+}
+
+// lossCarryForward offsets the losses of the years before the given one by the gains of the following years, the oldest losses first
+func lossCarryForward(currency TcfCurrency, netByYear map[int]decimal.Decimal, year int) []*TcfLossCarryForward {
+
+	years := []int{}
+	for y := range netByYear {
+		if y < year {
+			years = append(years, y)
+		}
+	}
+	sort.Ints(years)
+
+	losses := []*TcfLossCarryForward{}
+
+	for _, y := range years {
+
+		net := netByYear[y]
+		if net.IsNegative() {
+			losses = append(losses, &TcfLossCarryForward{Year: y, Currency: currency, LossAmount: net.Neg(), RemainingAmount: net.Neg()})
+			continue
+		}
+
+		for _, loss := range losses {
+			if !net.IsPositive() {
+				break
+			}
+			if y-loss.Year > carryForwardYears {
+				continue
+			}
+			offset := decimal.Min(net, loss.RemainingAmount)
+			loss.RemainingAmount = loss.RemainingAmount.Sub(offset)
+			net = net.Sub(offset)
+		}
+	}
+
+	res := []*TcfLossCarryForward{}
+	for _, loss := range losses {
+		if loss.RemainingAmount.IsPositive() && year-loss.Year <= carryForwardYears {
+			res = append(res, loss)
+		}
+	}
+
+	return res
+}
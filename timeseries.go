@@ -0,0 +1,285 @@
+package tinkoff
+
+import (
+	"context"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	sdk "github.com/TinkoffCreditSystems/invest-openapi-go-sdk"
+	"github.com/mikhailbolshakov/tinkoff/utils"
+)
+
+type TcfTimeBucket string
+
+const (
+	BucketDay   TcfTimeBucket = "day"
+	BucketWeek  TcfTimeBucket = "week"
+	BucketMonth TcfTimeBucket = "month"
+)
+
+// next returns the start of the bucket following the one containing the time
+func (b TcfTimeBucket) next(t time.Time) time.Time {
+
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+
+	switch b {
+	case BucketWeek:
+		// the weeks start on Monday
+		return day.AddDate(0, 0, 7-(int(day.Weekday())+6)%7)
+	case BucketMonth:
+		return time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+	default:
+		return day.AddDate(0, 0, 1)
+	}
+}
+
+type TcfBalanceTimeSeriesRequest struct {
+	AccountID  string
+	PeriodFrom time.Time
+	PeriodTo   time.Time
+	// Bucket is the step of the series, a day if not set
+	Bucket TcfTimeBucket
+}
+
+// TcfBalancePoint is the state of the positions of a currency at the end of a bucket
+type TcfBalancePoint struct {
+	Time time.Time
+	// Value is the market value of the positions at the close price, the free cash is not included
+	Value float64
+	// PnL is the gain since the period start: the change of the value plus the cash received from the sells
+	// and the income minus the cash invested, net of the commissions and the taxes
+	PnL float64
+}
+
+type TcfBalanceSeries struct {
+	Currency TcfCurrency
+	Points   []*TcfBalancePoint
+}
+
+// Values returns the value series for RollingReturns and DailyPnLHeatmap
+func (s *TcfBalanceSeries) Values() []TcfValuePoint {
+
+	res := []TcfValuePoint{}
+	for _, point := range s.Points {
+		res = append(res, TcfValuePoint{Time: point.Time, Value: point.Value})
+	}
+
+	return res
+}
+
+// Returns returns the daily time-weighted returns between the consecutive points and the times they end at,
+// the change of the P&L is the gain of the period net of the deposits and the withdrawals
+func (s *TcfBalanceSeries) Returns() ([]float64, []time.Time) {
+
+	returns, times := []float64{}, []time.Time{}
+	for i := 1; i < len(s.Points); i++ {
+
+		r := 0.0
+		if s.Points[i-1].Value > 0 {
+			r = (s.Points[i].PnL - s.Points[i-1].PnL) / s.Points[i-1].Value
+		}
+
+		returns = append(returns, r)
+		times = append(times, s.Points[i].Time)
+	}
+
+	return returns, times
+}
+
+// Index returns the value series rebuilt from the returns, so the buys and the sells don't move it.
+// It is scaled to end at the latest value if any positions are held, the losses estimated from it are of them
+func (s *TcfBalanceSeries) Index() []TcfValuePoint {
+
+	if len(s.Points) == 0 {
+		return []TcfValuePoint{}
+	}
+
+	returns, times := s.Returns()
+
+	res := []TcfValuePoint{{Time: s.Points[0].Time, Value: 1.0}}
+	for i, r := range returns {
+		res = append(res, TcfValuePoint{Time: times[i], Value: res[i].Value * (1 + r)})
+	}
+
+	if last, value := res[len(res)-1].Value, s.Points[len(s.Points)-1].Value; last > 0 && value > 0 {
+		scale := value / last
+		for i := range res {
+			res[i].Value *= scale
+		}
+	}
+
+	return res
+}
+
+// GetBalanceTimeSeries reconstructs the value and the cumulative P&L of the positions by currency
+// at the end of every bucket of the period from the operations and the daily candles
+func (acc *TcfAccount) GetBalanceTimeSeries(ctx context.Context, request *TcfBalanceTimeSeriesRequest) ([]*TcfBalanceSeries, error) {
+
+	operations, err := acc.GetOperations(ctx, &TcfGetOperationsRequest{
+		AccountID:  request.AccountID,
+		PeriodFrom: time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC),
+		PeriodTo:   request.PeriodTo,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// the first point is the baseline of the P&L
+	times := []time.Time{request.PeriodFrom}
+	for t := request.Bucket.next(request.PeriodFrom); t.Before(request.PeriodTo); t = request.Bucket.next(t) {
+		times = append(times, t)
+	}
+	times = append(times, request.PeriodTo)
+
+	type position struct {
+		currency   TcfCurrency
+		quantities []int
+		flows      []TcfCashFlow
+		prices     []float64
+	}
+
+	positions := make(map[string]*position)
+	for figi, figiOperations := range utils.ByFigi(operations) {
+
+		trades := utils.Filter(figiOperations, func(oper sdk.Operation) bool { return utils.Category(oper.OperationType) == utils.CategoryTrade })
+		if len(trades) == 0 {
+			continue
+		}
+
+		p := &position{currency: TcfCurrency(trades[0].Currency), quantities: make([]int, len(times)), prices: make([]float64, len(times))}
+		p.flows = positionCashFlows(figiOperations, p.currency, 0, request.PeriodTo)
+
+		for i, t := range times {
+			p.quantities[i] = lotsQuantity(openLots(utils.Filter(figiOperations, func(oper sdk.Operation) bool { return oper.DateTime.Before(t) })))
+		}
+
+		positions[figi] = p
+	}
+
+	// the candles are requested only for the instruments held during the period
+	group, groupCtx := acc.newGroup(ctx)
+	var mu sync.Mutex
+
+	for figi, p := range positions {
+
+		held := false
+		for _, quantity := range p.quantities {
+			held = held || quantity > 0
+		}
+		if !held {
+			continue
+		}
+
+		figi, p := figi, p
+		group.Go(func() error {
+
+			candles, err := acc.dailyCandles(groupCtx, figi, request.PeriodFrom.AddDate(0, 0, -7), request.PeriodTo)
+			if err != nil {
+				return err
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			for i, t := range times {
+				if p.quantities[i] > 0 {
+					p.prices[i] = closeBefore(candles, t)
+				}
+			}
+			return nil
+		})
+	}
+
+	if err := group.Wait(); err != nil {
+		return nil, err
+	}
+
+	series := make(map[TcfCurrency]*TcfBalanceSeries)
+	for _, p := range positions {
+
+		s, ok := series[p.currency]
+		if !ok {
+			s = &TcfBalanceSeries{Currency: p.currency, Points: []*TcfBalancePoint{}}
+			for _, t := range times {
+				s.Points = append(s.Points, &TcfBalancePoint{Time: t})
+			}
+			series[p.currency] = s
+		}
+
+		for i, t := range times {
+			cash := 0.0
+			for _, flow := range p.flows {
+				if flow.Time.Before(t) {
+					cash += flow.Amount
+				}
+			}
+			value := float64(p.quantities[i]) * p.prices[i]
+			s.Points[i].Value += value
+			// the cumulative gain since the start of the history, rebased to the period start below
+			s.Points[i].PnL += cash + value
+		}
+	}
+
+	res := []*TcfBalanceSeries{}
+	for _, s := range series {
+		base := s.Points[0].PnL
+		for _, point := range s.Points {
+			point.Value = math.Round(100*point.Value) / 100
+			point.PnL = math.Round(100*(point.PnL-base)) / 100
+		}
+		res = append(res, s)
+	}
+
+	sort.SliceStable(res, func(i, j int) bool {
+		return res[i].Currency < res[j].Currency
+	})
+
+	return res, nil
+}
+
+// dailyCandles requests the daily candles of the period, the API returns a year of daily candles at most
+func (acc *TcfAccount) dailyCandles(ctx context.Context, figi string, from, to time.Time) ([]sdk.Candle, error) {
+
+	res := []sdk.Candle{}
+
+	for from.Before(to) {
+
+		end := from.AddDate(1, 0, 0)
+		if end.After(to) {
+			end = to
+		}
+
+		var candles []sdk.Candle
+		err := acc.call(ctx, 10*time.Second, func(ctx context.Context) (err error) {
+			candles, err = acc.Client.Candles(ctx, from, end, sdk.CandleInterval1Day, figi)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		res = append(res, candles...)
+		from = end
+	}
+
+	sort.SliceStable(res, func(i, j int) bool {
+		return res[i].TS.Before(res[j].TS)
+	})
+
+	return res, nil
+}
+
+// closeBefore returns the close price of the last candle started before the time, the candles are sorted by time
+func closeBefore(candles []sdk.Candle, t time.Time) float64 {
+
+	i := sort.Search(len(candles), func(i int) bool {
+		return !candles[i].TS.Before(t)
+	})
+	if i == 0 {
+		return 0.0
+	}
+
+	return candles[i-1].ClosePrice
+}
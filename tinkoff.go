@@ -4,27 +4,80 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"math"
+	"os"
 	"sort"
+	"sync"
 	"time"
 
 	sdk "github.com/TinkoffCreditSystems/invest-openapi-go-sdk"
+	"github.com/mikhailbolshakov/tinkoff/utils"
+	"github.com/shopspring/decimal"
+	"golang.org/x/time/rate"
 )
 
 type TcfAccount struct {
 	Client *sdk.RestClient
 	Token  string
+	// AccountID is the broker account used when a request doesn't specify one, empty means the default account
+	AccountID string
+
+	timeout            time.Duration
+	calculationTimeout time.Duration
+	retryAttempts      int
+	retryBackoff       time.Duration
+	instruments        instrumentCache
+	limiter            *rate.Limiter
+	chaos              *TcfChaos
+	prices             priceCache
+	concurrency        int
+	fx                 TcfFXProvider
+	operations         *operationsSync
+	// corporateActions are added to the built-in ones
+	corporateActions []TcfCorporateAction
+	bondTerms        TcfBondTermsProvider
 }
 
 type TcfPortfolioBalanceRequest struct {
+	AccountID    string
 	PeriodFrom   time.Time
 	PeriodTo     time.Time
 	Figi         string
 	ForPortfolio bool
 	ExcludeFIGIs []string
+	// TargetPrices maps FIGI to the target (fair value) price of the instrument, of one bond for the bonds
+	TargetPrices map[string]float64
+	// MarginDailyRate is the tariff's daily rate for borrowed securities (e.g. 0.00062 for 0.062% a day),
+	// the fee is accrued for the short positions only, the interest on the borrowed cash is not estimated
+	MarginDailyRate float64
+	// IncludeOperations adds the filtered operations and their per-FIGI groups to the response
+	IncludeOperations bool
+	// SortBy orders the balance items, by ticker if not set
+	SortBy TcfSortOrder
+	// Renderer renders the balance to Output (os.Stdout by default) when set, the balance is not printed otherwise
+	Renderer TcfRenderer
+	Output   io.Writer
+	// ReconcilePositions compares the computed quantities with the current portfolio, the period should end now
+	ReconcilePositions bool
+	// ValueAtPeriodEnd values the positions at the close prices of PeriodTo if it's in the past,
+	// at the current prices otherwise
+	ValueAtPeriodEnd bool
+}
+
+// valuedAt returns the time the positions are valued at
+func (r *TcfPortfolioBalanceRequest) valuedAt() time.Time {
+
+	now := time.Now()
+	if r.ValueAtPeriodEnd && !r.PeriodTo.IsZero() && r.PeriodTo.Before(now) {
+		return r.PeriodTo
+	}
+
+	return now
 }
 
 type TcfGetOperationsRequest struct {
+	AccountID    string
 	PeriodFrom   time.Time
 	PeriodTo     time.Time
 	Figi         string
@@ -32,14 +85,41 @@ type TcfGetOperationsRequest struct {
 	ExcludeFIGIs []string
 }
 
-func InitAccount(token string) *TcfAccount {
+func InitAccount(token string, opts ...TcfOption) *TcfAccount {
 	a := &TcfAccount{
-		Token:  token,
-		Client: sdk.NewRestClient(token),
+		Token:         token,
+		Client:        sdk.NewRestClient(token),
+		limiter:       defaultLimiter(),
+		retryAttempts: defaultRetryAttempts,
+		retryBackoff:  defaultRetryBackoff,
+		concurrency:   defaultConcurrency,
+	}
+	for _, opt := range opts {
+		opt(a)
 	}
 	return a
 }
 
+// accountID returns the requested broker account or the account's default one
+func (acc *TcfAccount) accountID(requested string) string {
+	if requested != "" {
+		return requested
+	}
+	return acc.AccountID
+}
+
+// ListAccounts returns the broker accounts (e.g. the regular brokerage account and ИИС)
+func (acc *TcfAccount) ListAccounts(ctx context.Context) ([]sdk.Account, error) {
+
+	var accounts []sdk.Account
+	err := acc.call(ctx, 5*time.Second, func(ctx context.Context) (err error) {
+		accounts, err = acc.Client.Accounts(ctx)
+		return err
+	})
+
+	return accounts, err
+}
+
 func contains(slice []string, item string) bool {
 	for _, elem := range slice {
 		if elem == item {
@@ -79,19 +159,6 @@ func filterOperations(operations []sdk.Operation, criteria *filterOperationsCrit
 
 }
 
-func aggOperationsByFigi(operations []sdk.Operation) map[string][]sdk.Operation {
-
-	agg := make(map[string][]sdk.Operation)
-
-	for _, oper := range operations {
-		if oper.FIGI != "" {
-			agg[oper.FIGI] = append(agg[oper.FIGI], oper)
-		}
-	}
-
-	return agg
-}
-
 func candleLatest(candles []sdk.Candle) *sdk.Candle {
 
 	sort.SliceStable(candles, func(i, j int) bool {
@@ -106,7 +173,50 @@ func candleLatest(candles []sdk.Candle) *sdk.Candle {
 
 }
 
-func (acc *TcfAccount) GetCurrentPrice(figi string) (float64, error) {
+// shortPosition replays trades and returns the borrowed quantity and the time the short position was opened
+func shortPosition(operations []sdk.Operation) (int, time.Time) {
+
+	trades := filterOperations(operations, &filterOperationsCriteria{OperationTypes: []string{"Buy", "BuyCard", "Sell"}})
+
+	sort.SliceStable(trades, func(i, j int) bool {
+		return trades[i].DateTime.Before(trades[j].DateTime)
+	})
+
+	quantity := 0
+	var openedAt time.Time
+
+	for _, trade := range trades {
+
+		prev := quantity
+		if trade.OperationType == "Sell" {
+			quantity -= trade.Quantity
+		} else {
+			quantity += trade.Quantity
+		}
+
+		if prev >= 0 && quantity < 0 {
+			openedAt = trade.DateTime
+		}
+	}
+
+	if quantity >= 0 {
+		return 0, time.Time{}
+	}
+
+	return -quantity, openedAt
+}
+
+func (acc *TcfAccount) GetCurrentPrice(ctx context.Context, figi string) (float64, error) {
+	price, _, err := acc.currentPrice(ctx, figi)
+	return price, err
+}
+
+// currentPrice returns the close price of the latest candle and the time of the candle
+func (acc *TcfAccount) currentPrice(ctx context.Context, figi string) (float64, time.Time, error) {
+
+	if price, at, ok := acc.prices.get(figi); ok {
+		return price, at, nil
+	}
 
 	type candleRq struct {
 		Interval   sdk.CandleInterval
@@ -125,9 +235,6 @@ func (acc *TcfAccount) GetCurrentPrice(figi string) (float64, error) {
 	var now time.Time
 	var interval sdk.CandleInterval
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
-
 	for _, rq := range requests {
 
 		now = time.Now().Truncate(rq.TruncateFn())
@@ -135,29 +242,35 @@ func (acc *TcfAccount) GetCurrentPrice(figi string) (float64, error) {
 		to = now
 		interval = rq.Interval
 
-		candles, err := acc.Client.Candles(ctx, from, to, interval, figi)
+		var candles []sdk.Candle
+		err := acc.call(ctx, 10*time.Second, func(ctx context.Context) (err error) {
+			candles, err = acc.Client.Candles(ctx, from, to, interval, figi)
+			return err
+		})
 		if err != nil {
-			return 0.0, err
+			return 0.0, time.Time{}, err
 		}
 
 		candle := candleLatest(candles)
 
 		if candle != nil && candle.ClosePrice != 0.0 {
-			return candle.ClosePrice, nil
+			acc.prices.put(figi, candle.ClosePrice, candle.TS)
+			return candle.ClosePrice, candle.TS, nil
 		}
 
 	}
 
-	return 0.0, errors.New(fmt.Sprintf("Current price cannot be determined for FIGI %s and period (%v %v %v). Candles aren't available", figi, from, to, interval))
+	return 0.0, time.Time{}, errors.New(fmt.Sprintf("Current price cannot be determined for FIGI %s and period (%v %v %v). Candles aren't available", figi, from, to, interval))
 
 }
 
-func (acc *TcfAccount) GetByFigi(figi string) (*sdk.SearchInstrument, error) {
+func (acc *TcfAccount) GetByFigi(ctx context.Context, figi string) (*sdk.SearchInstrument, error) {
 
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-
-	instrument, err := acc.Client.SearchInstrumentByFIGI(ctx, figi)
+	var instrument sdk.SearchInstrument
+	err := acc.call(ctx, 5*time.Second, func(ctx context.Context) (err error) {
+		instrument, err = acc.Client.SearchInstrumentByFIGI(ctx, figi)
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -166,92 +279,291 @@ func (acc *TcfAccount) GetByFigi(figi string) (*sdk.SearchInstrument, error) {
 
 }
 
-func (acc *TcfAccount) balanceItemToCh(
+// GetByTicker returns the instrument by the ticker, the first one if the ticker is traded on several exchanges
+func (acc *TcfAccount) GetByTicker(ctx context.Context, ticker string) (*sdk.Instrument, error) {
+
+	var instruments []sdk.Instrument
+	err := acc.call(ctx, 5*time.Second, func(ctx context.Context) (err error) {
+		instruments, err = acc.Client.SearchInstrumentByTicker(ctx, ticker)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(instruments) == 0 {
+		return nil, errors.New(fmt.Sprintf("Instrument not found by ticker %s", ticker))
+	}
+
+	return &instruments[0], nil
+
+}
+
+func (acc *TcfAccount) balanceItem(
+	ctx context.Context,
 	figi string,
-	operations []sdk.Operation,
-	balanceItemCh chan<- *TcfBalanceItem,
-	errorCh chan<- error) {
+	request *TcfPortfolioBalanceRequest,
+	operations []sdk.Operation) (*TcfBalanceItem, []TcfWarning, error) {
 
-	go func() {
+	figiOperations := filterOperations(operations, &filterOperationsCriteria{FIGIs: []string{figi}})
+	warnings := []TcfWarning{}
 
-		figiOperations := filterOperations(operations, &filterOperationsCriteria{FIGIs: []string{figi}})
+	// the instrument not found (e.g. delisted) is skipped, any other failure (auth, decoding) is still an error
+	instrument, err := acc.GetByFigi(ctx, figi)
+	if isNotFound(err) {
+		return nil, append(warnings, TcfWarning{Code: WarningMissingInstrument, FIGI: figi, Message: err.Error()}), nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if instrument.FIGI == "" {
+		return nil, append(warnings, TcfWarning{Code: WarningMissingInstrument, FIGI: figi, Message: "Instrument not found"}), nil
+	}
 
-		currentPrice, err := acc.GetCurrentPrice(figi)
-		if err != nil {
-			errorCh <- err
-			return
+	valuedAt := request.valuedAt()
+
+	var currentPrice float64
+	var priceAt time.Time
+	if request.ValueAtPeriodEnd && valuedAt.Equal(request.PeriodTo) {
+		currentPrice, err = acc.priceAt(ctx, figi, valuedAt)
+	} else {
+		currentPrice, priceAt, err = acc.currentPrice(ctx, figi)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if !priceAt.IsZero() && time.Since(priceAt) > stalePriceAge {
+		warnings = append(warnings, TcfWarning{
+			Code:    WarningStalePrice,
+			FIGI:    figi,
+			Message: fmt.Sprintf("The last price is of %s", priceAt.Format("2006-01-02 15:04")),
+		})
+	}
+
+	for _, operation := range figiOperations {
+		if utils.Category(operation.OperationType) == utils.CategoryOther {
+			warnings = append(warnings, TcfWarning{
+				Code:    WarningUnknownOperationType,
+				FIGI:    figi,
+				Message: fmt.Sprintf("Operation %s of type %q is not included", operation.ID, operation.OperationType),
+			})
+		}
+	}
+
+	balanceItem := createBalanceItem(instrument)
+	if err := balanceItem.Currency.Validate(); err != nil {
+		return nil, nil, err
+	}
+	balanceItem.CurrentPrice = money(currentPrice)
+
+	for _, operation := range filterOperations(figiOperations, &filterOperationsCriteria{OperationTypes: []string{"Buy", "BuyCard", "Sell"}}) {
+
+		sign := decimal.NewFromInt(1)
+		if operation.OperationType == "Sell" {
+			sign = decimal.NewFromInt(-1)
+		}
+
+		balanceItem.BrokerCommissionAmount = balanceItem.BrokerCommissionAmount.Add(moneyAbs(operation.Commission.Value))
+		balanceItem.OperationAmount = balanceItem.OperationAmount.Add(sign.Mul(moneyAbs(operation.Payment)))
+		balanceItem.PortfolioQuantity += int(sign.IntPart()) * operation.Quantity
+
+		if instrument.Type == sdk.InstrumentTypeBond {
+			balanceItem.AccruedInterestPaid = balanceItem.AccruedInterestPaid.Add(sign.Mul(tradeAccruedInterest(operation)))
 		}
+	}
+
+	// bonds are quoted in percents of the face value, the quote is converted to the price of one bond once
+	// the terms are known, the amounts, the P&L and the yields are all of the price of one bond
+	var terms *TcfBondTerms
+	if instrument.Type == sdk.InstrumentTypeBond && acc.bondTerms != nil {
 
-		instrument, err := acc.GetByFigi(figi)
+		terms, err = acc.bondTerms.BondTerms(ctx, figi)
 		if err != nil {
-			errorCh <- err
-			return
+			return nil, nil, err
 		}
 
-		balanceItem := createBalanceItem(instrument)
-		balanceItem.CurrentPrice = currentPrice
+		currentPrice = bondPrice(currentPrice, terms)
+		balanceItem.CurrentPrice = money(currentPrice)
+	}
 
-		for _, operation := range filterOperations(figiOperations, &filterOperationsCriteria{OperationTypes: []string{"Buy", "BuyCard", "Sell"}}) {
+	// more sold than bought is the short position (see shortPosition), it is valued as a liability.
+	// The sells of the securities bought before the period look the same, ReconcilePositions finds them
+	balanceItem.PortfolioAmount = decimal.NewFromInt(int64(balanceItem.PortfolioQuantity)).Mul(balanceItem.CurrentPrice)
 
-			sign := 1.0
-			if operation.OperationType == "Sell" {
-				sign = -1.0
-			}
+	// the held bonds are valued with the accrued interest, as it was paid in the cost of the lots
+	accruedInterest := decimal.Zero
+	if terms != nil && balanceItem.PortfolioQuantity > 0 {
+
+		accruedInterest = money(bondAccruedInterest(terms, valuedAt)).Round(2)
+		balanceItem.AccruedInterest = accruedInterest.Mul(decimal.NewFromInt(int64(balanceItem.PortfolioQuantity)))
+		balanceItem.PortfolioAmount = balanceItem.PortfolioAmount.Add(balanceItem.AccruedInterest)
+
+		// the yield and the duration of the full price, the next coupon is paid in full to the holder
+		price := currentPrice + accruedInterest.InexactFloat64()
+		if ytm, ok := bondYTM(price, terms, valuedAt); ok {
+			balanceItem.YTM = math.Round(10000*ytm) / 100
+		}
+		if duration, ok := bondModifiedDuration(price, terms, valuedAt); ok {
+			balanceItem.ModifiedDuration = math.Round(100*duration) / 100
+		}
+	}
+
+	// dividend, attributed to the currency it's paid in
+	for _, operation := range filterOperations(figiOperations, &filterOperationsCriteria{OperationTypes: []string{"Dividend"}}) {
+
+		currency := TcfCurrency(operation.Currency)
+		if err := currency.Validate(); err != nil {
+			return nil, nil, err
+		}
+
+		income := balanceItem.income(currency)
+		income.DividendAmount = income.DividendAmount.Add(moneyAbs(operation.Payment))
+		if currency == balanceItem.Currency {
+			balanceItem.DividendAmount = balanceItem.DividendAmount.Add(moneyAbs(operation.Payment))
+		}
+	}
+
+	// dividend tax
+	for _, operation := range filterOperations(figiOperations, &filterOperationsCriteria{OperationTypes: []string{"TaxDividend"}}) {
+
+		currency := TcfCurrency(operation.Currency)
+		if err := currency.Validate(); err != nil {
+			return nil, nil, err
+		}
 
-			balanceItem.BrokerCommissionAmount += math.Abs(operation.Commission.Value)
-			balanceItem.OperationAmount += sign * math.Abs(operation.Payment)
-			balanceItem.PortfolioQuantity += int(sign) * operation.Quantity
+		income := balanceItem.income(currency)
+		income.DividendTaxAmount = income.DividendTaxAmount.Add(moneyAbs(operation.Payment))
+		if currency == balanceItem.Currency {
+			balanceItem.DividendTaxAmount = balanceItem.DividendTaxAmount.Add(moneyAbs(operation.Payment))
 		}
+	}
+
+	// coupon and coupon tax, attributed to the currency they're paid in
+	for _, operation := range filterOperations(figiOperations, &filterOperationsCriteria{OperationTypes: []string{"Coupon", "TaxCoupon"}}) {
 
-		if balanceItem.PortfolioQuantity < 0 {
-			balanceItem.PortfolioQuantity = 0
+		currency := TcfCurrency(operation.Currency)
+		if err := currency.Validate(); err != nil {
+			return nil, nil, err
 		}
 
-		balanceItem.PortfolioAmount = float64(balanceItem.PortfolioQuantity) * balanceItem.CurrentPrice
+		income := balanceItem.income(currency)
+		amount := moneyAbs(operation.Payment)
 
-		// dividend
-		for _, operation := range filterOperations(figiOperations, &filterOperationsCriteria{OperationTypes: []string{"Dividend"}}) {
+		if operation.OperationType == "Coupon" {
+			income.CouponAmount = income.CouponAmount.Add(amount)
+			if currency == balanceItem.Currency {
+				balanceItem.CouponAmount = balanceItem.CouponAmount.Add(amount)
+			}
+			continue
+		}
 
-			balanceItem.DividendAmount += math.Abs(operation.Payment)
+		income.CouponTaxAmount = income.CouponTaxAmount.Add(amount)
+		if currency == balanceItem.Currency {
+			balanceItem.CouponTaxAmount = balanceItem.CouponTaxAmount.Add(amount)
 		}
+	}
 
-		// dividend tax
-		for _, operation := range filterOperations(figiOperations, &filterOperationsCriteria{OperationTypes: []string{"TaxDividend"}}) {
+	// the principal returned by the amortization, attributed to the currency it's paid in.
+	// The cost basis of the lots is reduced on replay
+	for _, operation := range filterOperations(figiOperations, &filterOperationsCriteria{OperationTypes: []string{"PartRepayment"}}) {
 
-			balanceItem.DividendTaxAmount += math.Abs(operation.Payment)
+		currency := TcfCurrency(operation.Currency)
+		if err := currency.Validate(); err != nil {
+			return nil, nil, err
 		}
 
-		balanceItem.BrokerCommissionAmount = math.Round(100*balanceItem.BrokerCommissionAmount) / 100
-		balanceItem.OperationAmount = math.Round(100*balanceItem.OperationAmount) / 100
-		balanceItem.PortfolioAmount = math.Round(100*balanceItem.PortfolioAmount) / 100
-		balanceItem.DividendAmount = math.Round(100*balanceItem.DividendAmount) / 100
-		balanceItem.DividendTaxAmount = math.Round(100*balanceItem.DividendTaxAmount) / 100
+		income := balanceItem.income(currency)
+		income.RepaymentAmount = income.RepaymentAmount.Add(moneyAbs(operation.Payment))
+		if currency == balanceItem.Currency {
+			balanceItem.RepaymentAmount = balanceItem.RepaymentAmount.Add(moneyAbs(operation.Payment))
+		}
+	}
 
-		balanceItem.BalanceAmount = math.Round(100*(balanceItem.PortfolioAmount+balanceItem.DividendAmount-balanceItem.DividendTaxAmount-balanceItem.OperationAmount-balanceItem.BrokerCommissionAmount)) / 100
+	// accrued margin fee for the borrowed securities of the short position, it is charged from the balance
+	if request.MarginDailyRate > 0.0 {
+		if quantity, openedAt := shortPosition(figiOperations); quantity > 0 {
+			days := math.Ceil(valuedAt.Sub(openedAt).Hours() / 24)
+			balanceItem.MarginFeeAmount = decimal.NewFromFloat(request.MarginDailyRate * days).Mul(decimal.NewFromInt(int64(quantity))).Mul(balanceItem.CurrentPrice)
+		}
+	}
 
-		balanceItemCh <- balanceItem
+	balanceItem.BalanceAmount = balanceItem.PortfolioAmount.
+		Add(balanceItem.DividendAmount).
+		Sub(balanceItem.DividendTaxAmount).
+		Add(balanceItem.CouponAmount).
+		Sub(balanceItem.CouponTaxAmount).
+		Add(balanceItem.RepaymentAmount).
+		Sub(balanceItem.OperationAmount).
+		Sub(balanceItem.BrokerCommissionAmount).
+		Sub(balanceItem.MarginFeeAmount)
+
+	// realized and unrealized P&L by the FIFO lots
+	lots, realized := replayLots(figiOperations)
+	for _, gain := range realized {
+		balanceItem.RealizedPnL = balanceItem.RealizedPnL.Add(gain.GainAmount)
+	}
+	balanceItem.RealizedPnL = balanceItem.RealizedPnL.Add(balanceItem.DividendAmount).Sub(balanceItem.DividendTaxAmount).
+		Add(balanceItem.CouponAmount).Sub(balanceItem.CouponTaxAmount)
+	for _, lot := range lots {
+		balanceItem.UnrealizedPnL = balanceItem.UnrealizedPnL.Add(balanceItem.CurrentPrice.Add(accruedInterest).Sub(lot.Price).Mul(decimal.NewFromInt(int64(lot.Quantity))))
+	}
+
+	// money-weighted return
+	if xirr, ok := XIRR(positionCashFlows(figiOperations, balanceItem.Currency, balanceItem.PortfolioAmount.InexactFloat64(), valuedAt)); ok {
+		balanceItem.XIRR = math.Round(10000*xirr) / 100
+	}
+
+	// target price
+	if targetPrice := request.TargetPrices[figi]; targetPrice > 0.0 {
+		balanceItem.TargetPrice = money(targetPrice)
+		balanceItem.TargetDistance = math.Round(10000*(targetPrice-currentPrice)/currentPrice) / 100
+		balanceItem.TargetReached = currentPrice >= targetPrice
+	}
 
-	}()
+	return balanceItem, warnings, nil
 
 }
 
-func (acc *TcfAccount) GetOperations(request *TcfGetOperationsRequest) ([]sdk.Operation, error) {
+func (acc *TcfAccount) GetOperations(ctx context.Context, request *TcfGetOperationsRequest) ([]sdk.Operation, error) {
+
+	// the operations of the instrument are requested by all its FIGIs before the FIGI changes
+	figis := []string{request.Figi}
+	if request.Figi != "" {
+		figis = acc.figiAliases(request.Figi)
+	}
 
 	// get operations for the given period
-	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
-	defer cancel()
-	operations, err := acc.Client.Operations(ctx, sdk.DefaultAccount, request.PeriodFrom, request.PeriodTo, request.Figi)
+	var operations []sdk.Operation
+	var err error
+	if acc.operations != nil {
+		operations, err = acc.storedOperations(ctx, request, figis)
+	} else {
+		for _, figi := range figis {
+			var figiOperations []sdk.Operation
+			err = acc.call(ctx, 20*time.Second, func(ctx context.Context) (err error) {
+				figiOperations, err = acc.Client.Operations(ctx, acc.accountID(request.AccountID), request.PeriodFrom, request.PeriodTo, figi)
+				return err
+			})
+			if err != nil {
+				break
+			}
+			operations = append(operations, figiOperations...)
+		}
+	}
 	if err != nil {
 		return nil, err
 	}
 
+	operations = acc.applyCorporateActions(operations)
+
 	criteria := &filterOperationsCriteria{ExcludeFIGIs: request.ExcludeFIGIs, Status: "Done"}
 
 	if request.ForPortfolio {
-		ctx, cancel = context.WithTimeout(context.Background(), 20*time.Second)
-		defer cancel()
-
-		portfolio, err := acc.Client.Portfolio(ctx, sdk.DefaultAccount)
+		var portfolio sdk.Portfolio
+		err := acc.call(ctx, 20*time.Second, func(ctx context.Context) (err error) {
+			portfolio, err = acc.Client.Portfolio(ctx, acc.accountID(request.AccountID))
+			return err
+		})
 		if err != nil {
 			return nil, err
 		}
@@ -269,9 +581,10 @@ func (acc *TcfAccount) GetOperations(request *TcfGetOperationsRequest) ([]sdk.Op
 
 }
 
-func (acc *TcfAccount) GetPortfolioBalance(request *TcfPortfolioBalanceRequest) (*TcfPortfolioBalance, error) {
+func (acc *TcfAccount) GetPortfolioBalance(ctx context.Context, request *TcfPortfolioBalanceRequest) (*TcfPortfolioBalance, error) {
 
-	operations, err := acc.GetOperations(&TcfGetOperationsRequest{
+	operations, err := acc.GetOperations(ctx, &TcfGetOperationsRequest{
+		AccountID:    request.AccountID,
 		PeriodFrom:   request.PeriodFrom,
 		PeriodTo:     request.PeriodTo,
 		Figi:         request.Figi,
@@ -283,57 +596,116 @@ func (acc *TcfAccount) GetPortfolioBalance(request *TcfPortfolioBalanceRequest)
 	}
 
 	// aggregate all operations by FIGI
-	aggOperations := aggOperationsByFigi(operations)
+	aggOperations := utils.ByFigi(operations)
 
 	// create balance object
 	balance := createEmptyBalance()
 
-	// create channels
-	balanceItemsCh := make(chan *TcfBalanceItem)
-	defer close(balanceItemsCh)
-	errorCh := make(chan error)
-	defer close(errorCh)
-
-	// populate balance items channel
-	for figi, operations := range aggOperations {
-		acc.balanceItemToCh(figi, operations, balanceItemsCh, errorCh)
-	}
-
-	// handle balance items
-	for i := 0; i < len(aggOperations); i++ {
-		select {
-		case balanceItem := <-balanceItemsCh:
-			balance.Items = append(balance.Items, balanceItem)
-			balance.Total.Currencies[balanceItem.Currency].BalanceAmount += balanceItem.BalanceAmount
-			balance.Total.Currencies[balanceItem.Currency].PortfolioAmount += balanceItem.PortfolioAmount
-		case err = <-errorCh:
-			return nil, err
-		case <-time.After(20 * time.Second):
-			return nil, fmt.Errorf("Timeout error")
+	if request.IncludeOperations {
+		balance.Operations = operations
+		balance.OperationsByFigi = aggOperations
+	}
+
+	// calculate balance items concurrently, the first failure cancels the group
+	ctx, cancel := context.WithTimeout(ctx, acc.calculationTimeoutOr(20*time.Second))
+	defer cancel()
+	group, groupCtx := acc.newGroup(ctx)
+
+	var mu sync.Mutex
+	errs := []error{}
+
+	for figi, figiOperations := range aggOperations {
+		figi, figiOperations := figi, figiOperations
+		group.Go(func() error {
+
+			if err := groupCtx.Err(); err != nil {
+				return err
+			}
+
+			balanceItem, warnings, err := acc.balanceItem(groupCtx, figi, request, figiOperations)
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			// workers aborted by the cancelled group aren't reported as separate failures
+			if err != nil && groupCtx.Err() != nil && errors.Is(err, groupCtx.Err()) {
+				return err
+			}
+
+			if err != nil {
+				errs = append(errs, fmt.Errorf("FIGI %s: %w", figi, err))
+				return err
+			}
+
+			balance.Warnings = append(balance.Warnings, warnings...)
+			if balanceItem != nil {
+				balance.Items = append(balance.Items, balanceItem)
+			}
+			return nil
+		})
+	}
+
+	if err := group.Wait(); err != nil {
+		if len(errs) == 0 {
+			errs = append(errs, err)
+		}
+		return nil, errors.Join(errs...)
+	}
+
+	balance.totalItems()
+
+	// money-weighted return of all the positions of a currency
+	now := request.valuedAt()
+	flows := make(map[TcfCurrency][]TcfCashFlow)
+	for _, balanceItem := range balance.Items {
+		flows[balanceItem.Currency] = append(flows[balanceItem.Currency],
+			positionCashFlows(aggOperations[balanceItem.FIGI], balanceItem.Currency, balanceItem.PortfolioAmount.InexactFloat64(), now)...)
+	}
+	for currency, currencyFlows := range flows {
+		if xirr, ok := XIRR(currencyFlows); ok {
+			balance.Total.Currency(currency).XIRR = math.Round(10000*xirr) / 100
 		}
 	}
 
 	// service commission
 	for _, operation := range filterOperations(operations, &filterOperationsCriteria{OperationTypes: []string{"ServiceCommission"}}) {
-		balance.Total.Currencies[string(operation.Currency)].ServiceCommissionAmount += math.Abs(operation.Payment)
-		balance.Total.Currencies[string(operation.Currency)].BalanceAmount -= math.Abs(operation.Payment)
+		currency := TcfCurrency(operation.Currency)
+		if err := currency.Validate(); err != nil {
+			return nil, err
+		}
+		total := balance.Total.Currency(currency)
+		total.ServiceCommissionAmount = total.ServiceCommissionAmount.Add(moneyAbs(operation.Payment))
+		total.BalanceAmount = total.BalanceAmount.Sub(moneyAbs(operation.Payment))
 	}
 
 	// tax back
 	for _, operation := range filterOperations(operations, &filterOperationsCriteria{OperationTypes: []string{"TaxBack"}}) {
-		balance.Total.Currencies[string(operation.Currency)].TaxBack += math.Abs(operation.Payment)
-		balance.Total.Currencies[string(operation.Currency)].BalanceAmount += math.Abs(operation.Payment)
+		currency := TcfCurrency(operation.Currency)
+		if err := currency.Validate(); err != nil {
+			return nil, err
+		}
+		total := balance.Total.Currency(currency)
+		total.TaxBack = total.TaxBack.Add(moneyAbs(operation.Payment))
+		total.BalanceAmount = total.BalanceAmount.Add(moneyAbs(operation.Payment))
 	}
 
-	// rounding
-	for _, total := range balance.Total.Currencies {
-		total.BalanceAmount = math.Round(100*total.BalanceAmount) / 100
-		total.ServiceCommissionAmount = math.Round(100*total.ServiceCommissionAmount) / 100
-		total.TaxBack = math.Round(100*total.TaxBack) / 100
-		total.PortfolioAmount = math.Round(100*total.PortfolioAmount) / 100
+	if request.ReconcilePositions {
+		if err := acc.reconcilePositions(ctx, request.AccountID, balance, operations); err != nil {
+			return nil, err
+		}
 	}
 
-	PrintBalanceReport(balance)
+	balance.Sort(request.SortBy)
+
+	if request.Renderer != nil {
+		w := request.Output
+		if w == nil {
+			w = os.Stdout
+		}
+		if err := request.Renderer.Render(balance, w); err != nil {
+			return nil, err
+		}
+	}
 
 	return balance, nil
 }
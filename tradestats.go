@@ -0,0 +1,158 @@
+package tinkoff
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"time"
+
+	"github.com/jedib0t/go-pretty/table"
+	"github.com/mikhailbolshakov/tinkoff/utils"
+	"github.com/shopspring/decimal"
+)
+
+// TcfTradeStats is the statistics of the trades closed in one currency, a trade is the part of a lot closed by a sell
+type TcfTradeStats struct {
+	Currency TcfCurrency
+	Trades   int
+	Wins     int
+	Losses   int
+	WinRate  float64 // percents
+	// AverageWin and AverageLoss are positive amounts
+	AverageWin  decimal.Decimal
+	AverageLoss decimal.Decimal
+	// Expectancy is the average P&L of a trade
+	Expectancy     decimal.Decimal
+	AverageHolding time.Duration
+	PnL            decimal.Decimal
+	// ByWeekday and ByHour are the P&L of the trades by the weekday and the hour they were closed at
+	ByWeekday map[time.Weekday]decimal.Decimal
+	ByHour    map[int]decimal.Decimal
+}
+
+// GetTradeStats returns the statistics of the trades closed in the period by currency
+func (acc *TcfAccount) GetTradeStats(ctx context.Context, request *TcfGetOperationsRequest) ([]*TcfTradeStats, error) {
+
+	// the lots closed in the period may be opened before it
+	operations, err := acc.GetOperations(ctx, &TcfGetOperationsRequest{
+		AccountID:    request.AccountID,
+		PeriodFrom:   time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC),
+		PeriodTo:     request.PeriodTo,
+		Figi:         request.Figi,
+		ForPortfolio: request.ForPortfolio,
+		ExcludeFIGIs: request.ExcludeFIGIs,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	trades := []*TcfRealizedGain{}
+	for _, figiOperations := range utils.ByFigi(operations) {
+		_, realized := replayLots(figiOperations)
+		for _, gain := range realized {
+			if !gain.ClosedAt.Before(request.PeriodFrom) {
+				trades = append(trades, gain)
+			}
+		}
+	}
+
+	return tradeStats(trades), nil
+}
+
+func tradeStats(trades []*TcfRealizedGain) []*TcfTradeStats {
+
+	byCurrency := utils.GroupBy(trades, func(trade *TcfRealizedGain) TcfCurrency { return trade.Currency })
+
+	res := []*TcfTradeStats{}
+
+	for _, currency := range currencies {
+
+		currencyTrades, ok := byCurrency[currency]
+		if !ok {
+			continue
+		}
+
+		stats := &TcfTradeStats{
+			Currency:  currency,
+			Trades:    len(currencyTrades),
+			ByWeekday: make(map[time.Weekday]decimal.Decimal),
+			ByHour:    make(map[int]decimal.Decimal),
+		}
+
+		wins, losses := decimal.Zero, decimal.Zero
+		var holding time.Duration
+
+		for _, trade := range currencyTrades {
+
+			pnl := trade.GainAmount
+
+			if pnl.IsPositive() {
+				stats.Wins++
+				wins = wins.Add(pnl)
+			} else if pnl.IsNegative() {
+				stats.Losses++
+				losses = losses.Sub(pnl)
+			}
+
+			stats.PnL = stats.PnL.Add(pnl)
+			stats.ByWeekday[trade.ClosedAt.Weekday()] = stats.ByWeekday[trade.ClosedAt.Weekday()].Add(pnl)
+			stats.ByHour[trade.ClosedAt.Hour()] = stats.ByHour[trade.ClosedAt.Hour()].Add(pnl)
+			holding += trade.ClosedAt.Sub(trade.OpenedAt)
+		}
+
+		stats.WinRate = math.Round(10000*float64(stats.Wins)/float64(stats.Trades)) / 100
+		if stats.Wins > 0 {
+			stats.AverageWin = wins.Div(decimal.NewFromInt(int64(stats.Wins)))
+		}
+		if stats.Losses > 0 {
+			stats.AverageLoss = losses.Div(decimal.NewFromInt(int64(stats.Losses)))
+		}
+		stats.Expectancy = stats.PnL.Div(decimal.NewFromInt(int64(stats.Trades)))
+		stats.AverageHolding = holding / time.Duration(stats.Trades)
+
+		res = append(res, stats)
+	}
+
+	return res
+}
+
+// PrintTradeStats renders the summary of the trade statistics and the P&L by weekday and hour
+func PrintTradeStats(w io.Writer, stats []*TcfTradeStats) {
+
+	for _, s := range stats {
+
+		summary := table.NewWriter()
+		summary.SetOutputMirror(w)
+		summary.SetTitle(fmt.Sprintf("Trades, %s", s.Currency))
+		summary.AppendRows([]table.Row{
+			{"Trades", s.Trades},
+			{"Win rate, %", s.WinRate},
+			{"Average win", presentMoney(s.AverageWin)},
+			{"Average loss", presentMoney(s.AverageLoss)},
+			{"Expectancy", presentMoney(s.Expectancy)},
+			{"Average holding", s.AverageHolding.Round(time.Hour)},
+			{"P&L", presentMoney(s.PnL)},
+		})
+		summary.Render()
+
+		weekdays := table.NewWriter()
+		weekdays.SetOutputMirror(w)
+		weekdays.AppendHeader(table.Row{"Weekday", "P&L"})
+		for day := time.Monday; day <= time.Saturday; day++ {
+			weekdays.AppendRow(table.Row{day, presentMoney(s.ByWeekday[day])})
+		}
+		weekdays.AppendRow(table.Row{time.Sunday, presentMoney(s.ByWeekday[time.Sunday])})
+		weekdays.Render()
+
+		hours := table.NewWriter()
+		hours.SetOutputMirror(w)
+		hours.AppendHeader(table.Row{"Hour", "P&L"})
+		for hour := 0; hour < 24; hour++ {
+			if pnl, ok := s.ByHour[hour]; ok {
+				hours.AppendRow(table.Row{hour, presentMoney(pnl)})
+			}
+		}
+		hours.Render()
+	}
+}
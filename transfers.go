@@ -0,0 +1,194 @@
+package tinkoff
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	sdk "github.com/TinkoffCreditSystems/invest-openapi-go-sdk"
+	"github.com/mikhailbolshakov/tinkoff/utils"
+)
+
+// transferMatchWindow is the max difference between the dates of the bank statement entry and the broker operation
+const transferMatchWindow = 3 * 24 * time.Hour
+
+// TcfStatementEntry is a transfer from the bank statement export
+type TcfStatementEntry struct {
+	Date     time.Time
+	Amount   float64 // absolute amount of the transfer
+	Currency TcfCurrency
+	// Description is the payment purpose or the counterparty, the rules are matched against it
+	Description string
+}
+
+// TcfTransferRule labels the transfers whose statement description contains the pattern (case-insensitive)
+type TcfTransferRule struct {
+	Pattern string
+	Label   string
+}
+
+// TcfLabeledTransfer is a PayIn or PayOut operation matched with the bank statement entry
+type TcfLabeledTransfer struct {
+	OperationID string
+	Time        time.Time
+	Currency    TcfCurrency
+	Amount      float64 // positive for PayIn and negative for PayOut
+	// Label is the label of the first matched rule, the statement description if no rule matches
+	// and empty if the transfer is not found in the statement
+	Label string
+	Entry *TcfStatementEntry
+}
+
+// TcfStatementColumns are the zero-based positions of the columns in the bank statement CSV
+type TcfStatementColumns struct {
+	Date        int
+	Amount      int
+	Currency    int
+	Description int
+	// SkipRows is the number of the header rows
+	SkipRows int
+}
+
+// ReadBankStatementCSV reads the entries of the bank statement exported as CSV in the dialect
+func ReadBankStatementCSV(r io.Reader, dialect *TcfCSVDialect, columns *TcfStatementColumns) ([]*TcfStatementEntry, error) {
+
+	if dialect == nil {
+		dialect = DefaultCSVDialect()
+	}
+
+	reader := csv.NewReader(r)
+	if dialect.Separator != 0 {
+		reader.Comma = dialect.Separator
+	}
+	reader.FieldsPerRecord = -1
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	layout := dialect.DateFormat
+	if layout == "" {
+		layout = "2006-01-02"
+	}
+
+	res := []*TcfStatementEntry{}
+	for i, record := range records {
+
+		if i < columns.SkipRows {
+			continue
+		}
+
+		field := func(col int) string {
+			if col < len(record) {
+				// the BOM is a part of the first field of the file
+				return strings.TrimSpace(strings.TrimPrefix(record[col], "\uFEFF"))
+			}
+			return ""
+		}
+
+		date, err := time.ParseInLocation(layout, field(columns.Date), time.Local)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("Row %d: invalid date %q", i+1, field(columns.Date)))
+		}
+
+		amount := strings.ReplaceAll(field(columns.Amount), " ", "")
+		if dialect.DecimalComma {
+			amount = strings.Replace(amount, ",", ".", 1)
+		}
+		value, err := strconv.ParseFloat(amount, 64)
+		if err != nil {
+			return nil, errors.New(fmt.Sprintf("Row %d: invalid amount %q", i+1, field(columns.Amount)))
+		}
+
+		// the banks still export the rouble under the old code
+		currency := TcfCurrency(strings.ToUpper(field(columns.Currency)))
+		if currency == "RUR" {
+			currency = CurrencyRUB
+		}
+
+		res = append(res, &TcfStatementEntry{
+			Date:        date,
+			Amount:      math.Abs(value),
+			Currency:    currency,
+			Description: field(columns.Description),
+		})
+	}
+
+	return res, nil
+}
+
+// MatchTransfers matches the PayIn and PayOut operations with the statement entries of the same currency and amount
+// within 3 days, the closest date first. Every entry is matched once
+func MatchTransfers(operations []sdk.Operation, entries []*TcfStatementEntry, rules []TcfTransferRule) []*TcfLabeledTransfer {
+
+	transfers := utils.Filter(operations, func(oper sdk.Operation) bool {
+		return utils.Category(oper.OperationType) == utils.CategoryCashFlow
+	})
+	sort.SliceStable(transfers, func(i, j int) bool {
+		return transfers[i].DateTime.Before(transfers[j].DateTime)
+	})
+
+	matched := make(map[*TcfStatementEntry]bool)
+	res := []*TcfLabeledTransfer{}
+
+	for _, oper := range transfers {
+
+		transfer := &TcfLabeledTransfer{
+			OperationID: oper.ID,
+			Time:        oper.DateTime,
+			Currency:    TcfCurrency(oper.Currency),
+			Amount:      oper.Payment,
+		}
+
+		var best *TcfStatementEntry
+		for _, entry := range entries {
+
+			if matched[entry] || entry.Currency != transfer.Currency || math.Round(100*entry.Amount) != math.Round(100*math.Abs(oper.Payment)) {
+				continue
+			}
+
+			distance := absDuration(entry.Date.Sub(oper.DateTime))
+			if distance > transferMatchWindow {
+				continue
+			}
+			if best == nil || distance < absDuration(best.Date.Sub(oper.DateTime)) {
+				best = entry
+			}
+		}
+
+		if best != nil {
+			matched[best] = true
+			transfer.Entry = best
+			transfer.Label = transferLabel(best.Description, rules)
+		}
+
+		res = append(res, transfer)
+	}
+
+	return res
+}
+
+func transferLabel(description string, rules []TcfTransferRule) string {
+
+	for _, rule := range rules {
+		if strings.Contains(strings.ToLower(description), strings.ToLower(rule.Pattern)) {
+			return rule.Label
+		}
+	}
+
+	return description
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
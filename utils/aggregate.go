@@ -0,0 +1,100 @@
+// Package utils contains helpers to aggregate the fetched operations,
+// so custom reports can be built on top of them
+package utils
+
+import (
+	"time"
+
+	sdk "github.com/TinkoffCreditSystems/invest-openapi-go-sdk"
+)
+
+type OperationCategory string
+
+const (
+	CategoryTrade      OperationCategory = "Trade"
+	CategoryIncome     OperationCategory = "Income"
+	CategoryTax        OperationCategory = "Tax"
+	CategoryCommission OperationCategory = "Commission"
+	CategoryCashFlow   OperationCategory = "CashFlow"
+	CategoryOther      OperationCategory = "Other"
+)
+
+var categories = map[sdk.OperationType]OperationCategory{
+	"Buy":                CategoryTrade,
+	"BuyCard":            CategoryTrade,
+	"Sell":               CategoryTrade,
+	"Dividend":           CategoryIncome,
+	"Coupon":             CategoryIncome,
+	"PartRepayment":      CategoryIncome,
+	"Repayment":          CategoryIncome,
+	"Tax":                CategoryTax,
+	"TaxLucre":           CategoryTax,
+	"TaxDividend":        CategoryTax,
+	"TaxCoupon":          CategoryTax,
+	"TaxBack":            CategoryTax,
+	"BrokerCommission":   CategoryCommission,
+	"ExchangeCommission": CategoryCommission,
+	"ServiceCommission":  CategoryCommission,
+	"MarginCommission":   CategoryCommission,
+	"OtherCommission":    CategoryCommission,
+	"PayIn":              CategoryCashFlow,
+	"PayOut":             CategoryCashFlow,
+}
+
+// Category returns the category of the operation type
+func Category(operationType sdk.OperationType) OperationCategory {
+	if category, ok := categories[operationType]; ok {
+		return category
+	}
+	return CategoryOther
+}
+
+// GroupBy groups the items by the key returned by the key function keeping the original order inside a group
+func GroupBy[K comparable, T any](items []T, key func(T) K) map[K][]T {
+
+	res := make(map[K][]T)
+
+	for _, item := range items {
+		k := key(item)
+		res[k] = append(res[k], item)
+	}
+
+	return res
+}
+
+// Filter returns the items the predicate is true for
+func Filter[T any](items []T, predicate func(T) bool) []T {
+
+	res := []T{}
+
+	for _, item := range items {
+		if predicate(item) {
+			res = append(res, item)
+		}
+	}
+
+	return res
+}
+
+// ByFigi groups the operations by FIGI, the operations without FIGI (e.g. PayIn, ServiceCommission) are skipped
+func ByFigi(operations []sdk.Operation) map[string][]sdk.Operation {
+	withFigi := Filter(operations, func(oper sdk.Operation) bool { return oper.FIGI != "" })
+	return GroupBy(withFigi, func(oper sdk.Operation) string { return oper.FIGI })
+}
+
+// ByCurrency groups the operations by the payment currency
+func ByCurrency(operations []sdk.Operation) map[sdk.Currency][]sdk.Operation {
+	return GroupBy(operations, func(oper sdk.Operation) sdk.Currency { return oper.Currency })
+}
+
+// ByMonth groups the operations by the first day of the month of the operation
+func ByMonth(operations []sdk.Operation) map[time.Time][]sdk.Operation {
+	return GroupBy(operations, func(oper sdk.Operation) time.Time {
+		return time.Date(oper.DateTime.Year(), oper.DateTime.Month(), 1, 0, 0, 0, 0, oper.DateTime.Location())
+	})
+}
+
+// ByCategory groups the operations by the operation category
+func ByCategory(operations []sdk.Operation) map[OperationCategory][]sdk.Operation {
+	return GroupBy(operations, func(oper sdk.Operation) OperationCategory { return Category(oper.OperationType) })
+}
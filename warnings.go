@@ -0,0 +1,46 @@
+package tinkoff
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+type TcfWarningCode string
+
+const (
+	WarningStalePrice           TcfWarningCode = "stale_price"
+	WarningUnknownOperationType TcfWarningCode = "unknown_operation_type"
+	WarningMissingInstrument    TcfWarningCode = "missing_instrument"
+	WarningIncompleteHistory    TcfWarningCode = "incomplete_history"
+	WarningQuantityMismatch     TcfWarningCode = "quantity_mismatch"
+)
+
+// stalePriceAge is the age of the last candle after which the price is reported as stale
+const stalePriceAge = 24 * time.Hour
+
+// TcfWarning is a non-fatal issue of a calculation, the result is still returned but may be inaccurate
+type TcfWarning struct {
+	Code    TcfWarningCode `json:"code"`
+	FIGI    string         `json:"figi,omitempty"`
+	Message string         `json:"message"`
+}
+
+func (w TcfWarning) String() string {
+	if w.FIGI == "" {
+		return fmt.Sprintf("%s: %s", w.Code, w.Message)
+	}
+	return fmt.Sprintf("%s (%s): %s", w.Code, w.FIGI, w.Message)
+}
+
+func printWarnings(w io.Writer, warnings []TcfWarning, f reportFormatter) {
+
+	if len(warnings) == 0 {
+		return
+	}
+
+	fmt.Fprintln(w, f.text("Warnings")+":")
+	for _, warning := range warnings {
+		fmt.Fprintf(w, "  %s\n", warning)
+	}
+}
@@ -0,0 +1,352 @@
+package tinkoff
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	sdk "github.com/TinkoffCreditSystems/invest-openapi-go-sdk"
+	"github.com/shopspring/decimal"
+)
+
+// TcfModelPortfolio is the target allocation by ticker, e.g. read from
+//
+//	{"name": "Permanent", "weights": {"FXRL": 25, "FXGD": 25, "FXRB": 25, "FXMM": 25}}
+type TcfModelPortfolio struct {
+	Name    string             `json:"name"`
+	Weights map[string]float64 `json:"weights"`
+}
+
+// ReadModelPortfolio reads the model portfolio from JSON, the weights are normalized to 100%
+func ReadModelPortfolio(r io.Reader) (*TcfModelPortfolio, error) {
+
+	model := &TcfModelPortfolio{}
+	if err := json.NewDecoder(r).Decode(model); err != nil {
+		return nil, err
+	}
+
+	total := 0.0
+	for ticker, weight := range model.Weights {
+		if weight < 0 {
+			return nil, errors.New(fmt.Sprintf("Negative weight of %s", ticker))
+		}
+		total += weight
+	}
+	if total == 0 {
+		return nil, errors.New("Model portfolio has no weights")
+	}
+
+	for ticker, weight := range model.Weights {
+		model.Weights[ticker] = 100 * weight / total
+	}
+
+	return model, nil
+}
+
+// TcfPositionWeight is the share of the position in the value of the account's positions (the cash excluded)
+type TcfPositionWeight struct {
+	FIGI   string
+	Ticker string
+	// Value is the market value in roubles
+	Value  decimal.Decimal
+	Weight float64 // percents
+}
+
+// GetWeights returns the weights of the positions by ticker. The positions in the foreign currencies are converted
+// to roubles by the FX provider (see WithFXProvider)
+func (acc *TcfAccount) GetWeights(ctx context.Context, accountID string) (map[string]*TcfPositionWeight, error) {
+
+	var portfolio sdk.Portfolio
+	err := acc.call(ctx, 20*time.Second, func(ctx context.Context) (err error) {
+		portfolio, err = acc.Client.Portfolio(ctx, acc.accountID(accountID))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	res := make(map[string]*TcfPositionWeight)
+	total := decimal.Zero
+	now := time.Now()
+
+	for _, p := range portfolio.Positions {
+
+		if p.InstrumentType == sdk.InstrumentTypeCurrency {
+			continue
+		}
+
+		// the market value is the book value plus the expected yield
+		value := money(p.Balance*p.AveragePositionPrice.Value + p.ExpectedYield.Value)
+
+		currency := TcfCurrency(p.AveragePositionPrice.Currency)
+		if currency != CurrencyRUB {
+			if acc.fx == nil {
+				return nil, errors.New(fmt.Sprintf("FX provider is required to weigh %s in %s", p.Ticker, currency))
+			}
+			value, err = Convert(ctx, acc.fx, value, currency, CurrencyRUB, now)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		res[p.Ticker] = &TcfPositionWeight{FIGI: p.FIGI, Ticker: p.Ticker, Value: value.Round(2)}
+		total = total.Add(value)
+	}
+
+	if total.IsPositive() {
+		for _, weight := range res {
+			weight.Weight = math.Round(10000*weight.Value.Div(total).InexactFloat64()) / 100
+		}
+	}
+
+	return res, nil
+}
+
+// TcfWeightDifference is the difference of the weights of a ticker in two portfolios, in percents
+type TcfWeightDifference struct {
+	Ticker      string  `report:"Ticker"`
+	LeftWeight  float64 `report:"Left, %"`
+	RightWeight float64 `report:"Right, %"`
+	// Difference is the left weight minus the right one
+	Difference float64 `report:"Difference, %"`
+}
+
+// TcfPortfolioComparison compares two portfolios position by position
+type TcfPortfolioComparison struct {
+	// Items are sorted by the absolute difference, the largest first
+	Items     []*TcfWeightDifference
+	Common    []string
+	OnlyLeft  []string
+	OnlyRight []string
+	// Overlap is the sum of the smaller weights of the common tickers, 100% for the same allocation
+	Overlap float64
+}
+
+// CompareAccounts compares the weights of the positions of two accounts, e.g. of the family members
+func CompareAccounts(ctx context.Context, left, right *TcfHouseholdMember) (*TcfPortfolioComparison, error) {
+
+	leftWeights, err := left.Account.GetWeights(ctx, left.AccountID)
+	if err != nil {
+		return nil, err
+	}
+
+	rightWeights, err := right.Account.GetWeights(ctx, right.AccountID)
+	if err != nil {
+		return nil, err
+	}
+
+	return ComparePortfolioWeights(weightsByTicker(leftWeights), weightsByTicker(rightWeights)), nil
+}
+
+// CompareToModel compares the weights of the account's positions (left) with the model portfolio (right)
+func (acc *TcfAccount) CompareToModel(ctx context.Context, accountID string, model *TcfModelPortfolio) (*TcfPortfolioComparison, error) {
+
+	weights, err := acc.GetWeights(ctx, accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	return ComparePortfolioWeights(weightsByTicker(weights), model.Weights), nil
+}
+
+// ComparePortfolioWeights compares the weights by ticker in percents
+func ComparePortfolioWeights(left, right map[string]float64) *TcfPortfolioComparison {
+
+	res := &TcfPortfolioComparison{Items: []*TcfWeightDifference{}, Common: []string{}, OnlyLeft: []string{}, OnlyRight: []string{}}
+
+	tickers := make(map[string]bool)
+	for ticker := range left {
+		tickers[ticker] = true
+	}
+	for ticker := range right {
+		tickers[ticker] = true
+	}
+
+	overlap := 0.0
+	for ticker := range tickers {
+
+		l, inLeft := left[ticker]
+		r, inRight := right[ticker]
+
+		switch {
+		case inLeft && inRight:
+			res.Common = append(res.Common, ticker)
+			overlap += math.Min(l, r)
+		case inLeft:
+			res.OnlyLeft = append(res.OnlyLeft, ticker)
+		default:
+			res.OnlyRight = append(res.OnlyRight, ticker)
+		}
+
+		res.Items = append(res.Items, &TcfWeightDifference{
+			Ticker:      ticker,
+			LeftWeight:  math.Round(100*l) / 100,
+			RightWeight: math.Round(100*r) / 100,
+			Difference:  math.Round(100*(l-r)) / 100,
+		})
+	}
+	res.Overlap = math.Round(100*overlap) / 100
+
+	sort.SliceStable(res.Items, func(i, j int) bool {
+		x, y := math.Abs(res.Items[i].Difference), math.Abs(res.Items[j].Difference)
+		if x != y {
+			return x > y
+		}
+		return res.Items[i].Ticker < res.Items[j].Ticker
+	})
+	sort.Strings(res.Common)
+	sort.Strings(res.OnlyLeft)
+	sort.Strings(res.OnlyRight)
+
+	return res
+}
+
+// PrintPortfolioComparison prints the weight differences
+func PrintPortfolioComparison(w io.Writer, comparison *TcfPortfolioComparison) {
+	RenderTable(w, comparison.Items)
+}
+
+func weightsByTicker(weights map[string]*TcfPositionWeight) map[string]float64 {
+
+	res := make(map[string]float64)
+	for ticker, weight := range weights {
+		res[ticker] = weight.Weight
+	}
+
+	return res
+}
+
+// Deviations returns the items the weights of which differ by the threshold (in percents) or more,
+// e.g. the positions to rebalance towards the model
+func (c *TcfPortfolioComparison) Deviations(threshold float64) []*TcfWeightDifference {
+
+	res := []*TcfWeightDifference{}
+	for _, item := range c.Items {
+		if math.Abs(item.Difference) >= threshold {
+			res = append(res, item)
+		}
+	}
+
+	return res
+}
+
+type TcfModelTrackingRequest struct {
+	AccountID  string
+	PeriodFrom time.Time
+	PeriodTo   time.Time
+	Model      *TcfModelPortfolio
+	// Currency selects the positions compared with the model, RUB by default
+	Currency TcfCurrency
+}
+
+// TcfModelTracking compares the account with the model portfolio
+type TcfModelTracking struct {
+	Model    string
+	Currency TcfCurrency
+	// ActiveWeights are the current weights of the account minus the weights of the model
+	ActiveWeights *TcfPortfolioComparison
+	// PortfolioReturn is the time-weighted return of the positions, ModelReturn is the return of the model rebalanced daily.
+	// The returns are in percents over the period
+	PortfolioReturn float64
+	ModelReturn     float64
+	// TrackingError is the annualized standard deviation of the daily return differences, in percents
+	TrackingError float64
+}
+
+// TrackModel calculates the active weights of the account and the tracking error versus the model portfolio.
+// The model returns are the price returns of the tickers in their own currencies
+func (acc *TcfAccount) TrackModel(ctx context.Context, request *TcfModelTrackingRequest) (*TcfModelTracking, error) {
+
+	currency := request.Currency
+	if currency == "" {
+		currency = CurrencyRUB
+	}
+
+	activeWeights, err := acc.CompareToModel(ctx, request.AccountID, request.Model)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &TcfModelTracking{Model: request.Model.Name, Currency: currency, ActiveWeights: activeWeights}
+
+	portfolio, times, err := acc.portfolioReturns(ctx, request.AccountID, request.PeriodFrom, request.PeriodTo, currency)
+	if err != nil {
+		return nil, err
+	}
+	if portfolio == nil {
+		return nil, errors.New(fmt.Sprintf("No positions in %s during the period", currency))
+	}
+
+	model, err := acc.modelReturns(ctx, request.Model, times)
+	if err != nil {
+		return nil, err
+	}
+
+	portfolioCumulative, modelCumulative := 1.0, 1.0
+	differences := make([]float64, len(portfolio))
+	for i := range portfolio {
+		portfolioCumulative *= 1 + portfolio[i]
+		modelCumulative *= 1 + model[i]
+		differences[i] = portfolio[i] - model[i]
+	}
+
+	res.PortfolioReturn = math.Round(10000*(portfolioCumulative-1)) / 100
+	res.ModelReturn = math.Round(10000*(modelCumulative-1)) / 100
+	res.TrackingError = math.Round(10000*stdDev(differences)*math.Sqrt(365)) / 100
+
+	return res, nil
+}
+
+// modelReturns returns the returns of the model between the consecutive times
+func (acc *TcfAccount) modelReturns(ctx context.Context, model *TcfModelPortfolio, times []time.Time) ([]float64, error) {
+
+	res := make([]float64, len(times)-1)
+
+	group, ctx := acc.newGroup(ctx)
+	var mu sync.Mutex
+
+	for ticker, weight := range model.Weights {
+
+		ticker, weight := ticker, weight
+		group.Go(func() error {
+
+			instrument, err := acc.GetByTicker(ctx, ticker)
+			if err != nil {
+				return err
+			}
+
+			candles, err := acc.dailyCandles(ctx, instrument.FIGI, times[0].AddDate(0, 0, -7), times[len(times)-1])
+			if err != nil {
+				return err
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			for i, r := range candleReturns(candles, times) {
+				res[i] += weight / 100 * r
+			}
+			return nil
+		})
+	}
+
+	if err := group.Wait(); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// PrintModelTracking prints the returns, the tracking error and the active weights
+func PrintModelTracking(w io.Writer, tracking *TcfModelTracking) {
+
+	fmt.Fprintf(w, "Model %s (%s): portfolio %.2f%%, model %.2f%%, tracking error %.2f%%\n",
+		tracking.Model, tracking.Currency, tracking.PortfolioReturn, tracking.ModelReturn, tracking.TrackingError)
+	RenderTable(w, tracking.ActiveWeights.Items)
+}
@@ -0,0 +1,195 @@
+package tinkoff
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	sdk "github.com/TinkoffCreditSystems/invest-openapi-go-sdk"
+	"github.com/shopspring/decimal"
+)
+
+const (
+	// ruTaxRate is the personal income tax rate on dividends in Russia
+	ruTaxRate = 0.13
+	// treatyRate is the withholding rate credited in Russia under the US-Russia tax treaty (W-8BEN filed)
+	treatyRate = 0.10
+	// noTreatyRate is the US withholding rate applied when W-8BEN is missing
+	noTreatyRate = 0.30
+)
+
+// TcfWithholdingRegime is the tax on the dividends of the issuers of a country: the rate withheld abroad
+// and the part of it credited against the russian tax, the rest of the russian tax is declared
+type TcfWithholdingRegime struct {
+	WithholdingRate decimal.Decimal
+	CreditedRate    decimal.Decimal
+}
+
+var (
+	// WithholdingUSW8BEN is the US treaty rate with W-8BEN filed: 10% withheld and credited, 3% declared
+	WithholdingUSW8BEN = TcfWithholdingRegime{WithholdingRate: decimal.NewFromFloat(treatyRate), CreditedRate: decimal.NewFromFloat(treatyRate)}
+	// WithholdingUSNoW8BEN is the US rate without W-8BEN: 30% withheld while only 10% is credited, 3% declared
+	WithholdingUSNoW8BEN = TcfWithholdingRegime{WithholdingRate: decimal.NewFromFloat(noTreatyRate), CreditedRate: decimal.NewFromFloat(treatyRate)}
+)
+
+// TotalRate returns the total tax rate of the dividend: the withheld one plus the russian tax not credited
+func (r TcfWithholdingRegime) TotalRate() decimal.Decimal {
+
+	credited := decimal.Min(r.WithholdingRate, r.CreditedRate)
+	declared := decimal.Max(decimal.Zero, decimal.NewFromFloat(ruTaxRate).Sub(credited))
+
+	return r.WithholdingRate.Add(declared)
+}
+
+type TcfDividendWithholding struct {
+	FIGI        string
+	Ticker      string
+	Date        time.Time
+	Currency    TcfCurrency
+	GrossAmount decimal.Decimal
+	TaxAmount   decimal.Decimal
+	// Rate is the effective withholding rate in percents
+	Rate float64
+	// MissingW8BEN is set when the dividend is withheld at 30%
+	MissingW8BEN bool
+	// DeclareAmount is the tax to be declared and paid in Russia additionally to the withheld one
+	DeclareAmount decimal.Decimal
+}
+
+type TcfWithholdingSummary struct {
+	Year          int
+	Currency      TcfCurrency
+	GrossAmount   decimal.Decimal
+	TaxAmount     decimal.Decimal
+	DeclareAmount decimal.Decimal
+	// ExtraTaxAmount is the tax withheld over the treaty rate which can't be credited in Russia
+	ExtraTaxAmount decimal.Decimal
+}
+
+type TcfWithholdingReport struct {
+	Dividends []*TcfDividendWithholding
+	Summary   []*TcfWithholdingSummary
+}
+
+// GetDividendWithholding analyzes the taxes withheld from the dividends paid in the period
+func (acc *TcfAccount) GetDividendWithholding(ctx context.Context, request *TcfGetOperationsRequest) (*TcfWithholdingReport, error) {
+
+	operations, err := acc.GetOperations(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	report := analyzeWithholding(operations)
+
+	tickers := make(map[string]string)
+	for _, dividend := range report.Dividends {
+
+		ticker, ok := tickers[dividend.FIGI]
+		if !ok {
+			instrument, err := acc.GetByFigi(ctx, dividend.FIGI)
+			if err != nil {
+				return nil, err
+			}
+			ticker = instrument.Ticker
+			tickers[dividend.FIGI] = ticker
+		}
+
+		dividend.Ticker = ticker
+	}
+
+	return report, nil
+}
+
+// analyzeWithholding matches every dividend with the tax withheld from it the same day
+func analyzeWithholding(operations []sdk.Operation) *TcfWithholdingReport {
+
+	type key struct {
+		figi     string
+		day      time.Time
+		currency sdk.Currency
+	}
+
+	dayOf := func(t time.Time) time.Time {
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	}
+
+	taxes := make(map[key]decimal.Decimal)
+	for _, operation := range filterOperations(operations, &filterOperationsCriteria{OperationTypes: []string{"TaxDividend"}}) {
+		k := key{operation.FIGI, dayOf(operation.DateTime), operation.Currency}
+		taxes[k] = taxes[k].Add(moneyAbs(operation.Payment))
+	}
+
+	report := &TcfWithholdingReport{Dividends: []*TcfDividendWithholding{}, Summary: []*TcfWithholdingSummary{}}
+
+	type summaryKey struct {
+		year     int
+		currency TcfCurrency
+	}
+	summary := make(map[summaryKey]*TcfWithholdingSummary)
+
+	for _, operation := range filterOperations(operations, &filterOperationsCriteria{OperationTypes: []string{"Dividend"}}) {
+
+		gross := moneyAbs(operation.Payment)
+		if gross.IsZero() {
+			continue
+		}
+
+		k := key{operation.FIGI, dayOf(operation.DateTime), operation.Currency}
+		tax := taxes[k]
+		// the tax is matched with one dividend only
+		delete(taxes, k)
+
+		dividend := &TcfDividendWithholding{
+			FIGI:        operation.FIGI,
+			Date:        operation.DateTime,
+			Currency:    TcfCurrency(operation.Currency),
+			GrossAmount: gross,
+			TaxAmount:   tax,
+			Rate:        tax.Div(gross).Mul(decimal.NewFromInt(100)).Round(2).InexactFloat64(),
+		}
+
+		extra := decimal.Zero
+
+		// the broker is the tax agent for the dividends paid in roubles, nothing is left to declare
+		if dividend.Currency != CurrencyRUB {
+
+			rate := tax.Div(gross)
+			dividend.MissingW8BEN = rate.Sub(decimal.NewFromFloat(noTreatyRate)).Abs().LessThan(decimal.NewFromFloat(0.005))
+
+			credited := decimal.Min(rate, decimal.NewFromFloat(treatyRate))
+			dividend.DeclareAmount = gross.Mul(decimal.Max(decimal.Zero, decimal.NewFromFloat(ruTaxRate).Sub(credited))).Round(2)
+
+			if rate.GreaterThan(decimal.NewFromFloat(treatyRate)) {
+				extra = gross.Mul(rate.Sub(decimal.NewFromFloat(treatyRate)))
+			}
+		}
+
+		report.Dividends = append(report.Dividends, dividend)
+
+		sk := summaryKey{operation.DateTime.Year(), dividend.Currency}
+		s, ok := summary[sk]
+		if !ok {
+			s = &TcfWithholdingSummary{Year: sk.year, Currency: sk.currency}
+			summary[sk] = s
+			report.Summary = append(report.Summary, s)
+		}
+
+		s.GrossAmount = s.GrossAmount.Add(gross)
+		s.TaxAmount = s.TaxAmount.Add(tax)
+		s.DeclareAmount = s.DeclareAmount.Add(dividend.DeclareAmount)
+		s.ExtraTaxAmount = s.ExtraTaxAmount.Add(extra)
+	}
+
+	sort.SliceStable(report.Dividends, func(i, j int) bool {
+		return report.Dividends[i].Date.Before(report.Dividends[j].Date)
+	})
+
+	sort.SliceStable(report.Summary, func(i, j int) bool {
+		if report.Summary[i].Year != report.Summary[j].Year {
+			return report.Summary[i].Year < report.Summary[j].Year
+		}
+		return report.Summary[i].Currency < report.Summary[j].Currency
+	})
+
+	return report
+}
@@ -0,0 +1,90 @@
+package tinkoff
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	sdk "github.com/TinkoffCreditSystems/invest-openapi-go-sdk"
+	"github.com/mikhailbolshakov/tinkoff/utils"
+)
+
+// TcfCashFlow is the money paid (negative) or received (positive) by the investor
+type TcfCashFlow struct {
+	Time   time.Time
+	Amount float64
+}
+
+// XIRR returns the annualized money-weighted return of the cash flows, false if there is no solution
+// (e.g. all the flows have the same sign)
+func XIRR(flows []TcfCashFlow) (float64, bool) {
+
+	if len(flows) < 2 {
+		return 0.0, false
+	}
+
+	sorted := make([]TcfCashFlow, len(flows))
+	copy(sorted, flows)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Time.Before(sorted[j].Time)
+	})
+
+	start := sorted[0].Time
+	years := make([]float64, len(sorted))
+	for i, flow := range sorted {
+		years[i] = flow.Time.Sub(start).Hours() / 24 / 365
+	}
+
+	netPresentValue := func(r float64) float64 {
+		npv := 0.0
+		for i, flow := range sorted {
+			npv += flow.Amount / math.Pow(1+r, years[i])
+		}
+		return npv
+	}
+
+	low, high := -0.9999, 100.0
+	npvLow, npvHigh := netPresentValue(low), netPresentValue(high)
+	if math.IsNaN(npvLow) || math.IsNaN(npvHigh) || npvLow*npvHigh > 0 {
+		return 0.0, false
+	}
+
+	for i := 0; i < 300 && high-low > 1e-10; i++ {
+		mid := (low + high) / 2
+		npvMid := netPresentValue(mid)
+		if npvMid*npvLow > 0 {
+			low, npvLow = mid, npvMid
+		} else {
+			high = mid
+		}
+	}
+
+	return (low + high) / 2, true
+}
+
+// positionCashFlows returns the investor's cash flows of the instrument's operations in the instrument's currency
+// with the current value as the final flow, an outflow for the short position to be bought back
+func positionCashFlows(operations []sdk.Operation, currency TcfCurrency, value float64, now time.Time) []TcfCashFlow {
+
+	flows := []TcfCashFlow{}
+
+	for _, oper := range operations {
+
+		if TcfCurrency(oper.Currency) != currency {
+			continue
+		}
+
+		switch utils.Category(oper.OperationType) {
+		case utils.CategoryTrade:
+			flows = append(flows, TcfCashFlow{Time: oper.DateTime, Amount: oper.Payment - math.Abs(oper.Commission.Value)})
+		case utils.CategoryIncome, utils.CategoryTax:
+			flows = append(flows, TcfCashFlow{Time: oper.DateTime, Amount: oper.Payment})
+		}
+	}
+
+	if value != 0 {
+		flows = append(flows, TcfCashFlow{Time: now, Amount: value})
+	}
+
+	return flows
+}
@@ -0,0 +1,175 @@
+package tinkoff
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/shopspring/decimal"
+	"github.com/xuri/excelize/v2"
+)
+
+const xlsxMoneyFormat = "#,##0.00"
+
+var xlsxColumns = []string{"FIGI", "Ticker", "Name", "Balance", "Commission", "Portfolio", "Dividend", "Dividend tax", "Coupon", "Coupon tax", "Repayment", "Margin fee"}
+
+// ExportBalanceXLSX writes the balance as an Excel workbook with a sheet per currency
+func ExportBalanceXLSX(balance *TcfPortfolioBalance, w io.Writer) error {
+	return exportBalanceXLSX(balance, LocaleEN, w)
+}
+
+// exportBalanceXLSX writes the workbook with the headers in the locale, the number formats are localized by Excel
+func exportBalanceXLSX(balance *TcfPortfolioBalance, locale TcfLocale, w io.Writer) error {
+
+	f := excelize.NewFile()
+	defer f.Close()
+
+	header, err := f.NewStyle(&excelize.Style{Font: &excelize.Font{Bold: true}})
+	if err != nil {
+		return err
+	}
+
+	amount, err := f.NewStyle(&excelize.Style{CustomNumFmt: strPtr(xlsxMoneyFormat)})
+	if err != nil {
+		return err
+	}
+
+	total, err := f.NewStyle(&excelize.Style{Font: &excelize.Font{Bold: true}, CustomNumFmt: strPtr(xlsxMoneyFormat)})
+	if err != nil {
+		return err
+	}
+
+	currencies := balance.Total.SortedCurrencies()
+	if len(currencies) == 0 {
+		// a workbook must contain at least one sheet, the default one is kept empty
+		return f.Write(w)
+	}
+
+	for i, currency := range currencies {
+
+		sheet := string(currency)
+		if i == 0 {
+			if err := f.SetSheetName("Sheet1", sheet); err != nil {
+				return err
+			}
+		} else if _, err := f.NewSheet(sheet); err != nil {
+			return err
+		}
+
+		for col, title := range xlsxColumns {
+			if err := f.SetCellValue(sheet, xlsxCell(col, 1), locale.Text(title)); err != nil {
+				return err
+			}
+		}
+		if err := f.SetCellStyle(sheet, xlsxCell(0, 1), xlsxCell(len(xlsxColumns)-1, 1), header); err != nil {
+			return err
+		}
+
+		row := 2
+		for _, item := range balance.Items {
+
+			if item.Currency != currency {
+				continue
+			}
+
+			values := []interface{}{
+				item.FIGI,
+				item.Ticker,
+				item.Name,
+				presentMoney(item.BalanceAmount),
+				presentMoney(item.BrokerCommissionAmount),
+				presentMoney(item.PortfolioAmount),
+				presentMoney(item.DividendAmount),
+				presentMoney(item.DividendTaxAmount),
+				presentMoney(item.CouponAmount),
+				presentMoney(item.CouponTaxAmount),
+				presentMoney(item.RepaymentAmount),
+				presentMoney(item.MarginFeeAmount),
+			}
+
+			if err := f.SetSheetRow(sheet, xlsxCell(0, row), &values); err != nil {
+				return err
+			}
+			row++
+		}
+
+		// the amounts out of the items are added to the balance as the rows of their own,
+		// so the total of the sheet is the total of the currency
+		adjustments := []struct {
+			title  string
+			amount decimal.Decimal
+		}{
+			{"Foreign income", xlsxForeignIncome(balance, currency)},
+			{"Service commission", balance.Total.Currencies[currency].ServiceCommissionAmount.Neg()},
+			{"Tax back", balance.Total.Currencies[currency].TaxBack},
+		}
+		for _, adjustment := range adjustments {
+
+			if adjustment.amount.IsZero() {
+				continue
+			}
+
+			if err := f.SetCellValue(sheet, xlsxCell(2, row), locale.Text(adjustment.title)); err != nil {
+				return err
+			}
+			if err := f.SetCellValue(sheet, xlsxCell(3, row), presentMoney(adjustment.amount)); err != nil {
+				return err
+			}
+			row++
+		}
+
+		if row > 2 {
+			if err := f.SetCellStyle(sheet, xlsxCell(3, 2), xlsxCell(len(xlsxColumns)-1, row-1), amount); err != nil {
+				return err
+			}
+		}
+
+		// the totals row sums the columns with formulas so the sheet stays consistent when edited
+		if err := f.SetCellValue(sheet, xlsxCell(2, row), locale.Text("Total")); err != nil {
+			return err
+		}
+		for col := 3; col < len(xlsxColumns); col++ {
+			formula := fmt.Sprintf("SUM(%s:%s)", xlsxCell(col, 2), xlsxCell(col, row-1))
+			if row == 2 {
+				formula = "0"
+			}
+			if err := f.SetCellFormula(sheet, xlsxCell(col, row), formula); err != nil {
+				return err
+			}
+		}
+		if err := f.SetCellStyle(sheet, xlsxCell(0, row), xlsxCell(len(xlsxColumns)-1, row), total); err != nil {
+			return err
+		}
+
+		if err := f.SetColWidth(sheet, "A", "C", 20); err != nil {
+			return err
+		}
+		if err := f.SetColWidth(sheet, "D", "L", 14); err != nil {
+			return err
+		}
+	}
+
+	return f.Write(w)
+}
+
+// xlsxForeignIncome returns the net income paid in the currency on the instruments of the other currencies
+func xlsxForeignIncome(balance *TcfPortfolioBalance, currency TcfCurrency) decimal.Decimal {
+
+	res := decimal.Zero
+	for _, item := range balance.Items {
+		if income, ok := item.ForeignIncome()[currency]; ok {
+			res = res.Add(netIncome(income)).Add(income.RepaymentAmount)
+		}
+	}
+
+	return res
+}
+
+// xlsxCell returns the name of the cell by the zero-based column and the one-based row
+func xlsxCell(col, row int) string {
+	name, _ := excelize.CoordinatesToCellName(col+1, row)
+	return name
+}
+
+func strPtr(s string) *string {
+	return &s
+}